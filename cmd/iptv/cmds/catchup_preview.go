@@ -0,0 +1,123 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iptv/internal/app/iptv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const catchupPreviewTimeLayout = "20060102150405"
+
+var (
+	previewCatchupSource string
+	previewStart         string
+	previewEnd           string
+	previewJSON          bool
+)
+
+// catchupPreview 单个频道的回看地址预览
+type catchupPreview struct {
+	ChannelID   string `json:"channelID"`   // 频道ID
+	ChannelName string `json:"channelName"` // 频道名称
+	CatchupURL  string `json:"catchupURL"`  // 按开始及结束时间生成的回看地址
+}
+
+func NewCatchupPreviewCLI() *cobra.Command {
+	previewCmd := &cobra.Command{
+		Use:   "catchup-preview",
+		Short: "按指定的开始及结束时间，输出所有支持回看的频道实际请求的回看地址。",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// 校验配置文件
+			if err := conf.Validate(); err != nil {
+				return err
+			}
+
+			// 解析回看的开始及结束时间，缺省为最近一个小时
+			end := time.Now().Truncate(time.Hour)
+			start := end.Add(-time.Hour)
+			var err error
+			if previewStart != "" {
+				if start, err = time.ParseInLocation(catchupPreviewTimeLayout, previewStart, time.Local); err != nil {
+					return err
+				}
+			}
+			if previewEnd != "" {
+				if end, err = time.ParseInLocation(catchupPreviewTimeLayout, previewEnd, time.Local); err != nil {
+					return err
+				}
+			}
+			if !end.After(start) {
+				return errors.New("the end time must be after the start time")
+			}
+
+			// 创建IPTV客户端
+			i, err := conf.NewIPTVClient()
+			if err != nil {
+				return err
+			}
+
+			// 获取频道列表
+			channels, err := i.GetAllChannelList(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			previews := getCatchupPreviews(channels, iptv.ConvertCatchupTimeBase(previewCatchupSource, conf.Catchup.TimeBase), start, end)
+			if len(previews) == 0 {
+				return errors.New("no timeshift channels found")
+			}
+			return writeCatchupPreviews(cmd.OutOrStdout(), previews, previewJSON)
+		},
+	}
+
+	previewCmd.Flags().StringVarP(&previewCatchupSource, "catchup-source", "s", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", "回看的请求格式字符串，与channel命令保持一致。")
+	previewCmd.Flags().StringVar(&previewStart, "start", "", "回看的开始时间，格式为yyyyMMddHHmmss。缺省为上一个整点前一个小时。")
+	previewCmd.Flags().StringVar(&previewEnd, "end", "", "回看的结束时间，格式为yyyyMMddHHmmss。缺省为上一个整点。")
+	previewCmd.Flags().BoolVar(&previewJSON, "json", false, "是否以JSON格式输出。缺省为false，以表格形式输出。")
+
+	return previewCmd
+}
+
+// getCatchupPreviews 生成所有支持回看的频道的回看地址
+func getCatchupPreviews(channels []iptv.Channel, catchupSource string, start, end time.Time) []catchupPreview {
+	previews := make([]catchupPreview, 0, len(channels))
+	for _, channel := range channels {
+		chCatchupSource := iptv.GetChannelCatchupSource(&channel, catchupSource)
+		if chCatchupSource == "" {
+			continue
+		}
+		previews = append(previews, catchupPreview{
+			ChannelID:   channel.ChannelID,
+			ChannelName: channel.ChannelName,
+			CatchupURL:  iptv.ExpandCatchupSource(chCatchupSource, start, end),
+		})
+	}
+	return previews
+}
+
+// writeCatchupPreviews 以表格或JSON格式输出回看地址
+func writeCatchupPreviews(w io.Writer, previews []catchupPreview, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(previews)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "CHANNEL ID\tCHANNEL NAME\tCATCHUP URL"); err != nil {
+		return err
+	}
+	for _, preview := range previews {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", preview.ChannelID, preview.ChannelName, preview.CatchupURL); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
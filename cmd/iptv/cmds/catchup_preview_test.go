@@ -0,0 +1,59 @@
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"iptv/internal/app/iptv"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWriteCatchupPreviews(t *testing.T) {
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/1?a=1")
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: 72 * time.Hour, TimeShiftURL: timeShiftURL},
+		{ChannelID: "2", ChannelName: "CCTV2"},
+	}
+	start := time.Date(2024, 11, 22, 6, 0, 0, 0, time.Local)
+	end := time.Date(2024, 11, 22, 7, 0, 0, 0, time.Local)
+
+	previews := getCatchupPreviews(channels, "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", start, end)
+	if len(previews) != 1 {
+		t.Fatalf("len(previews) = %d, want 1", len(previews))
+	}
+
+	var buf bytes.Buffer
+	if err := writeCatchupPreviews(&buf, previews, false); err != nil {
+		t.Fatalf("writeCatchupPreviews() error = %v", err)
+	}
+	want := "CHANNEL ID  CHANNEL NAME  CATCHUP URL\n" +
+		"1           CCTV1         http://10.0.0.1/timeshift/1?a=1&playseek=20241122060000-20241122070000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeCatchupPreviews() output =\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := writeCatchupPreviews(&buf, previews, true); err != nil {
+		t.Fatalf("writeCatchupPreviews() error = %v", err)
+	}
+	var got []catchupPreview
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != previews[0] {
+		t.Errorf("writeCatchupPreviews() json = %+v, want %+v", got, previews)
+	}
+}
+
+func TestGetCatchupPreviewsProxy(t *testing.T) {
+	channels := []iptv.Channel{{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: 24 * time.Hour}}
+	start := time.Unix(1732226400, 0)
+	end := time.Unix(1732230000, 0)
+
+	previews := getCatchupPreviews(channels, "http://127.0.0.1:8080/catchup/${channelId}?start=${start}&end=${end}", start, end)
+	want := "http://127.0.0.1:8080/catchup/1?start=1732226400&end=1732230000"
+	if len(previews) != 1 || previews[0].CatchupURL != want {
+		t.Errorf("getCatchupPreviews() = %+v, want %s", previews, want)
+	}
+}
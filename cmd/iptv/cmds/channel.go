@@ -1,13 +1,14 @@
 package cmds
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"iptv/internal/app/iptv"
-	"iptv/internal/app/iptv/hwctc"
 	"iptv/internal/pkg/util"
-	"net/http"
 	"os"
-	"path"
+	"path/filepath"
 	"slices"
 	"time"
 
@@ -16,39 +17,78 @@ import (
 )
 
 const (
-	fileName = "iptv"
+	fileName         = "iptv"
+	snapshotFileName = "iptv_channels.json" // 增量导出时保存的上次频道列表
 )
 
 var (
-	supportFileFormat = []string{"txt", "m3u", "pls"}
+	supportFileFormat = []string{"txt", "m3u", "pls", "json"}
 	udpxyURL          string
 	format            string
 	catchupSource     string
+	catchupEntry      bool
+	target            string
+	tvgRec            bool
 	multicastFirst    bool
+	favoritesFile     string
+	summaryJSON       string
+	delta             bool
+	verboseJSON       bool
+	groupComments     bool
+	includeGroups     []string
+	excludeGroups     []string
+	catchupDaysEPG    bool
+	outDir            string
+	dedup             bool
+	sortBy            string
+	strict            bool
+	rtspProxy         string
+	region            string
+	limit             int
 )
 
+// channelSummary channel命令执行结果的摘要，供脚本等自动化场景使用
+type channelSummary struct {
+	Channels    int            `json:"channels"`        // 频道数量
+	Groups      map[string]int `json:"groups"`          // 各分组的频道数量
+	LogoMatched int            `json:"logoMatched"`     // 匹配到台标的频道数量
+	TimeShift   int            `json:"timeShift"`       // 支持时移的频道数量
+	OutputFiles []string       `json:"outputFiles"`     // 生成的文件列表
+	Duration    string         `json:"duration"`        // 执行耗时
+	Error       string         `json:"error,omitempty"` // 执行失败时的错误信息
+}
+
 func NewChannelCLI() *cobra.Command {
 	channelCmd := &cobra.Command{
 		Use:   "channel",
 		Short: "获取频道列表，并按指定格式生成直播源文件。",
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			// L()：获取全局logger
 			logger := zap.L()
+			start := time.Now()
 
 			// 校验配置文件
 			if err := conf.Validate(); err != nil {
 				return err
 			}
+			// 使用--region指定的节目单API接口
+			if err := conf.SetRegion(region); err != nil {
+				return err
+			}
 
 			// 创建IPTV客户端
-			i, err := hwctc.NewClient(&http.Client{
-				Timeout: 10 * time.Second,
-			}, conf.HWCTC, conf.Key, conf.ServerHost, conf.Headers,
-				conf.ChExcludeRule, conf.ChGroupRulesList, conf.ChLogoRuleList)
+			i, err := conf.NewIPTVClient()
 			if err != nil {
 				return err
 			}
 
+			// 检查IPTV服务器的连通性
+			if conf.Precheck {
+				if err = iptv.CheckPortalReachable(cmd.Context(), conf.ServerHost, iptv.DefaultPrecheckTimeout); err != nil {
+					return err
+				}
+			}
+
 			// 获取频道列表
 			channels, err := i.GetAllChannelList(cmd.Context())
 			if err != nil {
@@ -59,62 +99,337 @@ func NewChannelCLI() *cobra.Command {
 				return errors.New("no channels found")
 			}
 
+			// 合并频道ID相同的频道，未指定--dedup时使用配置文件中的设置
+			if !cmd.Flags().Changed("dedup") {
+				dedup = conf.ChDedup
+			}
+			if dedup {
+				var merged int
+				if channels, merged = iptv.MergeDuplicateChannels(channels); merged > 0 {
+					logger.Info("Duplicate channels have been merged.", zap.Int("merged", merged))
+				}
+			}
+
+			// 输出执行结果的摘要，部分步骤失败时也会输出
+			var outputFiles []string
+			if summaryJSON != "" {
+				defer func() {
+					summary := newChannelSummary(channels, outputFiles, time.Since(start), err)
+					if wErr := writeChannelSummary(summaryJSON, summary); wErr != nil {
+						logger.Error("Failed to write the summary file.", zap.Error(wErr))
+					}
+				}()
+			}
+
+			// 按收藏列表过滤频道并排序
+			if favoritesFile != "" {
+				if channels, err = filterChannelsByFavorites(channels, favoritesFile); err != nil {
+					return err
+				}
+			}
+
+			// 设置没有分组的频道的分组名称
+			iptv.SetChannelDefaultGroup(channels, conf.ChDefaultGroup)
+			// 按配置的分组顺序排列频道
+			channels = iptv.SortChannelsByGroupOrder(channels, conf.GroupOrder.Groups, conf.GroupOrder.Unlisted)
+			// 按分组名称过滤频道
+			channels = iptv.FilterChannelsByGroups(channels, includeGroups, excludeGroups)
+			if len(channels) == 0 {
+				return errors.New("no channels found after filtering by groups")
+			}
+			// 改写频道单播地址的协议
+			iptv.SetChannelURLScheme(channels, conf.ChURLScheme)
+			// 没有时移地址的频道使用直播地址进行回看
+			if conf.Catchup.LiveFallback {
+				iptv.SetChannelLiveTimeShiftURL(channels)
+			}
+			// 设置频道的DRM信息
+			iptv.SetChannelDRM(channels, conf.ChDRMMap)
+			// 设置频道的国家和语言信息
+			iptv.SetChannelLocale(channels, conf.ChDefaultLocale, conf.ChGroupLocaleMap)
+
+			// 检查重复的频道号
+			duplicates := iptv.CheckChannelNumbers(channels, conf.ChRenumberDuplicates)
+			for _, number := range util.SortedMapKeys(duplicates) {
+				logger.Warn("Duplicate channel number found.", zap.String("userChannelID", number), zap.Strings("channelNames", duplicates[number]), zap.Bool("renumber", conf.ChRenumberDuplicates))
+			}
+
+			// 设置频道的tvg-id
+			iptv.SetChannelTvgID(channels, conf.TvgIDField)
+
 			if !slices.Contains(supportFileFormat, format) {
 				return errors.New("file format not support")
 			}
+			if target != iptv.M3UTargetDefault && target != iptv.M3UTargetTvheadend {
+				return errors.New("m3u target not support")
+			}
+			if !iptv.IsValidChannelSort(sortBy) {
+				return errors.New("channel sort not support")
+			}
+			if limit < 0 {
+				return errors.New("channel limit must not be negative")
+			}
 
-			// 在当前目录中创建频道文件
+			// 在输出目录中创建频道文件，未指定时使用程序所在目录
 			outFileName := fileName + "." + format
-			currDir, err := util.GetCurrentAbPathByExecutable()
+			currDir, err := resolveOutputPath(outDir)
 			if err != nil {
 				return err
 			}
-			filePath := path.Join(currDir, outFileName)
-			file, err := os.Create(filePath)
-			if err != nil {
-				logger.Error("Failed to create a file.", zap.Error(err))
+			if err = ensureOutputDir(currDir); err != nil {
+				return err
+			}
+			filePath := filepath.Join(currDir, outFileName)
+
+			// 仅导出与上次相比新增或变化的频道，本次的频道列表在写入文件成功后保存
+			snapshotPath := filepath.Join(currDir, snapshotFileName)
+			allChannels := channels
+			if delta {
+				if channels, err = getDeltaChannels(channels, snapshotPath); err != nil {
+					return err
+				}
+				// 没有变化的频道时，不生成直播源文件
+				if len(channels) == 0 {
+					logger.Info("No channels have changed since the last run, skip writing the file.", zap.String("file", filePath))
+					return saveChannelSnapshot(snapshotPath, allChannels)
+				}
+			}
+
+			// 按指定的方式对频道排序
+			channels = iptv.SortChannels(channels, sortBy)
+			// 仅输出前N个频道，便于调试回看等格式
+			if limit > 0 && len(channels) > limit {
+				channels = channels[:limit]
+			}
+
+			// 组播转单播的地址
+			relayURL := iptv.WithMulticastRelayPath(udpxyURL, conf.MulticastRelayPath)
+			// 通过rtsp转http代理访问rtsp单播地址
+			if channels, err = iptv.WithRTSPProxy(channels, rtspProxy); err != nil {
 				return err
 			}
-			defer file.Close()
 
 			var content string
 			switch format {
 			case supportFileFormat[0]:
 				// 将获取到的频道列表转换为TXT格式
-				content, err = iptv.ToTxtFormat(channels, udpxyURL, multicastFirst)
+				content, err = iptv.ToTxtFormat(channels, relayURL, multicastFirst, nil)
 				if err != nil {
 					return err
 				}
 			case supportFileFormat[1]:
+				// 按节目单实际覆盖的回看天数限制catchup-days
+				var epgBackDaysMap map[string]int
+				if catchupDaysEPG || conf.CatchupDaysFromEPG {
+					epgBackDaysMap = getEPGBackDaysMap(cmd.Context(), i, channels)
+				}
 				// 将获取到的频道列表转换为M3U格式
-				content, err = iptv.ToM3UFormat(channels, udpxyURL, catchupSource, multicastFirst, "")
+				var skipped []string
+				content, skipped, err = iptv.ToM3UFormat(channels, relayURL, iptv.ConvertCatchupTimeBase(catchupSource, conf.Catchup.TimeBase), multicastFirst, iptv.M3UOptions{
+					ExtInfDuration: conf.ExtInfDuration,
+					CatchupEntry:   catchupEntry,
+					Target:         target,
+					TvgRec:         tvgRec,
+					GroupComments:  groupComments,
+					MaxCatchupDays: conf.MaxCatchupDays,
+					LogoDir:        conf.LogoDir,
+					EPGBackDaysMap: epgBackDaysMap,
+					Strict:         strict || conf.M3UStrict,
+				})
 				if err != nil {
 					return err
 				}
+				if len(skipped) > 0 {
+					logger.Warn("Channels without a valid url have been skipped.", zap.Int("skipped", len(skipped)), zap.Strings("channels", skipped))
+				}
 			case supportFileFormat[2]:
 				// 将获取到的频道列表转换为PLS(playlist)格式
-				content, err = iptv.ToPLSFormat(channels, udpxyURL, multicastFirst)
+				content, err = iptv.ToPLSFormat(channels, relayURL, multicastFirst)
+				if err != nil {
+					return err
+				}
+			case supportFileFormat[3]:
+				// 将获取到的频道列表转换为JSON格式
+				content, err = iptv.ToJSONFormat(channels, relayURL, iptv.ConvertCatchupTimeBase(catchupSource, conf.Catchup.TimeBase), multicastFirst, "", conf.MaxCatchupDays, conf.LogoDir, verboseJSON)
 				if err != nil {
 					return err
 				}
 			}
 
 			// 将结果写入文件
-			if _, err = file.WriteString(content); err != nil {
+			if err = os.WriteFile(filePath, []byte(iptv.NormalizeTrailingNewline(content, conf.TrailingNewline)), 0o644); err != nil {
 				logger.Error("Failed to write to file.", zap.Error(err))
 				return err
 			}
 
-			logger.Sugar().Infof("A total of %d channels have been found, all of which have been written to the file %s.", len(channels), outFileName)
+			outputFiles = append(outputFiles, filePath)
+
+			// 写入成功后，保存本次的频道列表
+			if delta {
+				if err = saveChannelSnapshot(snapshotPath, allChannels); err != nil {
+					return err
+				}
+			}
+
+			logger.Sugar().Infof("A total of %d channels have been found, all of which have been written to the file %s.", len(channels), filePath)
 
 			return nil
 		},
 	}
 
-	channelCmd.Flags().StringVarP(&udpxyURL, "udpxy", "u", "", "如果有安装udpxy进行组播转单播，请配置HTTP地址，e.g `http://192.168.1.1:4022`。")
-	channelCmd.Flags().StringVarP(&format, "format", "f", "m3u", "生成的直播源文件格式，e.g `m3u,txt或pls`。")
-	channelCmd.Flags().StringVarP(&catchupSource, "catchup-source", "s", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", "回看的请求格式字符串，会追加在时移地址后面。")
+	channelCmd.Flags().StringVarP(&udpxyURL, "udpxy", "u", "", "如果有安装udpxy进行组播转单播，请配置HTTP地址，e.g `http://192.168.1.1:4022`。也可以是包含${addr}、${port}占位符的完整地址模板。")
+	channelCmd.Flags().StringVar(&rtspProxy, "rtsp-proxy", "", "如果有安装rtsp转http的代理，请配置HTTP地址，rtsp地址将改写为`http://<代理地址>/rtsp/<主机>/<路径>`。缺省不改写。")
+	channelCmd.Flags().StringVarP(&format, "format", "f", "m3u", "生成的直播源文件格式，e.g `m3u,txt,pls或json`。")
+	channelCmd.Flags().StringVarP(&catchupSource, "catchup-source", "s", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", "回看的请求格式字符串，会追加在时移地址后面。若为完整的http(s)地址，则直接作为回看地址。支持${channelId}、${channelName}、${timeshiftLen}占位符。Flussonic风格可使用'utc=${start}&lutc=${timestamp}'。")
+	channelCmd.Flags().BoolVar(&catchupEntry, "catchup-entry", false, "是否为支持回看的频道额外输出一个指向时移地址的回看条目（m3u格式）。缺省为false。")
+	channelCmd.Flags().BoolVar(&catchupDaysEPG, "catchup-days-from-epg", false, "是否按频道节目单实际覆盖的回看天数限制catchup-days（m3u格式），需要额外获取节目单。缺省为false。")
+	channelCmd.Flags().StringVar(&sortBy, "sort", iptv.ChannelSortNone, "频道的排序方式，e.g `none,chno或name`。chno按频道号排序，name按频道名称排序。缺省为none保持原有顺序。")
+	channelCmd.Flags().StringVar(&target, "target", iptv.M3UTargetDefault, "生成m3u的目标服务，e.g `tvheadend`。缺省为标准的m3u格式。")
+	channelCmd.Flags().BoolVar(&tvgRec, "tvg-rec", false, "是否为支持时移的频道输出tvg-rec属性，标记频道可录制（m3u格式）。缺省为false。")
+	channelCmd.Flags().BoolVar(&strict, "strict", false, "生成m3u时，存在无法获取URL地址的频道是否中止生成并返回错误。缺省为false，跳过该频道并记录警告日志。")
+	channelCmd.Flags().BoolVar(&groupComments, "group-comments", false, "是否在每个分组的第一个频道前输出分组名称及频道数量的注释行（m3u格式）。缺省为false。")
+	channelCmd.Flags().StringSliceVar(&includeGroups, "groups", nil, "仅输出指定分组的频道，多个分组以逗号分隔，不区分大小写。缺省输出所有分组。")
+	channelCmd.Flags().StringSliceVar(&excludeGroups, "exclude-groups", nil, "不输出指定分组的频道，多个分组以逗号分隔，不区分大小写。")
+	channelCmd.Flags().StringVar(&outDir, "out-dir", "", "生成的直播源文件所在的目录，不存在时自动创建，相对路径时相对于程序所在目录。缺省为程序所在目录。")
+	channelCmd.Flags().BoolVar(&dedup, "dedup", true, "是否合并频道ID相同的频道，保留首个频道的名称及分组，合并所有频道地址。缺省使用配置文件中的chDedup（默认为true）。")
+	channelCmd.Flags().StringVar(&favoritesFile, "favorites", "", "收藏的频道列表文件，每行一个频道ID或频道名称，仅按文件中的顺序输出这些频道。")
+	channelCmd.Flags().StringVar(&summaryJSON, "summary-json", "", "执行结束后将结果摘要以JSON格式写入该文件，包括频道数量、分组、台标、时移及输出文件等信息。")
+	channelCmd.Flags().BoolVar(&delta, "delta", false, "是否仅导出与上次执行相比新增或地址、名称、分组发生变化的频道。缺省为false。")
+	channelCmd.Flags().BoolVar(&verboseJSON, "verbose-json", false, "JSON格式时，是否额外输出频道的所有原始地址及实际选择的地址，便于排查地址的选择。缺省为false。")
+	channelCmd.Flags().IntVar(&limit, "limit", 0, "仅输出过滤及排序后的前N个频道，便于快速调试。缺省为0表示不限制。")
+	channelCmd.Flags().StringVar(&region, "region", "", "请求节目单的API接口，即配置文件中hwctc.channelProgramAPI的别名，e.g `liveplay_30,gdhdpublic,vsp,StbEpg2023Group,defaulttrans2或playbill`。缺省使用配置文件。")
 	channelCmd.Flags().BoolVarP(&multicastFirst, "multicast-first", "m", false, "当频道存在多个URL地址时，是否优先使用组播地址。缺省为false。")
 
 	return channelCmd
 }
+
+// filterChannelsByFavorites 读取收藏的频道列表文件，并按文件中的顺序过滤频道
+func filterChannelsByFavorites(channels []iptv.Channel, fPath string) ([]iptv.Channel, error) {
+	logger := zap.L()
+
+	file, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	favorites, err := iptv.ReadFavorites(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result, unknown := iptv.FilterChannelsByFavorites(channels, favorites)
+	for _, favorite := range unknown {
+		logger.Warn("The favorite channel was not found, skip it.", zap.String("channel", favorite))
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no favorite channels found")
+	}
+	return result, nil
+}
+
+// newChannelSummary 统计频道列表，生成执行结果的摘要
+func newChannelSummary(channels []iptv.Channel, outputFiles []string, duration time.Duration, err error) *channelSummary {
+	summary := channelSummary{
+		Channels:    len(channels),
+		Groups:      make(map[string]int),
+		OutputFiles: outputFiles,
+		Duration:    duration.String(),
+	}
+	if summary.OutputFiles == nil {
+		summary.OutputFiles = []string{}
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	for _, channel := range channels {
+		summary.Groups[channel.GroupName]++
+		if channel.LogoName != "" {
+			summary.LogoMatched++
+		}
+		if channel.TimeShift == "1" && channel.TimeShiftLength > 0 {
+			summary.TimeShift++
+		}
+	}
+	return &summary
+}
+
+// writeChannelSummary 将执行结果的摘要写入JSON文件
+func writeChannelSummary(fPath string, summary *channelSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath, data, 0o644)
+}
+
+// getDeltaChannels 与上次保存的频道列表比较，获取新增或变化的频道
+func getDeltaChannels(channels []iptv.Channel, snapshotPath string) ([]iptv.Channel, error) {
+	logger := zap.L()
+
+	// 读取上次的频道列表，不存在时导出全部频道
+	var prevChannels []iptv.Channel
+	prevFile, err := os.Open(snapshotPath)
+	if err == nil {
+		prevChannels, err = iptv.ReadChannelSnapshot(prevFile)
+		prevFile.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	result := iptv.GetChangedChannels(prevChannels, channels)
+	logger.Sugar().Infof("%d of %d channels are new or changed since the last run.", len(result), len(channels))
+	return result, nil
+}
+
+// saveChannelSnapshot 保存本次的频道列表，供下次增量导出时比较
+func saveChannelSnapshot(snapshotPath string, channels []iptv.Channel) error {
+	file, err := os.Create(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if err = iptv.WriteChannelSnapshot(file, channels); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// getEPGBackDaysMap 获取频道的节目单并计算实际覆盖的回看天数，获取失败时返回nil，按时移长度输出
+func getEPGBackDaysMap(ctx context.Context, i iptv.Client, channels []iptv.Channel) map[string]int {
+	chProgLists, err := i.GetAllChannelProgramList(ctx, channels)
+	if err != nil {
+		zap.L().Warn("Failed to get the program lists. Use the time shift length as catchup days.", zap.Error(err))
+		return nil
+	}
+	return iptv.GetEPGBackDays(chProgLists, time.Now(), conf.TimeLocation)
+}
+
+// resolveOutputPath 获取输出路径的绝对路径，为空时使用程序所在目录，相对路径时相对于程序所在目录
+func resolveOutputPath(p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p), nil
+	}
+	currDir, err := util.GetCurrentAbPathByExecutable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(currDir, p), nil
+}
+
+// ensureOutputDir 创建输出目录，并检查目录是否可写
+func ensureOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create the output directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("the output directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,137 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"iptv/internal/app/iptv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteChannelSummary(t *testing.T) {
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", GroupName: "央视", LogoName: "CCTV1.png", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "2", ChannelName: "CCTV2", GroupName: "央视", LogoName: "CCTV2.png"},
+		{ChannelID: "3", ChannelName: "湖南卫视", GroupName: "卫视", TimeShift: "1", TimeShiftLength: time.Hour},
+	}
+
+	fPath := filepath.Join(t.TempDir(), "summary.json")
+	summary := newChannelSummary(channels, []string{"/tmp/iptv.m3u"}, 1500*time.Millisecond, nil)
+	if err := writeChannelSummary(fPath, summary); err != nil {
+		t.Fatalf("writeChannelSummary() error = %v", err)
+	}
+
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var got channelSummary
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if got.Channels != 3 {
+		t.Errorf("Channels = %d, want 3", got.Channels)
+	}
+	if got.Groups["央视"] != 2 || got.Groups["卫视"] != 1 || len(got.Groups) != 2 {
+		t.Errorf("Groups = %v, want map[卫视:1 央视:2]", got.Groups)
+	}
+	if got.LogoMatched != 2 {
+		t.Errorf("LogoMatched = %d, want 2", got.LogoMatched)
+	}
+	if got.TimeShift != 2 {
+		t.Errorf("TimeShift = %d, want 2", got.TimeShift)
+	}
+	if !slices.Equal(got.OutputFiles, []string{"/tmp/iptv.m3u"}) {
+		t.Errorf("OutputFiles = %v, want [/tmp/iptv.m3u]", got.OutputFiles)
+	}
+	if got.Duration != "1.5s" {
+		t.Errorf("Duration = %q, want 1.5s", got.Duration)
+	}
+	if got.Error != "" {
+		t.Errorf("Error = %q, want empty", got.Error)
+	}
+}
+
+func TestNewChannelSummaryPartial(t *testing.T) {
+	channels := []iptv.Channel{{ChannelID: "1", ChannelName: "CCTV1", GroupName: "央视"}}
+
+	summary := newChannelSummary(channels, nil, time.Second, errors.New("file format not support"))
+	if summary.Channels != 1 {
+		t.Errorf("Channels = %d, want 1", summary.Channels)
+	}
+	if summary.OutputFiles == nil || len(summary.OutputFiles) != 0 {
+		t.Errorf("OutputFiles = %v, want empty slice", summary.OutputFiles)
+	}
+	if summary.Error != "file format not support" {
+		t.Errorf("Error = %q, want %q", summary.Error, "file format not support")
+	}
+}
+
+func TestEnsureOutputDir(t *testing.T) {
+	// 目录不存在时自动创建
+	dir := filepath.Join(t.TempDir(), "data", "iptv")
+	if err := ensureOutputDir(dir); err != nil {
+		t.Fatalf("ensureOutputDir() error = %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("output directory not created: %v", err)
+	}
+	// 检查是否可写时不残留临时文件
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("output directory is not empty: %v", entries)
+	}
+
+	// 路径被普通文件占用时返回错误
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureOutputDir(filepath.Join(file, "sub")); err == nil {
+		t.Error("ensureOutputDir() error = nil, want error")
+	}
+}
+
+func TestGetDeltaChannels(t *testing.T) {
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", GroupName: "央视"},
+		{ChannelID: "2", ChannelName: "湖南卫视", GroupName: "卫视"},
+	}
+	snapshotPath := filepath.Join(t.TempDir(), snapshotFileName)
+
+	// 首次执行时导出全部频道，且计算增量时不保存频道列表
+	result, err := getDeltaChannels(channels, snapshotPath)
+	if err != nil {
+		t.Fatalf("getDeltaChannels() error = %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("len(result) = %d, want 2", len(result))
+	}
+	if _, err = os.Stat(snapshotPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	// 保存后没有变化的频道
+	if err = saveChannelSnapshot(snapshotPath, channels); err != nil {
+		t.Fatalf("saveChannelSnapshot() error = %v", err)
+	}
+	if result, err = getDeltaChannels(channels, snapshotPath); err != nil {
+		t.Fatalf("getDeltaChannels() error = %v", err)
+	}
+	if len(result) != 0 {
+		t.Errorf("len(result) = %d, want 0", len(result))
+	}
+
+	// 仅导出名称发生变化的频道
+	changed := slices.Clone(channels)
+	changed[1].ChannelName = "湖南卫视高清"
+	if result, err = getDeltaChannels(changed, snapshotPath); err != nil {
+		t.Fatalf("getDeltaChannels() error = %v", err)
+	}
+	if len(result) != 1 || result[0].ChannelID != "2" {
+		t.Errorf("result = %+v, want channel 2", result)
+	}
+}
@@ -0,0 +1,317 @@
+package cmds
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"iptv/internal/app/iptv"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// epgFileName 缺省的EPG文件名称，--output为目录时使用
+const epgFileName = "epg.xml"
+
+var (
+	epgOutput    string
+	epgBackDay   int
+	epgSkipEmpty bool
+	epgSplit     int
+	epgDryRun    bool
+	epgProgId    bool
+
+	epgFavoritesFile string
+	epgErrorReport   string
+	epgAsOf          string
+	epgRegion        string
+)
+
+func NewEpgCLI() *cobra.Command {
+	epgCmd := &cobra.Command{
+		Use:   "epg",
+		Short: "获取所有频道的节目单，并生成XMLTV格式的EPG文件。",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// L()：获取全局logger
+			logger := zap.L()
+
+			// 校验配置文件
+			if err := conf.Validate(); err != nil {
+				return err
+			}
+			// 使用--region指定的节目单API接口
+			if err := conf.SetRegion(epgRegion); err != nil {
+				return err
+			}
+
+			// 模拟指定的日期获取节目单，用于调试跨天等问题
+			if epgAsOf != "" && conf.HWCTC != nil {
+				now, err := newAsOfClock(epgAsOf, time.Now)
+				if err != nil {
+					return err
+				}
+				conf.HWCTC.Now = now
+			}
+
+			// 创建IPTV客户端
+			i, err := conf.NewIPTVClient()
+			if err != nil {
+				return err
+			}
+
+			// 检查IPTV服务器的连通性
+			if conf.Precheck {
+				if err = iptv.CheckPortalReachable(cmd.Context(), conf.ServerHost, iptv.DefaultPrecheckTimeout); err != nil {
+					return err
+				}
+			}
+
+			// 获取频道列表及节目单列表，同时汇总获取节目单失败的频道
+			report := iptv.NewEPGErrorReport()
+			ctx := iptv.WithEPGErrorReport(cmd.Context(), report)
+			channels, chProgLists, err := getChannelProgramLists(ctx, i, epgFavoritesFile, conf.TvgIDField)
+			if err != nil {
+				return err
+			}
+
+			// 输出获取节目单失败的汇总信息
+			if err = printEPGErrorReport(cmd.OutOrStdout(), report); err != nil {
+				return err
+			}
+			if epgErrorReport != "" {
+				if err = writeEPGErrorReport(epgErrorReport, report); err != nil {
+					return err
+				}
+			}
+
+			// 仅输出各频道的节目数量，不写入文件
+			if epgDryRun {
+				epgChannels, err := writeEPGSummary(cmd.OutOrStdout(), channels, chProgLists)
+				if err != nil {
+					return err
+				}
+				if epgChannels == 0 {
+					return errors.New("no channels returned programmes")
+				}
+				return nil
+			}
+
+			// 转换为XMLTV格式，与channel命令生成的直播源一致，不输出台标
+			xmlEPG := iptv.GetXmlEPGData(chProgLists, epgBackDay, iptv.XmlEPGOptions{
+				SkipEmpty:  epgSkipEmpty,
+				Location:   conf.TimeLocation,
+				WithProgID: epgProgId,
+			})
+
+			// 获取EPG文件的路径，相对路径时在程序所在目录中创建
+			filePath, err := resolveEPGOutputPath(epgOutput)
+			if err != nil {
+				return err
+			}
+
+			// 按频道数量拆分为多个文件
+			parts := iptv.SplitXmlEPG(xmlEPG, epgSplit)
+			for i, part := range parts {
+				partFilePath := filePath
+				if len(parts) > 1 {
+					partFilePath = getPartFilePath(filePath, i+1)
+				}
+				if err = writeXmlEPGFile(partFilePath, part); err != nil {
+					logger.Error("Failed to write to file.", zap.String("file", partFilePath), zap.Error(err))
+					return err
+				}
+
+				logger.Sugar().Infof("A total of %d channels and %d programmes have been written to the file %s.",
+					len(part.Channels), len(part.Programmes), partFilePath)
+			}
+
+			return nil
+		},
+	}
+
+	epgCmd.Flags().StringVarP(&epgOutput, "output", "o", epgFileName, "生成的EPG文件路径，以.gz结尾时进行gzip压缩。为目录时在该目录中生成epg.xml，目录不存在时自动创建。")
+	epgCmd.Flags().IntVarP(&epgBackDay, "back-day", "b", 0, "保留过去几天的节目单，缺省为0表示不过滤。")
+	epgCmd.Flags().BoolVar(&epgSkipEmpty, "skip-empty", false, "是否跳过没有节目单的频道。缺省为false。")
+	epgCmd.Flags().IntVar(&epgSplit, "split", 0, "按频道数量拆分为多个EPG文件，e.g `epg.part1.xml.gz`。缺省为0表示不拆分。")
+
+	epgCmd.Flags().StringVar(&epgFavoritesFile, "favorites", "", "收藏的频道列表文件，与channel命令的--favorites相同，仅输出这些频道的节目单，使EPG与直播源保持一致。")
+	epgCmd.Flags().BoolVar(&epgProgId, "prog-id", false, "是否为每个节目输出由频道ID和开始时间组成的唯一id。缺省为false。")
+	epgCmd.Flags().BoolVar(&epgDryRun, "dry-run", false, "仅获取节目单并输出各频道的节目数量，不生成EPG文件。")
+	epgCmd.Flags().StringVar(&epgErrorReport, "error-report", "", "将获取节目单失败的频道按错误信息分组，以JSON格式写入该文件。")
+	epgCmd.Flags().StringVar(&epgRegion, "region", "", "请求节目单的API接口，即配置文件中hwctc.channelProgramAPI的别名，e.g `liveplay_30,gdhdpublic,vsp,StbEpg2023Group,defaulttrans2或playbill`。缺省使用配置文件。")
+	epgCmd.Flags().StringVar(&epgAsOf, "as-of", "", "调试用，模拟以指定日期（e.g 2024-11-22）作为当天获取节目单，仅影响节目单的查询日期。")
+
+	return epgCmd
+}
+
+// newAsOfClock 创建从指定日期开始计时的时钟，保留当前的时分秒，使时间可以继续流逝
+func newAsOfClock(asOf string, now func() time.Time) (func() time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", asOf, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as-of date %q: %w", asOf, err)
+	}
+
+	current := now()
+	start := time.Date(date.Year(), date.Month(), date.Day(), current.Hour(), current.Minute(), current.Second(), current.Nanosecond(), time.Local)
+	offset := start.Sub(current)
+	return func() time.Time {
+		return now().Add(offset)
+	}, nil
+}
+
+// getChannelProgramLists 获取频道列表及节目单列表，指定收藏列表时仅获取收藏频道的节目单
+func getChannelProgramLists(ctx context.Context, i iptv.Client, favoritesFile, tvgIDField string) ([]iptv.Channel, []iptv.ChannelProgramList, error) {
+	// 获取频道列表
+	channels, err := i.GetAllChannelList(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(channels) == 0 {
+		return nil, nil, errors.New("no channels found")
+	}
+
+	// 与直播源使用相同的收藏列表，使EPG与直播源保持一致
+	if favoritesFile != "" {
+		if channels, err = filterChannelsByFavorites(channels, favoritesFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 获取节目单列表
+	chProgLists, err := i.GetAllChannelProgramList(ctx, channels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 设置与直播源一致的tvg-id
+	iptv.SetChannelTvgID(channels, tvgIDField)
+	iptv.SetProgramListTvgID(chProgLists, channels)
+
+	return channels, chProgLists, nil
+}
+
+// writeEPGSummary 按频道顺序输出各频道的节目数量，返回有节目单的频道数量
+func writeEPGSummary(w io.Writer, channels []iptv.Channel, chProgLists []iptv.ChannelProgramList) (int, error) {
+	// 统计各频道的节目数量
+	progCountMap := make(map[string]int, len(chProgLists))
+	for _, chProgList := range chProgLists {
+		for _, dateProgram := range chProgList.DateProgramList {
+			progCountMap[chProgList.ChannelId] += len(dateProgram.ProgramList)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "CHANNEL ID\tCHANNEL NAME\tPROGRAMMES"); err != nil {
+		return 0, err
+	}
+	var epgChannels, programs int
+	for _, channel := range channels {
+		count := progCountMap[channel.ChannelID]
+		if count > 0 {
+			epgChannels++
+			programs += count
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%d\n", channel.ChannelID, channel.ChannelName, count); err != nil {
+			return 0, err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return 0, err
+	}
+
+	_, err := fmt.Fprintf(w, "%d of %d channels returned %d programmes.\n", epgChannels, len(channels), programs)
+	return epgChannels, err
+}
+
+// printEPGErrorReport 按错误信息分组输出获取节目单失败的频道，没有失败的频道时不输出
+func printEPGErrorReport(w io.Writer, report *iptv.EPGErrorReport) error {
+	if report.Len() == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "Failed to get the program list for %d channels:\n", report.Len()); err != nil {
+		return err
+	}
+	for _, group := range report.Groups() {
+		if _, err := fmt.Fprintf(w, "  [%d] %s\n      %s\n", len(group.Channels), group.Error, strings.Join(group.Channels, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEPGErrorReport 将获取节目单失败的汇总信息以JSON格式写入文件
+func writeEPGErrorReport(fPath string, report *iptv.EPGErrorReport) error {
+	data, err := json.MarshalIndent(report.Groups(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fPath, data, 0644)
+}
+
+// getPartFilePath 获取拆分后的EPG文件路径，e.g epg.xml.gz -> epg.part1.xml.gz
+func getPartFilePath(filePath string, part int) string {
+	partName := fmt.Sprintf(".part%d", part)
+	if pos := strings.LastIndex(filePath, ".xml"); pos >= 0 {
+		return filePath[:pos] + partName + filePath[pos:]
+	}
+	return filePath + partName
+}
+
+// resolveEPGOutputPath 获取EPG文件的绝对路径，并确保所在目录存在且可写
+// output为已存在的目录或以路径分隔符结尾时，在该目录中生成缺省名称的EPG文件
+func resolveEPGOutputPath(output string) (string, error) {
+	filePath, err := resolveOutputPath(output)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(filePath); (err == nil && info.IsDir()) ||
+		strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(filepath.Separator)) {
+		filePath = filepath.Join(filePath, epgFileName)
+	}
+
+	if err = ensureOutputDir(filepath.Dir(filePath)); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// writeXmlEPGFile 将xmltv写入文件，以.gz结尾时进行gzip压缩
+func writeXmlEPGFile(filePath string, xmlEPG *iptv.XmlEPG) error {
+	xmlData, err := xml.MarshalIndent(xmlEPG, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = file
+	var gzipWriter *gzip.Writer
+	if strings.HasSuffix(filePath, ".gz") {
+		gzipWriter = gzip.NewWriter(file)
+		w = gzipWriter
+	}
+
+	// 写入xml头及内容
+	if _, err = w.Write([]byte(xml.Header)); err == nil {
+		_, err = w.Write(xmlData)
+	}
+	// 显式关闭gzip及文件，避免刷新或关闭失败时生成不完整的文件却返回成功
+	if gzipWriter != nil {
+		err = errors.Join(err, gzipWriter.Close())
+	}
+	return errors.Join(err, file.Close())
+}
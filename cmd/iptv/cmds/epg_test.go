@@ -0,0 +1,175 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"iptv/internal/app/iptv"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteEPGSummary(t *testing.T) {
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1"},
+		{ChannelID: "2", ChannelName: "CCTV2"},
+		{ChannelID: "3", ChannelName: "CCTV3"},
+	}
+	chProgLists := []iptv.ChannelProgramList{
+		{
+			ChannelId: "1",
+			DateProgramList: []iptv.DateProgram{
+				{ProgramList: []iptv.Program{{ProgramName: "新闻"}, {ProgramName: "天气"}}},
+				{ProgramList: []iptv.Program{{ProgramName: "新闻"}}},
+			},
+		},
+		{ChannelId: "3", DateProgramList: []iptv.DateProgram{{}}},
+	}
+
+	var buf bytes.Buffer
+	epgChannels, err := writeEPGSummary(&buf, channels, chProgLists)
+	if err != nil {
+		t.Fatalf("writeEPGSummary() error = %v", err)
+	}
+	if epgChannels != 1 {
+		t.Errorf("epgChannels = %d, want 1", epgChannels)
+	}
+
+	want := "CHANNEL ID  CHANNEL NAME  PROGRAMMES\n" +
+		"1           CCTV1         3\n" +
+		"2           CCTV2         0\n" +
+		"3           CCTV3         0\n" +
+		"1 of 3 channels returned 3 programmes.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeEPGSummary() output =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteEPGSummaryEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	epgChannels, err := writeEPGSummary(&buf, []iptv.Channel{{ChannelID: "1", ChannelName: "CCTV1"}}, nil)
+	if err != nil {
+		t.Fatalf("writeEPGSummary() error = %v", err)
+	}
+	if epgChannels != 0 {
+		t.Errorf("epgChannels = %d, want 0", epgChannels)
+	}
+}
+
+// fakeEPGClient 用于测试的IPTV客户端，按请求的频道返回节目单
+type fakeEPGClient struct {
+	channels []iptv.Channel
+}
+
+func (c *fakeEPGClient) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error) {
+	return slices.Clone(c.channels), nil
+}
+
+func (c *fakeEPGClient) GetAllChannelProgramList(ctx context.Context, channels []iptv.Channel) ([]iptv.ChannelProgramList, error) {
+	chProgLists := make([]iptv.ChannelProgramList, 0, len(channels))
+	for _, channel := range channels {
+		chProgLists = append(chProgLists, iptv.ChannelProgramList{
+			ChannelId:   channel.ChannelID,
+			ChannelName: channel.ChannelName,
+			DateProgramList: []iptv.DateProgram{
+				{Date: time.Now(), ProgramList: []iptv.Program{{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"}}},
+			},
+		})
+	}
+	return chProgLists, nil
+}
+
+func TestGetChannelProgramListsFavorites(t *testing.T) {
+	u, _ := url.Parse("igmp://239.1.1.1:5000")
+	client := &fakeEPGClient{channels: []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", UserChannelID: "1", ChannelURLs: []url.URL{*u}, GroupName: "央视"},
+		{ChannelID: "2", ChannelName: "CCTV2", UserChannelID: "2", ChannelURLs: []url.URL{*u}, GroupName: "央视"},
+		{ChannelID: "3", ChannelName: "湖南卫视", UserChannelID: "3", ChannelURLs: []url.URL{*u}, GroupName: "卫视"},
+	}}
+
+	favoritesFile := filepath.Join(t.TempDir(), "favorites.txt")
+	if err := os.WriteFile(favoritesFile, []byte("湖南卫视\n1\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	// 直播源与EPG使用相同的收藏列表
+	playlistChannels, err := filterChannelsByFavorites(slices.Clone(client.channels), favoritesFile)
+	if err != nil {
+		t.Fatalf("filterChannelsByFavorites() error = %v", err)
+	}
+	iptv.SetChannelTvgID(playlistChannels, iptv.TvgIDFieldChannelName)
+
+	channels, chProgLists, err := getChannelProgramLists(context.Background(), client, favoritesFile, iptv.TvgIDFieldChannelName)
+	if err != nil {
+		t.Fatalf("getChannelProgramLists() error = %v", err)
+	}
+	if len(channels) != len(playlistChannels) {
+		t.Fatalf("len(channels) = %d, want %d", len(channels), len(playlistChannels))
+	}
+
+	xmlEPG := iptv.GetXmlEPGData(chProgLists, 0, iptv.XmlEPGOptions{})
+	if len(xmlEPG.Channels) != len(playlistChannels) {
+		t.Fatalf("len(xmlEPG.Channels) = %d, want %d", len(xmlEPG.Channels), len(playlistChannels))
+	}
+	for i, channel := range playlistChannels {
+		if xmlEPG.Channels[i].Id != channel.GetTvgID() {
+			t.Errorf("xmlEPG.Channels[%d].Id = %q, want %q", i, xmlEPG.Channels[i].Id, channel.GetTvgID())
+		}
+	}
+
+	// 未指定收藏列表时获取所有频道的节目单
+	_, chProgLists, err = getChannelProgramLists(context.Background(), client, "", iptv.TvgIDFieldChannelID)
+	if err != nil {
+		t.Fatalf("getChannelProgramLists() error = %v", err)
+	}
+	if len(chProgLists) != 3 {
+		t.Errorf("len(chProgLists) = %d, want 3", len(chProgLists))
+	}
+}
+
+func TestNewAsOfClock(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 11, 22, 10, 30, 0, 0, time.Local) }
+	clock, err := newAsOfClock("2024-03-01", now)
+	if err != nil {
+		t.Fatalf("newAsOfClock() error = %v", err)
+	}
+	if got, want := clock(), time.Date(2024, 3, 1, 10, 30, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("clock() = %v, want %v", got, want)
+	}
+
+	if _, err = newAsOfClock("20240301", now); err == nil {
+		t.Error("newAsOfClock() error = nil, want error for invalid date")
+	}
+}
+
+func TestResolveEPGOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "file", output: filepath.Join(dir, "epg.xml.gz"), want: filepath.Join(dir, "epg.xml.gz")},
+		{name: "existing_dir", output: dir, want: filepath.Join(dir, epgFileName)},
+		{name: "new_dir", output: filepath.Join(dir, "data") + "/", want: filepath.Join(dir, "data", epgFileName)},
+		{name: "new_parent", output: filepath.Join(dir, "out", "e.xml"), want: filepath.Join(dir, "out", "e.xml")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveEPGOutputPath(tt.output)
+			if err != nil {
+				t.Fatalf("resolveEPGOutputPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveEPGOutputPath() = %q, want %q", got, tt.want)
+			}
+			if info, err := os.Stat(filepath.Dir(got)); err != nil || !info.IsDir() {
+				t.Errorf("output directory not created: %v", err)
+			}
+		})
+	}
+}
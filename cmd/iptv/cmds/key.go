@@ -1,21 +1,63 @@
 package cmds
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"iptv/internal/app/iptv"
 	"iptv/internal/pkg/util"
 	"os"
 	"path"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
-const keyFileName = "key.txt"
+const (
+	keyFileName         = "key.txt"
+	keyProgressFileName = "key.progress" // 破解进度的保存文件，记录下一个待尝试的序号
 
-var authenticator string
+	defaultKeyCharset   = "0123456789" // 缺省的密钥字符集，即八位数字
+	defaultKeyLength    = 8            // 缺省的密钥长度
+	maxKeyLength        = 24           // 3DES密钥的最大长度，超出部分会被截断
+	maxKeySearchSpace   = 1 << 40      // 允许的最大组合数量，避免搜索范围过大或溢出
+	keyProgressInterval = 500000       // 每尝试该次数输出一次进度并保存
+)
+
+var (
+	authenticator  string
+	keyStart       int64
+	keyResume      bool
+	keyWorkers     int
+	keyStopOnFirst bool
+	keyCharset     string
+	keyLength      int
+)
+
+// keyResult 破解得到的密钥及解密后的内容
+type keyResult struct {
+	key         string   // 密钥
+	decodedText string   // 解密后的明文
+	infos       []string // 按$拆分后的明文字段
+	index       int64    // 密钥的序号
+}
+
+// keySearch 密钥的并行破解任务，按序号块分发给多个goroutine
+// 密钥由charset中的字符组成，组合按序号排列，序号的各位即为字符在charset中的位置
+type keySearch struct {
+	authenticator string
+	charset       []rune // 密钥的字符集
+	length        int    // 密钥的长度
+	start         int64  // 起始序号（含）
+	end           int64  // 结束序号（不含）
+	blockSize     int64  // 每个序号块的大小，同时也是进度的保存间隔
+	workers       int    // 并行的goroutine数量
+	stopOnFirst   bool   // 找到第一个密钥后是否停止所有goroutine
+}
 
 func NewKeyCLI() *cobra.Command {
 	keyCmd := &cobra.Command{
@@ -27,59 +69,105 @@ func NewKeyCLI() *cobra.Command {
 				return errors.New("invalid authenticator")
 			}
 
+			// 校验3DES的加解密是否正常
+			if err := iptv.SelfTestCrypto(); err != nil {
+				return err
+			}
+
+			// L()：获取全局logger
+			logger := zap.L()
+
 			// 获取当前目录
 			currDir, err := util.GetCurrentAbPathByExecutable()
 			if err != nil {
 				return err
 			}
-			// 将结果写入文件
+			progressPath := path.Join(currDir, keyProgressFileName)
+
+			// 从保存的进度继续破解
+			start := keyStart
+			if keyResume {
+				progress, err := readKeyProgress(progressPath)
+				switch {
+				case err == nil:
+					start = progress
+				case errors.Is(err, os.ErrNotExist):
+					logger.Warn("The progress file does not exist. Start from the specified number.", zap.String("file", progressPath), zap.Int64("start", start))
+				default:
+					return err
+				}
+			}
+			// 计算字符集及长度对应的组合数量
+			charset := []rune(keyCharset)
+			total, err := getKeySearchSpace(charset, keyLength)
+			if err != nil {
+				return err
+			}
+			if start < 0 || start >= total {
+				return fmt.Errorf("invalid start: %d", start)
+			}
+			if keyWorkers < 1 {
+				keyWorkers = 1
+			}
+
+			// 将结果写入文件，继续破解时追加在已有结果的后面
 			filePath := path.Join(currDir, keyFileName)
-			file, err := os.Create(filePath)
+			flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if keyResume || start > 0 {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			file, err := os.OpenFile(filePath, flag, 0644)
 			if err != nil {
 				return err
 			}
 			defer file.Close()
 
-			// L()：获取全局logger
-			logger := zap.L()
-
 			var keys []string
-			logger.Info("Start testing 00000000-99999999 all eight digits.")
-			// 暴力破解从 00000000 到 99999999 的所有八位数字
-			for x := 0; x < 100000000; x++ {
-				key := fmt.Sprintf("%08d", x)
-
-				// 每尝试 500,000 次输出一次进度
-				if x%500000 == 0 {
-					logger.Sugar().Infof("Tried to: -- %s --", key)
-				}
-
-				// 创建 3DES 解密器
-				crypto := iptv.NewTripleDESCrypto(key)
-
-				// 尝试解密 Authenticator
-				decodedText, err := crypto.ECBDecrypt(authenticator)
-				if err != nil {
-					continue
-				}
-
-				// 解析解密后的文本
-				infos := strings.Split(decodedText, "$")
-				if len(infos) <= 7 {
-					continue
+			search := &keySearch{
+				authenticator: authenticator,
+				charset:       charset,
+				length:        keyLength,
+				start:         start,
+				end:           total,
+				blockSize:     keyProgressInterval,
+				workers:       keyWorkers,
+				stopOnFirst:   keyStopOnFirst,
+			}
+			// 暴力破解字符集在指定长度下的所有组合，缺省为 00000000 到 99999999 的所有八位数字
+			logger.Sugar().Infof("Start testing %s-%s, a total of %d keys with %d workers.",
+				search.keyAt(start), search.keyAt(total-1), total-start, keyWorkers)
+			finished, err := search.run(cmd.Context(), func(next int64) {
+				// 每完成 500,000 次尝试输出一次进度，并保存进度
+				logger.Sugar().Infof("Tried to: -- %s --", search.keyAt(min(next, total-1)))
+				if err := writeKeyProgress(progressPath, next); err != nil {
+					logger.Warn("Failed to save the progress.", zap.String("file", progressPath), zap.Error(err))
 				}
-
+			}, func(result keyResult) error {
 				// 写入文件
+				infos := result.infos
 				var infoText = fmt.Sprintf("  Random: %s\n  EncryptToken: %s\n  UserID: %s\n  STBID: %s\n  IP: %s\n  MAC: %s\n  Reserved: %s\n  CTC: %s",
 					infos[0], infos[1], infos[2], infos[3], infos[4], infos[5], infos[6], infos[7])
-				line := fmt.Sprintf("Find key: %s, Plaintext: %s\nDetails:\n%s\n\n", key, decodedText, infoText)
-				logger.Info("Find a key.", zap.String("key", key))
-				if _, err = file.WriteString(line); err != nil {
+				line := fmt.Sprintf("Find key: %s, Plaintext: %s\nDetails:\n%s\n\n", result.key, result.decodedText, infoText)
+				logger.Info("Find a key.", zap.String("key", result.key))
+				if _, err := file.WriteString(line); err != nil {
 					logger.Error("Failed to write to file.", zap.Error(err))
 					return err
 				}
 
-				keys = append(keys, key)
+				keys = append(keys, result.key)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !finished {
+				logger.Sugar().Infof("Stopped after the first key was found, see file: %s. Use --resume to continue.", keyFileName)
+				return nil
+			}
+
+			// 破解完成后删除进度文件
+			if err = os.Remove(progressPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warn("Failed to remove the progress file.", zap.String("file", progressPath), zap.Error(err))
 			}
 
 			logger.Sugar().Infof("Crack complete! A total of %d keys were found, see file: %s.", len(keys), keyFileName)
@@ -88,9 +176,189 @@ func NewKeyCLI() *cobra.Command {
 	}
 
 	keyCmd.Flags().StringVarP(&authenticator, "authenticator", "a", "", "请输入Authenticator值，可通过抓包获取。")
+	keyCmd.Flags().Int64Var(&keyStart, "start", 0, "从指定的序号开始破解，用于中断后继续，数字字符集时即为密钥本身。缺省为0。")
+	keyCmd.Flags().BoolVar(&keyResume, "resume", false, "是否从key.progress文件中保存的进度继续破解，结果追加写入key.txt。缺省为false。")
+	keyCmd.Flags().IntVar(&keyWorkers, "workers", runtime.NumCPU(), "并行破解的goroutine数量，缺省为CPU核数。")
+	keyCmd.Flags().StringVar(&keyCharset, "charset", defaultKeyCharset, "密钥的字符集，将尝试该字符集在指定长度下的所有组合。缺省为0123456789。")
+	keyCmd.Flags().IntVar(&keyLength, "length", defaultKeyLength, "密钥的长度。缺省为8。")
+	keyCmd.Flags().BoolVar(&keyStopOnFirst, "stop-on-first", false, "是否在找到第一个密钥后停止破解。缺省为false，尝试所有组合。")
 
 	// 必填参数
 	_ = keyCmd.MarkFlagRequired("authenticator")
 
 	return keyCmd
 }
+
+// run 并行尝试所有组合，找到的密钥依次回调onFound，已连续完成的序号块推进时回调onProgress
+// 两个回调均在调用方的goroutine中执行，无需加锁；返回是否已尝试完所有组合
+// 找到第一个密钥即停止时，进度推进到该密钥的下一个序号
+func (s *keySearch) run(ctx context.Context, onProgress func(next int64), onFound func(result keyResult) error) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// 分发待尝试的序号块
+	blocks := make(chan int64)
+	go func() {
+		defer close(blocks)
+		for blockStart := s.start; blockStart < s.end; blockStart += s.blockSize {
+			select {
+			case blocks <- blockStart:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make(chan keyResult)
+	doneBlocks := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for blockStart := range blocks {
+				blockEnd := min(blockStart+s.blockSize, s.end)
+				for x := blockStart; x < blockEnd; x++ {
+					if ctx.Err() != nil {
+						return
+					}
+					result, ok := tryKey(s.authenticator, s.keyAt(x))
+					if !ok {
+						continue
+					}
+					result.index = x
+					select {
+					case results <- result:
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case doneBlocks <- blockStart:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+	defer func() {
+		cancel()
+		<-workersDone
+	}()
+
+	// 汇总各goroutine的进度，仅当之前的序号块均已完成时才推进，保证中断后继续时不遗漏
+	next := s.start
+	completed := make(map[int64]bool)
+	for {
+		select {
+		case result := <-results:
+			if err := onFound(result); err != nil {
+				return false, err
+			}
+			if s.stopOnFirst {
+				// 进度推进到该密钥之后，继续破解时不再重复找到同一个密钥
+				onProgress(result.index + 1)
+				return false, nil
+			}
+		case blockStart := <-doneBlocks:
+			completed[blockStart] = true
+			prev := next
+			for completed[next] {
+				delete(completed, next)
+				next = min(next+s.blockSize, s.end)
+			}
+			if next != prev {
+				onProgress(next)
+			}
+		case <-workersDone:
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+}
+
+// keyAt 获取指定序号对应的密钥，数字字符集时与%0Nd的格式化结果一致
+func (s *keySearch) keyAt(index int64) string {
+	key := make([]rune, s.length)
+	base := int64(len(s.charset))
+	for i := s.length - 1; i >= 0; i-- {
+		key[i] = s.charset[index%base]
+		index /= base
+	}
+	return string(key)
+}
+
+// getKeySearchSpace 校验字符集及密钥长度，并返回所有组合的数量
+func getKeySearchSpace(charset []rune, length int) (int64, error) {
+	if len(charset) == 0 {
+		return 0, errors.New("charset is empty")
+	}
+	seen := make(map[rune]bool, len(charset))
+	for _, r := range charset {
+		if seen[r] {
+			return 0, fmt.Errorf("duplicate character in charset: %q", r)
+		}
+		seen[r] = true
+	}
+	if length <= 0 || length > maxKeyLength {
+		return 0, fmt.Errorf("invalid key length: %d, must be between 1 and %d", length, maxKeyLength)
+	}
+
+	base := int64(len(charset))
+	total := int64(1)
+	for i := 0; i < length; i++ {
+		if total > maxKeySearchSpace/base {
+			return 0, fmt.Errorf("too many combinations for %d characters of length %d, the limit is %d", len(charset), length, int64(maxKeySearchSpace))
+		}
+		total *= base
+	}
+	return total, nil
+}
+
+// tryKey 使用指定的密钥尝试解密Authenticator，解密成功且明文格式正确时返回结果
+func tryKey(authenticator, key string) (keyResult, bool) {
+	// 创建 3DES 解密器
+	crypto := iptv.NewTripleDESCrypto(key)
+
+	// 尝试解密 Authenticator
+	decodedText, err := crypto.ECBDecrypt(authenticator)
+	if err != nil {
+		return keyResult{}, false
+	}
+
+	// 解析解密后的文本
+	infos := strings.Split(decodedText, "$")
+	if len(infos) <= 7 {
+		return keyResult{}, false
+	}
+	return keyResult{key: key, decodedText: decodedText, infos: infos}, true
+}
+
+// readKeyProgress 读取保存的破解进度
+func readKeyProgress(fPath string) (int64, error) {
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return 0, err
+	}
+
+	progress, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid progress file %s: %w", fPath, err)
+	}
+	return progress, nil
+}
+
+// writeKeyProgress 保存破解进度，先写入临时文件再重命名，避免中断时文件内容不完整
+func writeKeyProgress(fPath string, progress int64) error {
+	tmpPath := fPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(progress, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fPath)
+}
@@ -0,0 +1,180 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"iptv/internal/app/iptv"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKeyProgress(t *testing.T) {
+	fPath := filepath.Join(t.TempDir(), keyProgressFileName)
+
+	if _, err := readKeyProgress(fPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("readKeyProgress() error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	if err := writeKeyProgress(fPath, 1500000); err != nil {
+		t.Fatalf("writeKeyProgress() error = %v", err)
+	}
+	progress, err := readKeyProgress(fPath)
+	if err != nil {
+		t.Fatalf("readKeyProgress() error = %v", err)
+	}
+	if progress != 1500000 {
+		t.Errorf("progress = %d, want 1500000", progress)
+	}
+
+	if err = os.WriteFile(fPath, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readKeyProgress(fPath); err == nil {
+		t.Error("readKeyProgress() error = nil, want error for invalid content")
+	}
+}
+
+func TestKeySearchRun(t *testing.T) {
+	authenticator, err := iptv.NewTripleDESCrypto("00000042").ECBEncrypt("99999$token$user$stb$10.0.0.2$00:11:22:33:44:55$$CTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		stopOnFirst  bool
+		wantFinished bool
+	}{
+		{name: "all", wantFinished: true},
+		{name: "stop_on_first", stopOnFirst: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := &keySearch{authenticator: authenticator, charset: []rune(defaultKeyCharset), length: defaultKeyLength,
+				start: 5, end: 100, blockSize: 10, workers: 4, stopOnFirst: tt.stopOnFirst}
+			var progress []int64
+			var keys []string
+			finished, err := search.run(context.Background(), func(next int64) {
+				progress = append(progress, next)
+			}, func(result keyResult) error {
+				keys = append(keys, result.key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if finished != tt.wantFinished {
+				t.Errorf("finished = %v, want %v", finished, tt.wantFinished)
+			}
+
+			// DES忽略每个字节的最低位，因此与00000042等价的密钥也会被找到
+			equivalentKeys := []string{"00000042", "00000043", "00000052", "00000053"}
+			if tt.stopOnFirst {
+				if len(keys) != 1 || !slices.Contains(equivalentKeys, keys[0]) {
+					t.Errorf("keys = %v, want one of %v", keys, equivalentKeys)
+				}
+				return
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, equivalentKeys) {
+				t.Errorf("keys = %v, want %v", keys, equivalentKeys)
+			}
+			if !slices.IsSorted(progress) || len(progress) == 0 || progress[len(progress)-1] != 100 {
+				t.Errorf("progress = %v, want ascending and ending with 100", progress)
+			}
+		})
+	}
+}
+
+func TestKeySearchStopAndResume(t *testing.T) {
+	authenticator, err := iptv.NewTripleDESCrypto("00000042").ECBEncrypt("99999$token$user$stb$10.0.0.2$00:11:22:33:44:55$$CTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次找到密钥后停止，再从保存的进度继续，直到尝试完所有组合
+	var keys []string
+	start := int64(0)
+	for range 10 {
+		search := &keySearch{authenticator: authenticator, charset: []rune(defaultKeyCharset), length: defaultKeyLength,
+			start: start, end: 100, blockSize: 10, workers: 1, stopOnFirst: true}
+		finished, err := search.run(context.Background(), func(next int64) {
+			start = next
+		}, func(result keyResult) error {
+			keys = append(keys, result.key)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if finished {
+			break
+		}
+	}
+
+	equivalentKeys := []string{"00000042", "00000043", "00000052", "00000053"}
+	if !slices.Equal(keys, equivalentKeys) {
+		t.Errorf("keys = %v, want %v", keys, equivalentKeys)
+	}
+	if start != 100 {
+		t.Errorf("progress = %d, want 100", start)
+	}
+}
+
+func TestKeySearchKeyAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		length  int
+		index   int64
+		want    string
+	}{
+		{name: "numeric_first", charset: defaultKeyCharset, length: defaultKeyLength, index: 0, want: "00000000"},
+		{name: "numeric", charset: defaultKeyCharset, length: defaultKeyLength, index: 12345678, want: "12345678"},
+		{name: "numeric_last", charset: defaultKeyCharset, length: defaultKeyLength, index: 99999999, want: "99999999"},
+		{name: "hex", charset: "0123456789abcdef", length: 4, index: 0xbeef, want: "beef"},
+		{name: "letters", charset: "ABC", length: 3, index: 5, want: "ABC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := &keySearch{charset: []rune(tt.charset), length: tt.length}
+			if got := search.keyAt(tt.index); got != tt.want {
+				t.Errorf("keyAt(%d) = %q, want %q", tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetKeySearchSpace(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		length  int
+		want    int64
+		wantErr bool
+	}{
+		{name: "numeric", charset: defaultKeyCharset, length: defaultKeyLength, want: 100000000},
+		{name: "hex", charset: "0123456789abcdef", length: 6, want: 1 << 24},
+		{name: "empty_charset", charset: "", length: 8, wantErr: true},
+		{name: "duplicate", charset: "0120", length: 8, wantErr: true},
+		{name: "invalid_length", charset: defaultKeyCharset, length: 0, wantErr: true},
+		{name: "too_long", charset: defaultKeyCharset, length: maxKeyLength + 1, wantErr: true},
+		{name: "too_many", charset: "0123456789abcdefghijklmnopqrstuvwxyz", length: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getKeySearchSpace([]rune(tt.charset), tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getKeySearchSpace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getKeySearchSpace() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 var (
 	cfgFile string
+	// 实际读取的配置文件路径
+	cfgPath string
 
 	conf *config.Config
 )
@@ -32,6 +34,8 @@ func NewRootCLI() *cobra.Command {
 
 	rootCmd.AddCommand(NewKeyCLI())
 	rootCmd.AddCommand(NewChannelCLI())
+	rootCmd.AddCommand(NewEpgCLI())
+	rootCmd.AddCommand(NewCatchupPreviewCLI())
 	rootCmd.AddCommand(NewServeCLI())
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "YAML配置文件的路径")
 
@@ -60,6 +64,7 @@ func initConfig() {
 	}
 
 	// 读取配置文件
+	cfgPath = fPath
 	conf, err = config.Load(fPath)
 	cobra.CheckErr(err)
 }
@@ -1,12 +1,18 @@
 package cmds
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iptv/internal/app/config"
+	"iptv/internal/app/iptv"
 	"iptv/internal/app/router"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -16,10 +22,28 @@ import (
 var httpConfig HttpConfig
 
 type HttpConfig struct {
-	Port     int           `json:"port"`
-	UdpxyURL string        `json:"udpxyURL"`
-	Interval time.Duration `json:"interval"`
-	LiveFile string        `json:"liveFile"`
+	Port      int           `json:"port"`
+	UdpxyURL  string        `json:"udpxyURL"`
+	Interval  time.Duration `json:"interval"`
+	ChCron    string        `json:"chCron"`
+	EPGCron   string        `json:"epgCron"`
+	LiveFile  string        `json:"liveFile"`
+	Prerender []string      `json:"prerender"`
+
+	ReadTimeout  time.Duration `json:"readTimeout"`  // 读取请求的超时时间
+	WriteTimeout time.Duration `json:"writeTimeout"` // 写入响应的超时时间，需满足较大EPG内容的传输
+	IdleTimeout  time.Duration `json:"idleTimeout"`  // 保持连接的空闲超时时间
+}
+
+// newHTTPServer 根据配置创建HTTP服务，设置读写及空闲的超时时间，避免慢速客户端长期占用连接
+func newHTTPServer(handler http.Handler, cfg HttpConfig) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
 }
 
 func NewServeCLI() *cobra.Command {
@@ -27,6 +51,11 @@ func NewServeCLI() *cobra.Command {
 		Use:   "serve",
 		Short: "启动HTTP服务，提供直播源、EPG等查询接口。",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// 校验3DES的加解密是否正常，避免生成错误的Authenticator
+			if err := iptv.SelfTestCrypto(); err != nil {
+				return err
+			}
+
 			// 读取直播配置
 			if httpConfig.LiveFile != "" {
 				content, err := os.ReadFile(httpConfig.LiveFile)
@@ -50,14 +79,22 @@ func NewServeCLI() *cobra.Command {
 			}
 
 			// 创建并启动HTTP服务
-			r, err := router.NewEngine(cmd.Context(), conf, httpConfig.Interval, httpConfig.UdpxyURL)
+			r, err := router.NewEngine(cmd.Context(), conf, router.ScheduleConfig{
+				Interval:    httpConfig.Interval,
+				ChannelCron: httpConfig.ChCron,
+				EPGCron:     httpConfig.EPGCron,
+			}, httpConfig.UdpxyURL, httpConfig.Prerender)
 			if err != nil {
 				return err
 			}
 			// L()：获取全局logger
 			logger := zap.L()
+
+			// 收到SIGHUP信号时，重新加载配置文件中的频道规则
+			go reloadChannelRulesOnSignal(cmd.Context(), logger)
+
 			logger.Info("Start the http service.", zap.String("port", strconv.Itoa(httpConfig.Port)))
-			if err = r.Run(fmt.Sprintf(":%d", httpConfig.Port)); err != nil {
+			if err = newHTTPServer(r, httpConfig).ListenAndServe(); err != nil {
 				return err
 			}
 
@@ -68,7 +105,35 @@ func NewServeCLI() *cobra.Command {
 	serveCmd.Flags().IntVarP(&httpConfig.Port, "port", "p", 8080, "HTTP服务的监听端口。")
 	serveCmd.Flags().StringVarP(&httpConfig.UdpxyURL, "udpxy", "u", "", "如果有安装udpxy进行组播转单播，则请配置HTTP地址。支持同时配置内外网对应的多个udpxy的地址。e.g `http://192.168.1.1:4022或inner=http://192.168.1.1:4022,outer=http://udpxy.iptv.com:4022`。")
 	serveCmd.Flags().DurationVarP(&httpConfig.Interval, "interval", "i", 24*time.Hour, "自动刷新频道列表和节目单的间隔时间，e.g `24h或15m`。")
+	serveCmd.Flags().StringVar(&httpConfig.ChCron, "channel-cron", "", "刷新频道列表的cron表达式，配置后替代interval，e.g `0 */6 * * *`。")
+	serveCmd.Flags().StringVar(&httpConfig.EPGCron, "epg-cron", "", "刷新节目单的cron表达式，配置后替代interval，e.g `0 4 * * *`。")
 	serveCmd.Flags().StringVarP(&httpConfig.LiveFile, "livefile", "l", "", "加载FongMi的直播配置json文件，并提供查询接口。")
+	serveCmd.Flags().StringSliceVar(&httpConfig.Prerender, "prerender", nil, "每次刷新频道列表后，预先生成并缓存指定格式的直播源（仅对未携带请求参数的查询生效），e.g `m3u,txt,pls`。")
+	serveCmd.Flags().DurationVar(&httpConfig.ReadTimeout, "read-timeout", 30*time.Second, "读取HTTP请求的超时时间，0表示不限制。")
+	serveCmd.Flags().DurationVar(&httpConfig.WriteTimeout, "write-timeout", 5*time.Minute, "写入HTTP响应的超时时间，0表示不限制。EPG内容较大时，请适当调大。")
+	serveCmd.Flags().DurationVar(&httpConfig.IdleTimeout, "idle-timeout", 2*time.Minute, "HTTP连接保持的空闲超时时间，0表示使用读取请求的超时时间。")
 
 	return serveCmd
 }
+
+// reloadChannelRulesOnSignal 收到SIGHUP信号时，重新读取配置文件，并对缓存的频道列表重新应用频道规则
+func reloadChannelRulesOnSignal(ctx context.Context, logger *zap.Logger) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			newConf, err := config.Load(cfgPath)
+			if err == nil {
+				err = router.ReloadChannelRules(newConf)
+			}
+			if err != nil {
+				logger.Error("Failed to reload the channel rules.", zap.String("config", cfgPath), zap.Error(err))
+			}
+		}
+	}
+}
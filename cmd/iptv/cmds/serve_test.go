@@ -0,0 +1,27 @@
+package cmds
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	handler := http.NewServeMux()
+	srv := newHTTPServer(handler, HttpConfig{
+		Port:         8081,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Minute,
+		IdleTimeout:  time.Minute,
+	})
+
+	if srv.Addr != ":8081" {
+		t.Errorf("Addr = %q, want :8081", srv.Addr)
+	}
+	if srv.Handler != handler {
+		t.Error("Handler is not the given handler")
+	}
+	if srv.ReadTimeout != 10*time.Second || srv.WriteTimeout != 10*time.Minute || srv.IdleTimeout != time.Minute {
+		t.Errorf("timeouts = %s, %s, %s, want 10s, 10m0s, 1m0s", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
@@ -2,15 +2,30 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"iptv/internal/app/iptv"
 	"iptv/internal/app/iptv/hwctc"
+	"net/http"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
 
+// ProviderHWCTC hw平台（华为电信/联通）
+const ProviderHWCTC = "hwctc"
+
+// iptvProviders 支持的IPTV平台及创建客户端的函数，新增平台时在此注册
+var iptvProviders = map[string]func(c *Config) (iptv.Client, error){
+	ProviderHWCTC: func(c *Config) (iptv.Client, error) {
+		return hwctc.NewClient(c.NewHTTPClient(10*time.Second), c.HWCTC, c.Key, c.ServerHost, c.Headers,
+			c.ChExcludeRule, c.ChGroupRulesList, c.ChLogoRuleList, c.ProgTitleRules)
+	},
+}
+
 type OptionChannelGroupRules struct {
 	Name  string   `json:"name" yaml:"name"`   // 分组名称
 	Rules []string `json:"rules" yaml:"rules"` // 分组规则
@@ -21,8 +36,94 @@ type OptionChannelLogoRule struct {
 	Rule string `json:"rule" yaml:"rule"` // 台标匹配规则
 }
 
+// RulesConfig 外部规则文件的内容（YAML或JSON格式），与主配置中的同名规则合并
+type RulesConfig struct {
+	ChExcludeRule string                    `json:"chExcludeRule" yaml:"chExcludeRule"` // 频道的过滤规则
+	ChGroupRules  []OptionChannelGroupRules `json:"chGroupRules" yaml:"chGroupRules"`   // 自定义频道分组规则
+	ChLogoRules   []OptionChannelLogoRule   `json:"logos" yaml:"logos"`                 // 自定义台标匹配规则
+}
+
+type OptionProgramTitleRule struct {
+	Rule    string `json:"rule" yaml:"rule"`       // 节目名称的匹配规则
+	Replace string `json:"replace" yaml:"replace"` // 替换内容，缺省为空即删除匹配的内容
+}
+
+type OptionChannelDRM struct {
+	Channel     string `json:"channel" yaml:"channel"`         // 频道名称或频道ID
+	LicenseType string `json:"licenseType" yaml:"licenseType"` // 授权类型
+	LicenseKey  string `json:"licenseKey" yaml:"licenseKey"`   // 授权密钥或授权服务器地址
+}
+
+type OptionGroupLocale struct {
+	Group    string `json:"group" yaml:"group"`       // 频道分组名称
+	Country  string `json:"country" yaml:"country"`   // 国家代码
+	Language string `json:"language" yaml:"language"` // 语言代码
+}
+
+type LocaleConfig struct {
+	Country  string              `json:"country" yaml:"country"`   // 全局的国家代码，e.g CN
+	Language string              `json:"language" yaml:"language"` // 全局的语言代码，e.g zh
+	Groups   []OptionGroupLocale `json:"groups" yaml:"groups"`     // 按频道分组覆盖全局配置
+}
+
+type ChannelSourceConfig struct {
+	Type string `json:"type" yaml:"type"`                     // 频道列表的来源类型，缺省从IPTV平台获取，可选：file
+	File string `json:"file,omitempty" yaml:"file,omitempty"` // 频道列表文件的路径（JSON格式），类型为file时必填
+}
+
+type GroupOrderConfig struct {
+	Groups   []string `json:"groups" yaml:"groups"`                         // 分组的输出顺序
+	Unlisted string   `json:"unlisted,omitempty" yaml:"unlisted,omitempty"` // 未列出的分组的处理方式（append或drop），缺省为append
+}
+
+type UserAgentPreset struct {
+	Match  string            `json:"match" yaml:"match"`   // User-Agent中包含的字符串，不区分大小写
+	Params map[string]string `json:"params" yaml:"params"` // 请求未携带对应参数时使用的缺省值，e.g csFormat
+}
+
 type CatchupConfig struct {
-	Sources map[string]string `json:"sources" yaml:"sources"` // 回看请求的参数
+	Sources map[string]string `json:"sources" yaml:"sources"`                     // 回看请求的参数
+	Default string            `json:"default,omitempty" yaml:"default,omitempty"` // 请求未指定csFormat时使用的回看参数名称
+
+	LiveFallback bool `json:"liveFallback,omitempty" yaml:"liveFallback,omitempty"` // 支持时移但没有时移地址的频道，是否使用单播直播地址进行回看
+
+	TimeBase string `json:"timeBase,omitempty" yaml:"timeBase,omitempty"` // 回看请求中时间占位符的时间基准（local或utc），缺省保持各参数的原有写法
+
+	Modes map[string]string `json:"modes,omitempty" yaml:"modes,omitempty"` // 覆盖flussonic、xdomo回看模式的模板，按模式名称作为回看参数名称输出
+}
+
+// defaultCatchupSources 缺省的回看请求参数，flussonic为flussonic模式使用的模板
+func defaultCatchupSources(flussonic string) map[string]string {
+	return map[string]string{
+		"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+		"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+		"5": flussonic,
+	}
+}
+
+// validateCatchupModes 校验回看模式的模板，不支持的模式忽略，缺少开始时间占位符的模板使用内置模板
+// 返回各模式最终使用的模板，没有内置模板且未配置的模式不包含在结果中
+func validateCatchupModes(modes map[string]string) map[string]string {
+	logger := zap.L()
+	result := map[string]string{iptv.CatchupModeFlussonic: iptv.DefaultCatchupModeSource(iptv.CatchupModeFlussonic)}
+	for mode, source := range modes {
+		switch mode {
+		case iptv.CatchupModeFlussonic, iptv.CatchupModeXdomo:
+		default:
+			logger.Warn("The catchup mode is not supported. Ignore it.", zap.String("mode", mode))
+			continue
+		}
+		if !iptv.HasCatchupTimePlaceholder(source) {
+			logger.Warn("The catchup mode template does not contain a start time placeholder. Use the built-in template.",
+				zap.String("mode", mode), zap.String("source", source))
+			continue
+		}
+		result[mode] = source
+	}
+	if result[iptv.CatchupModeXdomo] == "" {
+		delete(result, iptv.CatchupModeXdomo)
+	}
+	return result
 }
 
 type Config struct {
@@ -30,6 +131,16 @@ type Config struct {
 	ServerHost string            `json:"serverHost" yaml:"serverHost"` // 必填，HTTP请求的IPTV服务器地址端口
 	Headers    map[string]string `json:"headers" yaml:"headers"`       // 自定义HTTP请求头
 
+	MaxConnsPerHost     int `json:"maxConnsPerHost,omitempty" yaml:"maxConnsPerHost,omitempty"`         // 与IPTV服务器的最大连接数，缺省为0不限制
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty" yaml:"maxIdleConnsPerHost,omitempty"` // 与IPTV服务器的最大空闲连接数，缺省为0使用默认值
+
+	Precheck bool `json:"precheck,omitempty" yaml:"precheck,omitempty"` // 刷新数据前是否先检查IPTV服务器的连通性
+
+	OptionRetryEmptyChannels *bool `json:"retryEmptyChannels,omitempty" yaml:"retryEmptyChannels,omitempty"` // 获取到的频道列表为空时是否重试
+	RetryEmptyChannels       bool  `json:"-" yaml:"-"`                                                       // Validate()时进行填充
+
+	RulesFile string `json:"rulesFile,omitempty" yaml:"rulesFile,omitempty"` // 外部规则文件的路径，其中的过滤、分组及台标规则追加在主配置的规则之后
+
 	OptionChExcludeRule string         `json:"chExcludeRule" yaml:"chExcludeRule"` // 频道的过滤规则
 	ChExcludeRule       *regexp.Regexp `json:"-" yaml:"-"`                         // Validate()时进行填充
 
@@ -39,9 +150,61 @@ type Config struct {
 	OptionChLogoRuleList []OptionChannelLogoRule `json:"logos" yaml:"logos"` // 自定义台标匹配规则
 	ChLogoRuleList       []iptv.ChannelLogoRule  `json:"-" yaml:"-"`         // Validate()时进行填充
 
+	OptionProgTitleRules []OptionProgramTitleRule `json:"progTitleRules,omitempty" yaml:"progTitleRules,omitempty"` // 节目名称的清理规则
+	ProgTitleRules       []iptv.ProgramTitleRule  `json:"-" yaml:"-"`                                               // Validate()时进行填充
+
 	Catchup *CatchupConfig `json:"catchup" yaml:"catchup"` // 回看请求参数配置
 
-	HWCTC *hwctc.Config `json:"hwctc,omitempty" yaml:"hwctc,omitempty"` // hw平台相关设置
+	UserAgentPresets []UserAgentPreset `json:"userAgentPresets,omitempty" yaml:"userAgentPresets,omitempty"` // 按播放器的User-Agent设置m3u请求参数的缺省值
+
+	OptionChDRMList []OptionChannelDRM         `json:"drm,omitempty" yaml:"drm,omitempty"` // 自定义频道的DRM信息
+	ChDRMMap        map[string]iptv.ChannelDRM `json:"-" yaml:"-"`                         // Validate()时进行填充
+
+	Locale           *LocaleConfig                 `json:"locale,omitempty" yaml:"locale,omitempty"` // 频道的国家和语言配置（tvg-country、tvg-language）
+	ChDefaultLocale  iptv.ChannelLocale            `json:"-" yaml:"-"`                               // Validate()时进行填充
+	ChGroupLocaleMap map[string]iptv.ChannelLocale `json:"-" yaml:"-"`                               // Validate()时进行填充
+
+	ChDefaultGroup string `json:"chDefaultGroup,omitempty" yaml:"chDefaultGroup,omitempty"` // 没有分组的频道使用的分组名称，缺省为空保持不变
+
+	GroupOrder *GroupOrderConfig `json:"groupOrder,omitempty" yaml:"groupOrder,omitempty"` // 频道分组的输出顺序，缺省保持原有顺序
+
+	ChURLScheme string `json:"chUrlScheme,omitempty" yaml:"chUrlScheme,omitempty"` // 频道单播地址改写后的协议（http或https），缺省为空保持不变
+
+	ChRenumberDuplicates bool `json:"chRenumberDuplicates,omitempty" yaml:"chRenumberDuplicates,omitempty"` // 频道号重复时，是否自动重新编号
+
+	OptionChDedup *bool `json:"chDedup,omitempty" yaml:"chDedup,omitempty"` // 是否合并频道ID相同的频道
+	ChDedup       bool  `json:"-" yaml:"-"`                                 // Validate()时进行填充
+
+	ChLogoSanitize bool   `json:"logoSanitize,omitempty" yaml:"logoSanitize,omitempty"` // 是否将台标名称中的空白及特殊字符替换为下划线
+	LogoBaseURL    string `json:"logoBaseUrl,omitempty" yaml:"logoBaseUrl,omitempty"`   // 台标的外部访问地址，用于反向代理等场景，缺省使用请求的Host
+	LogoDir        string `json:"logoDir,omitempty" yaml:"logoDir,omitempty"`           // 台标文件所在的目录，缺省为程序所在目录下的logos目录
+
+	LogoPlaceholder bool `json:"logoPlaceholder,omitempty" yaml:"logoPlaceholder,omitempty"` // 台标文件不存在时，是否生成带有频道名称的占位台标
+
+	LogoFields []string `json:"logoFields,omitempty" yaml:"logoFields,omitempty"` // 查找台标文件时依次使用的频道字段，缺省仅使用台标名称
+
+	TvgIDField string `json:"tvgIdField,omitempty" yaml:"tvgIdField,omitempty"` // 输出tvg-id时使用的频道字段，m3u与xmltv保持一致
+
+	OptionExtInfDuration *int `json:"extinfDuration,omitempty" yaml:"extinfDuration,omitempty"` // m3u中#EXTINF的时长字段
+	ExtInfDuration       int  `json:"-" yaml:"-"`                                               // Validate()时进行填充
+
+	MaxCatchupDays     int  `json:"maxCatchupDays,omitempty" yaml:"maxCatchupDays,omitempty"`         // m3u中catchup-days的最大值，缺省为0不限制
+	CatchupDaysFromEPG bool `json:"catchupDaysFromEPG,omitempty" yaml:"catchupDaysFromEPG,omitempty"` // m3u中catchup-days是否不超过节目单实际覆盖的回看天数
+
+	M3UStrict bool `json:"m3uStrict,omitempty" yaml:"m3uStrict,omitempty"` // 生成m3u时，频道无法获取URL地址是否中止生成，缺省为false跳过该频道
+
+	OptionTrailingNewline *bool `json:"trailingNewline,omitempty" yaml:"trailingNewline,omitempty"` // 直播源内容末尾是否保留一个换行符
+	TrailingNewline       bool  `json:"-" yaml:"-"`                                                 // Validate()时进行填充
+
+	MulticastRelayPath string `json:"multicastRelayPath,omitempty" yaml:"multicastRelayPath,omitempty"` // 组播转单播的路径模板，缺省为udpxy的/rtp/${addr}:${port}
+
+	TimeZone     string         `json:"timeZone,omitempty" yaml:"timeZone,omitempty"` // 节目时间所在的时区，用于输出xmltv的时区偏移
+	TimeLocation *time.Location `json:"-" yaml:"-"`                                   // Validate()时进行填充
+
+	ChannelSource *ChannelSourceConfig `json:"channelSource,omitempty" yaml:"channelSource,omitempty"` // 自定义频道列表的来源
+
+	Provider string        `json:"provider,omitempty" yaml:"provider,omitempty"` // IPTV平台的名称，用于选择创建的客户端，缺省为hwctc
+	HWCTC    *hwctc.Config `json:"hwctc,omitempty" yaml:"hwctc,omitempty"`       // hw平台相关设置
 }
 
 func (c *Config) Validate() error {
@@ -54,6 +217,27 @@ func (c *Config) Validate() error {
 	// L()：获取全局logger
 	logger := zap.L()
 
+	// 校验HTTP连接数的限制
+	if c.MaxConnsPerHost < 0 {
+		logger.Warn("The max conns per host is incorrect. Use the default value: 0.", zap.Int("maxConnsPerHost", c.MaxConnsPerHost))
+		c.MaxConnsPerHost = 0
+	}
+	if c.MaxIdleConnsPerHost < 0 {
+		logger.Warn("The max idle conns per host is incorrect. Use the default value: 0.", zap.Int("maxIdleConnsPerHost", c.MaxIdleConnsPerHost))
+		c.MaxIdleConnsPerHost = 0
+	}
+
+	// 合并外部规则文件中的规则
+	if c.RulesFile != "" {
+		rules, err := LoadRules(c.RulesFile)
+		if err != nil {
+			return err
+		}
+		c.mergeRules(rules)
+		logger.Info("The rules file has been loaded.", zap.String("rulesFile", c.RulesFile),
+			zap.Int("chGroupRules", len(rules.ChGroupRules)), zap.Int("logos", len(rules.ChLogoRules)))
+	}
+
 	// 填充频道的过滤规则
 	if c.OptionChExcludeRule != "" {
 		rule, err := regexp.Compile(c.OptionChExcludeRule)
@@ -116,24 +300,309 @@ func (c *Config) Validate() error {
 		})
 	}
 
+	// 填充节目名称的清理规则
+	c.ProgTitleRules = make([]iptv.ProgramTitleRule, 0, len(c.OptionProgTitleRules))
+	for _, opProgTitleRule := range c.OptionProgTitleRules {
+		if opProgTitleRule.Rule == "" {
+			logger.Warn("The program title rule is empty. Skip it.")
+			continue
+		}
+
+		rule, err := regexp.Compile(opProgTitleRule.Rule)
+		if err != nil {
+			logger.Warn("The program title rule is incorrect. Skip it.", zap.String("rule", opProgTitleRule.Rule), zap.Error(err))
+			continue
+		}
+
+		c.ProgTitleRules = append(c.ProgTitleRules, iptv.ProgramTitleRule{
+			Rule:    rule,
+			Replace: opProgTitleRule.Replace,
+		})
+	}
+
+	// 填充频道的DRM信息
+	c.ChDRMMap = make(map[string]iptv.ChannelDRM, len(c.OptionChDRMList))
+	for _, opChDRM := range c.OptionChDRMList {
+		if opChDRM.Channel == "" || opChDRM.LicenseKey == "" {
+			logger.Warn("The channel DRM config is incomplete. Skip it.", zap.String("channel", opChDRM.Channel))
+			continue
+		}
+
+		c.ChDRMMap[opChDRM.Channel] = iptv.ChannelDRM{
+			LicenseType: opChDRM.LicenseType,
+			LicenseKey:  opChDRM.LicenseKey,
+		}
+	}
+
+	// 填充频道列表为空时是否重试，缺省为true
+	c.RetryEmptyChannels = c.OptionRetryEmptyChannels == nil || *c.OptionRetryEmptyChannels
+
+	// 校验播放器的预设参数
+	uaPresets := make([]UserAgentPreset, 0, len(c.UserAgentPresets))
+	for _, preset := range c.UserAgentPresets {
+		if strings.TrimSpace(preset.Match) == "" || len(preset.Params) == 0 {
+			logger.Warn("The user agent preset is incomplete. Skip it.", zap.String("match", preset.Match))
+			continue
+		}
+		uaPresets = append(uaPresets, preset)
+	}
+	c.UserAgentPresets = uaPresets
+
+	// 填充频道的国家和语言信息
+	c.ChDefaultLocale = iptv.ChannelLocale{}
+	c.ChGroupLocaleMap = make(map[string]iptv.ChannelLocale)
+	if c.Locale != nil {
+		c.ChDefaultLocale = iptv.ChannelLocale{
+			Country:  c.Locale.Country,
+			Language: c.Locale.Language,
+		}
+		for _, opGroupLocale := range c.Locale.Groups {
+			if opGroupLocale.Group == "" {
+				logger.Warn("The group name of the locale config is empty. Skip it.")
+				continue
+			}
+
+			c.ChGroupLocaleMap[opGroupLocale.Group] = iptv.ChannelLocale{
+				Country:  opGroupLocale.Country,
+				Language: opGroupLocale.Language,
+			}
+		}
+	}
+
+	// 校验tvg-id使用的频道字段
+	switch c.TvgIDField {
+	case "":
+		c.TvgIDField = iptv.TvgIDFieldChannelID
+	case iptv.TvgIDFieldChannelID, iptv.TvgIDFieldUserChannelID, iptv.TvgIDFieldChannelName, iptv.TvgIDFieldHash:
+	default:
+		logger.Warn("The tvg-id field is not supported. Use the default value: channelID.", zap.String("tvgIdField", c.TvgIDField))
+		c.TvgIDField = iptv.TvgIDFieldChannelID
+	}
+
+	// 校验查找台标文件时使用的频道字段
+	logoFields := make([]string, 0, len(c.LogoFields))
+	for _, field := range c.LogoFields {
+		switch field {
+		case iptv.LogoFieldLogoName, iptv.LogoFieldChannelID, iptv.LogoFieldChannelName:
+			logoFields = append(logoFields, field)
+		default:
+			logger.Warn("The logo field is not supported. Skip it.", zap.String("logoField", field))
+		}
+	}
+	c.LogoFields = logoFields
+
+	// 去除缺省分组名称的首尾空白
+	c.ChDefaultGroup = strings.TrimSpace(c.ChDefaultGroup)
+
+	// 校验频道分组的输出顺序
+	if c.GroupOrder == nil {
+		c.GroupOrder = &GroupOrderConfig{}
+	}
+	groups := make([]string, 0, len(c.GroupOrder.Groups))
+	for _, group := range c.GroupOrder.Groups {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	c.GroupOrder.Groups = groups
+	switch c.GroupOrder.Unlisted {
+	case iptv.GroupUnlistedAppend, iptv.GroupUnlistedDrop:
+	case "":
+		c.GroupOrder.Unlisted = iptv.GroupUnlistedAppend
+	default:
+		logger.Warn("The unlisted group mode is not supported. Use the default value: append.", zap.String("unlisted", c.GroupOrder.Unlisted))
+		c.GroupOrder.Unlisted = iptv.GroupUnlistedAppend
+	}
+
+	// 校验IPTV平台的名称
+	if c.Provider == "" {
+		c.Provider = ProviderHWCTC
+	} else if _, ok := iptvProviders[c.Provider]; !ok {
+		return fmt.Errorf("unsupported iptv provider: %q", c.Provider)
+	}
+
+	// 校验频道单播地址改写后的协议
+	switch c.ChURLScheme {
+	case "", iptv.URLSchemeHTTP, iptv.URLSchemeHTTPS:
+	default:
+		logger.Warn("The channel url scheme is not supported. Use the default value: keep unchanged.", zap.String("chUrlScheme", c.ChURLScheme))
+		c.ChURLScheme = ""
+	}
+
+	// 填充m3u中#EXTINF的时长字段，缺省为-1表示直播流
+	c.ExtInfDuration = -1
+	if c.OptionExtInfDuration != nil {
+		if *c.OptionExtInfDuration < -1 {
+			logger.Warn("The extinf duration is incorrect. Use the default value: -1.", zap.Int("extinfDuration", *c.OptionExtInfDuration))
+		} else {
+			c.ExtInfDuration = *c.OptionExtInfDuration
+		}
+	}
+
+	// 校验catchup-days的最大值
+	if c.MaxCatchupDays < 0 {
+		logger.Warn("The max catchup days is incorrect. Use the default value: 0.", zap.Int("maxCatchupDays", c.MaxCatchupDays))
+		c.MaxCatchupDays = 0
+	}
+
+	// 填充直播源内容末尾是否保留换行符，缺省为true
+	c.TrailingNewline = c.OptionTrailingNewline == nil || *c.OptionTrailingNewline
+
+	// 填充是否合并频道ID相同的频道，缺省为true
+	c.ChDedup = c.OptionChDedup == nil || *c.OptionChDedup
+
+	// 校验组播转单播的路径模板
+	if c.MulticastRelayPath == "" {
+		c.MulticastRelayPath = iptv.DefaultMulticastRelayPath
+	} else if !strings.Contains(c.MulticastRelayPath, iptv.RelayPlaceholderHost) && !strings.Contains(c.MulticastRelayPath, iptv.RelayPlaceholderAddr) {
+		logger.Warn("The multicast relay path has no address placeholder. Use the default value: "+iptv.DefaultMulticastRelayPath+".", zap.String("multicastRelayPath", c.MulticastRelayPath))
+		c.MulticastRelayPath = iptv.DefaultMulticastRelayPath
+	}
+
+	// 填充节目时间所在的时区，缺省为UTC+8
+	c.TimeLocation = iptv.DefaultXmltvLocation
+	if c.TimeZone != "" {
+		loc, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			logger.Warn("The time zone is incorrect. Use the default value: UTC+8.", zap.String("timeZone", c.TimeZone), zap.Error(err))
+		} else {
+			c.TimeLocation = loc
+		}
+	}
+	// hw平台对齐节目时间时使用相同的时区
+	if c.HWCTC != nil {
+		c.HWCTC.TimeLocation = c.TimeLocation
+	}
+
+	// 校验频道列表的来源
+	if c.ChannelSource != nil {
+		switch c.ChannelSource.Type {
+		case iptv.ChannelSourceTypeDefault:
+		case iptv.ChannelSourceTypeFile:
+			if c.ChannelSource.File == "" {
+				return errors.New("the file of the channel source is empty")
+			}
+		default:
+			logger.Warn("The channel source type is not supported. Use the default channel source.", zap.String("type", c.ChannelSource.Type))
+			c.ChannelSource.Type = iptv.ChannelSourceTypeDefault
+		}
+	}
+
 	// 回看请求参数
 	if c.Catchup == nil {
-		c.Catchup = &CatchupConfig{
-			Sources: map[string]string{
-				"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
-				"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
-			},
+		c.Catchup = &CatchupConfig{}
+	}
+	// 回看模式的模板，以模式名称作为回看参数名称，sources中已配置同名参数时以sources为准
+	catchupModes := validateCatchupModes(c.Catchup.Modes)
+	if len(c.Catchup.Sources) == 0 {
+		c.Catchup.Sources = defaultCatchupSources(catchupModes[iptv.CatchupModeFlussonic])
+	}
+	for mode, source := range catchupModes {
+		if _, ok := c.Catchup.Sources[mode]; !ok && c.Catchup.Modes[mode] != "" {
+			c.Catchup.Sources[mode] = source
 		}
-	} else if len(c.Catchup.Sources) == 0 {
-		c.Catchup.Sources = map[string]string{
-			"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
-			"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+	}
+	for name, source := range c.Catchup.Sources {
+		// 播放器的占位符写法较多，不包含可识别的开始时间占位符时仅提示，仍保留该参数
+		if !iptv.HasCatchupTimePlaceholder(source) {
+			logger.Warn("The catchup source does not contain a recognized start time placeholder, the catchup preview cannot expand it.",
+				zap.String("name", name), zap.String("source", source))
 		}
 	}
+	// 按时间基准统一时间占位符的写法
+	switch c.Catchup.TimeBase {
+	case "", iptv.CatchupTimeBaseLocal, iptv.CatchupTimeBaseUTC:
+	default:
+		logger.Warn("The catchup time base is not supported. Use the default value: keep unchanged.", zap.String("timeBase", c.Catchup.TimeBase))
+		c.Catchup.TimeBase = ""
+	}
+	for name, source := range c.Catchup.Sources {
+		c.Catchup.Sources[name] = iptv.ConvertCatchupTimeBase(source, c.Catchup.TimeBase)
+	}
+	if _, ok := c.Catchup.Sources[c.Catchup.Default]; c.Catchup.Default != "" && !ok {
+		logger.Warn("The default catchup source was not found. Use the first catchup source.", zap.String("default", c.Catchup.Default))
+		c.Catchup.Default = ""
+	}
 
 	return nil
 }
 
+// mergeRules 将外部规则文件中的规则追加到主配置的规则之后，过滤规则任意一个匹配即过滤
+func (c *Config) mergeRules(rules *RulesConfig) {
+	if rules.ChExcludeRule != "" {
+		if c.OptionChExcludeRule == "" {
+			c.OptionChExcludeRule = rules.ChExcludeRule
+		} else {
+			c.OptionChExcludeRule = "(?:" + c.OptionChExcludeRule + ")|(?:" + rules.ChExcludeRule + ")"
+		}
+	}
+	c.OptionChGroupRulesList = append(c.OptionChGroupRulesList, rules.ChGroupRules...)
+	c.OptionChLogoRuleList = append(c.OptionChLogoRuleList, rules.ChLogoRules...)
+}
+
+// NewChannelSource 根据配置创建频道列表的来源，使用缺省来源时返回nil
+func (c *Config) NewChannelSource() iptv.ChannelSource {
+	if c.ChannelSource == nil {
+		return nil
+	}
+
+	switch c.ChannelSource.Type {
+	case iptv.ChannelSourceTypeFile:
+		return iptv.NewFileChannelSource(c.ChannelSource.File)
+	default:
+		return nil
+	}
+}
+
+// NewIPTVClient 根据配置的平台名称创建IPTV客户端，配置了自定义的频道列表来源时使用该来源获取频道列表
+func (c *Config) NewIPTVClient() (iptv.Client, error) {
+	newClient, ok := iptvProviders[c.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported iptv provider: %q", c.Provider)
+	}
+	client, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用自定义的频道列表来源
+	if source := c.NewChannelSource(); source != nil {
+		client = iptv.WithChannelSource(client, source)
+	}
+	return client, nil
+}
+
+// SetRegion 指定请求节目单的API接口（即hwctc.channelProgramAPI的别名），覆盖配置文件中的设置，为空时不覆盖
+func (c *Config) SetRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if !hwctc.IsValidChannelProgramAPI(region) {
+		return fmt.Errorf("unsupported region (channelProgramAPI): %q", region)
+	}
+	if c.HWCTC == nil {
+		c.HWCTC = &hwctc.Config{}
+	}
+	c.HWCTC.ChannelProgramAPI = region
+	return nil
+}
+
+// NewHTTPClient 创建请求IPTV服务器的HTTP客户端，并按配置限制与服务器的连接数
+func (c *Config) NewHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
 func Load(fPath string) (*Config, error) {
 	// 读取配置文件
 	data, err := os.ReadFile(fPath)
@@ -148,6 +617,20 @@ func Load(fPath string) (*Config, error) {
 	return &config, nil
 }
 
+// LoadRules 读取外部规则文件，JSON格式同样可以按YAML解析
+func LoadRules(fPath string) (*RulesConfig, error) {
+	data, err := os.ReadFile(fPath)
+	if err != nil {
+		return nil, fmt.Errorf("read rules file failed: %w", err)
+	}
+	var rules RulesConfig
+	if err = yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rules file failed: %w", err)
+	}
+
+	return &rules, nil
+}
+
 func CreateDefaultCfg(fPath string) error {
 	// 写入默认配置
 	f, err := os.Create(fPath)
@@ -224,12 +707,10 @@ func CreateDefaultCfg(fPath string) error {
 			},
 		},
 		Catchup: &CatchupConfig{
-			Sources: map[string]string{
-				"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
-				"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
-			},
+			Sources: defaultCatchupSources(iptv.CatchupSourceFlussonicUTC),
 		},
-		HWCTC: &hwctc.Config{},
+		Provider: ProviderHWCTC,
+		HWCTC:    &hwctc.Config{},
 	}
 
 	return encoder.Encode(&defaultCfg)
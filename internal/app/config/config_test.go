@@ -0,0 +1,401 @@
+package config
+
+import (
+	"iptv/internal/app/iptv"
+	"iptv/internal/app/iptv/hwctc"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestConfig 创建用于测试的最小配置
+func newTestConfig() *Config {
+	return &Config{
+		Key:        "12345678",
+		ServerHost: "127.0.0.1:8080",
+	}
+}
+
+func TestValidateCatchupSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		catchup *CatchupConfig
+		want    map[string]string
+	}{
+		{
+			name:    "nil_uses_defaults",
+			catchup: nil,
+			want:    defaultCatchupSources(iptv.CatchupSourceFlussonicUTC),
+		},
+		{
+			name:    "empty_uses_defaults",
+			catchup: &CatchupConfig{},
+			want:    defaultCatchupSources(iptv.CatchupSourceFlussonicUTC),
+		},
+		{
+			name: "overrides_are_kept",
+			catchup: &CatchupConfig{Sources: map[string]string{
+				"flussonic": "utc=${start}&lutc=${timestamp}",
+				"kodi":      "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+			}},
+			want: map[string]string{
+				"flussonic": "utc=${start}&lutc=${timestamp}",
+				"kodi":      "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+			},
+		},
+		{
+			// 播放器的占位符写法较多，无法识别时仅提示，不删除
+			name: "unrecognized_placeholders_are_kept",
+			catchup: &CatchupConfig{Sources: map[string]string{
+				"0":      "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+				"end":    "playseek=${(e)yyyyMMddHHmmss}",
+				"kodi":   "playseek={Y}{m}{d}{H}{M}{S}",
+				"offset": "offset={offset:1}",
+			}},
+			want: map[string]string{
+				"0":      "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+				"end":    "playseek=${(e)yyyyMMddHHmmss}",
+				"kodi":   "playseek={Y}{m}{d}{H}{M}{S}",
+				"offset": "offset={offset:1}",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConfig()
+			c.Catchup = tt.catchup
+			if err := c.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !maps.Equal(c.Catchup.Sources, tt.want) {
+				t.Errorf("Catchup.Sources = %v, want %v", c.Catchup.Sources, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCatchupModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		catchup *CatchupConfig
+		want    map[string]string
+	}{
+		{
+			name: "overridden_flussonic_and_xdomo",
+			catchup: &CatchupConfig{Modes: map[string]string{
+				"flussonic": "utc=${start}&lutc=${timestamp}&archive=1",
+				"xdomo":     "starttime=${(b)yyyyMMddHHmmss}&endtime=${(e)yyyyMMddHHmmss}",
+			}},
+			want: map[string]string{
+				"0":         "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+				"1":         "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+				"5":         "utc=${start}&lutc=${timestamp}&archive=1",
+				"flussonic": "utc=${start}&lutc=${timestamp}&archive=1",
+				"xdomo":     "starttime=${(b)yyyyMMddHHmmss}&endtime=${(e)yyyyMMddHHmmss}",
+			},
+		},
+		{
+			// 缺少开始时间占位符时使用内置模板，xdomo没有内置模板因此不输出
+			name: "override_without_start_placeholder",
+			catchup: &CatchupConfig{Modes: map[string]string{
+				"flussonic": "utc=now",
+				"xdomo":     "endtime=${end}",
+			}},
+			want: map[string]string{
+				"0":         "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+				"1":         "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+				"5":         iptv.CatchupSourceFlussonicUTC,
+				"flussonic": iptv.CatchupSourceFlussonicUTC,
+			},
+		},
+		{
+			// sources中已配置同名参数时以sources为准，不支持的模式忽略
+			name: "sources_take_precedence",
+			catchup: &CatchupConfig{
+				Sources: map[string]string{"xdomo": "playseek=${(b)yyyyMMddHHmmss}"},
+				Modes: map[string]string{
+					"xdomo":   "starttime=${start}",
+					"unknown": "starttime=${start}",
+				},
+			},
+			want: map[string]string{"xdomo": "playseek=${(b)yyyyMMddHHmmss}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConfig()
+			c.Catchup = tt.catchup
+			if err := c.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if !maps.Equal(c.Catchup.Sources, tt.want) {
+				t.Errorf("Catchup.Sources = %v, want %v", c.Catchup.Sources, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCatchupDefault(t *testing.T) {
+	c := newTestConfig()
+	c.Catchup = &CatchupConfig{Default: "1"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if c.Catchup.Default != "1" {
+		t.Errorf("Catchup.Default = %q, want 1", c.Catchup.Default)
+	}
+
+	// 未配置的名称将被忽略
+	c = newTestConfig()
+	c.Catchup = &CatchupConfig{Default: "missing"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if c.Catchup.Default != "" {
+		t.Errorf("Catchup.Default = %q, want empty", c.Catchup.Default)
+	}
+}
+
+func TestValidateChDedup(t *testing.T) {
+	// 未配置时缺省合并
+	c := newTestConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !c.ChDedup {
+		t.Error("ChDedup = false, want true")
+	}
+
+	disabled := false
+	c = newTestConfig()
+	c.OptionChDedup = &disabled
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if c.ChDedup {
+		t.Error("ChDedup = true, want false")
+	}
+}
+
+func TestValidateProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     string
+		wantErr  bool
+	}{
+		{provider: "", want: ProviderHWCTC},
+		{provider: "hwctc", want: ProviderHWCTC},
+		{provider: "hwctcc", wantErr: true},
+	}
+	for _, tt := range tests {
+		c := newTestConfig()
+		c.Provider = tt.provider
+		err := c.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+		}
+		if !tt.wantErr && c.Provider != tt.want {
+			t.Errorf("Provider = %q, want %q", c.Provider, tt.want)
+		}
+	}
+}
+
+func TestSetRegion(t *testing.T) {
+	c := newTestConfig()
+	c.HWCTC = &hwctc.Config{ChannelProgramAPI: "vsp"}
+
+	// 为空时不覆盖配置文件
+	if err := c.SetRegion(""); err != nil {
+		t.Fatalf("SetRegion() error = %v", err)
+	}
+	if c.HWCTC.ChannelProgramAPI != "vsp" {
+		t.Errorf("ChannelProgramAPI = %q, want vsp", c.HWCTC.ChannelProgramAPI)
+	}
+
+	if err := c.SetRegion("gdhdpublic"); err != nil {
+		t.Fatalf("SetRegion() error = %v", err)
+	}
+	if c.HWCTC.ChannelProgramAPI != "gdhdpublic" {
+		t.Errorf("ChannelProgramAPI = %q, want gdhdpublic", c.HWCTC.ChannelProgramAPI)
+	}
+
+	if err := c.SetRegion("unknown"); err == nil {
+		t.Error("SetRegion() error = nil, want error")
+	}
+}
+
+func TestValidateCatchupTimeBase(t *testing.T) {
+	conf := newTestConfig()
+	conf.Catchup = &CatchupConfig{TimeBase: iptv.CatchupTimeBaseUTC}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := map[string]string{
+		"0": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+		"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+		"5": "utc=${start}&lutc=${timestamp}",
+	}
+	if !maps.Equal(conf.Catchup.Sources, want) {
+		t.Errorf("Sources = %v, want %v", conf.Catchup.Sources, want)
+	}
+
+	conf = newTestConfig()
+	conf.Catchup = &CatchupConfig{TimeBase: "gmt"}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if conf.Catchup.TimeBase != "" || !maps.Equal(conf.Catchup.Sources, defaultCatchupSources(iptv.CatchupSourceFlussonicUTC)) {
+		t.Errorf("TimeBase = %q, Sources = %v, want unchanged", conf.Catchup.TimeBase, conf.Catchup.Sources)
+	}
+}
+
+func TestValidateGroupOrder(t *testing.T) {
+	conf := newTestConfig()
+	conf.GroupOrder = &GroupOrderConfig{Groups: []string{" 央视 ", "", "卫视"}, Unlisted: "hide"}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !slices.Equal(conf.GroupOrder.Groups, []string{"央视", "卫视"}) {
+		t.Errorf("Groups = %v, want [央视 卫视]", conf.GroupOrder.Groups)
+	}
+	if conf.GroupOrder.Unlisted != iptv.GroupUnlistedAppend {
+		t.Errorf("Unlisted = %q, want %q", conf.GroupOrder.Unlisted, iptv.GroupUnlistedAppend)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	tests := []struct {
+		name                    string
+		maxConnsPerHost         int
+		maxIdleConnsPerHost     int
+		wantMaxConnsPerHost     int
+		wantMaxIdleConnsPerHost int
+	}{
+		{name: "default", wantMaxConnsPerHost: 0, wantMaxIdleConnsPerHost: 0},
+		{name: "configured", maxConnsPerHost: 4, maxIdleConnsPerHost: 2, wantMaxConnsPerHost: 4, wantMaxIdleConnsPerHost: 2},
+		{name: "negative", maxConnsPerHost: -1, maxIdleConnsPerHost: -1, wantMaxConnsPerHost: 0, wantMaxIdleConnsPerHost: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConfig()
+			c.MaxConnsPerHost = tt.maxConnsPerHost
+			c.MaxIdleConnsPerHost = tt.maxIdleConnsPerHost
+			if err := c.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			client := c.NewHTTPClient(10 * time.Second)
+			if client.Timeout != 10*time.Second {
+				t.Errorf("Timeout = %v, want 10s", client.Timeout)
+			}
+			transport, ok := client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("Transport = %T, want *http.Transport", client.Transport)
+			}
+			if transport.MaxConnsPerHost != tt.wantMaxConnsPerHost {
+				t.Errorf("MaxConnsPerHost = %d, want %d", transport.MaxConnsPerHost, tt.wantMaxConnsPerHost)
+			}
+			if transport.MaxIdleConnsPerHost != tt.wantMaxIdleConnsPerHost {
+				t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, tt.wantMaxIdleConnsPerHost)
+			}
+			if transport == http.DefaultTransport {
+				t.Error("Transport should not be the shared default transport")
+			}
+		})
+	}
+}
+
+func TestValidateRulesFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "rules.yml")
+	// 使用YAML的流式写法，与JSON格式兼容
+	if err := os.WriteFile(yamlFile, []byte(`{"chExcludeRule": "画中画",
+  "chGroupRules": [{"name": "央视", "rules": ["^CCTV"]}, {"name": "卫视", "rules": ["卫视"]}],
+  "logos": [{"name": "CCTV$G1", "rule": "^CCTV-?(\\d+)"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsonFile := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(jsonFile, []byte(`{"chGroupRules": [{"name": "卫视", "rules": ["卫视"]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inline := newTestConfig()
+	inline.OptionChExcludeRule = "画中画"
+	inline.OptionChGroupRulesList = []OptionChannelGroupRules{
+		{Name: "央视", Rules: []string{"^CCTV"}},
+		{Name: "卫视", Rules: []string{"卫视"}},
+	}
+	inline.OptionChLogoRuleList = []OptionChannelLogoRule{{Name: "CCTV$G1", Rule: `^CCTV-?(\d+)`}}
+	if err := inline.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	external := newTestConfig()
+	external.RulesFile = yamlFile
+	if err := external.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, channelName := range []string{"CCTV-1", "CCTV5+", "湖南卫视", "测试频道", "CCTV1画中画"} {
+		if got, want := iptv.GetChannelGroupName(external.ChGroupRulesList, channelName), iptv.GetChannelGroupName(inline.ChGroupRulesList, channelName); got != want {
+			t.Errorf("GetChannelGroupName(%q) = %q, want %q", channelName, got, want)
+		}
+		if got, want := iptv.GetChannelLogoName(external.ChLogoRuleList, channelName), iptv.GetChannelLogoName(inline.ChLogoRuleList, channelName); got != want {
+			t.Errorf("GetChannelLogoName(%q) = %q, want %q", channelName, got, want)
+		}
+		if got, want := external.ChExcludeRule.MatchString(channelName), inline.ChExcludeRule.MatchString(channelName); got != want {
+			t.Errorf("ChExcludeRule.MatchString(%q) = %v, want %v", channelName, got, want)
+		}
+	}
+
+	// 外部规则追加在主配置的规则之后，过滤规则任意一个匹配即过滤
+	merged := newTestConfig()
+	merged.OptionChExcludeRule = "单音轨"
+	merged.OptionChGroupRulesList = []OptionChannelGroupRules{{Name: "央视", Rules: []string{"^CCTV"}}}
+	merged.RulesFile = jsonFile
+	if err := merged.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if len(merged.ChGroupRulesList) != 2 || merged.ChGroupRulesList[1].Name != "卫视" {
+		t.Errorf("ChGroupRulesList = %v, want 央视 and 卫视", merged.ChGroupRulesList)
+	}
+
+	merged = newTestConfig()
+	merged.OptionChExcludeRule = "单音轨"
+	merged.RulesFile = yamlFile
+	if err := merged.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !merged.ChExcludeRule.MatchString("CCTV1单音轨") || !merged.ChExcludeRule.MatchString("CCTV1画中画") || merged.ChExcludeRule.MatchString("CCTV1") {
+		t.Errorf("ChExcludeRule = %s, want either rule to match", merged.ChExcludeRule)
+	}
+
+	missing := newTestConfig()
+	missing.RulesFile = filepath.Join(dir, "missing.yml")
+	if err := missing.Validate(); err == nil {
+		t.Error("Validate() error = nil, want error for the missing rules file")
+	}
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	c := newTestConfig()
+	c.TimeZone = "UTC"
+	c.HWCTC = &hwctc.Config{}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if c.TimeLocation != time.UTC {
+		t.Errorf("TimeLocation = %v, want %v", c.TimeLocation, time.UTC)
+	}
+	// hw平台使用相同的时区对齐节目时间
+	if c.HWCTC.TimeLocation != c.TimeLocation {
+		t.Errorf("HWCTC.TimeLocation = %v, want %v", c.HWCTC.TimeLocation, c.TimeLocation)
+	}
+}
@@ -0,0 +1,172 @@
+package iptv
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// catchupTimeRegexp 匹配${(b)yyyyMMddHHmmss}、${(e)yyyyMMddHHmmss}格式的时间占位符
+	catchupTimeRegexp = regexp.MustCompile(`\$\{\((b|e)\)([^}]*)\}`)
+	// catchupUtcRegexp 匹配{utc:YmdHMS}、{utcend:YmdHMS}格式的时间占位符
+	catchupUtcRegexp = regexp.MustCompile(`\{(utc|utcend):([^}]*)\}`)
+
+	// catchupJavaLayoutReplacer 将yyyyMMddHHmmss格式转换为Go的时间格式
+	catchupJavaLayoutReplacer = strings.NewReplacer("yyyy", "2006", "MM", "01", "dd", "02", "HH", "15", "mm", "04", "ss", "05")
+	// catchupStrftimeLayoutReplacer 将YmdHMS格式转换为Go的时间格式
+	catchupStrftimeLayoutReplacer = strings.NewReplacer("Y", "2006", "m", "01", "d", "02", "H", "15", "M", "04", "S", "05")
+
+	// catchupJavaToStrftimeReplacer 将yyyyMMddHHmmss格式转换为YmdHMS格式
+	catchupJavaToStrftimeReplacer = strings.NewReplacer("yyyy", "Y", "MM", "m", "dd", "d", "HH", "H", "mm", "M", "ss", "S")
+	// catchupStrftimeToJavaReplacer 将YmdHMS格式转换为yyyyMMddHHmmss格式
+	catchupStrftimeToJavaReplacer = strings.NewReplacer("Y", "yyyy", "m", "MM", "d", "dd", "H", "HH", "M", "mm", "S", "ss")
+)
+
+// 回看请求中时间占位符的时间基准
+const (
+	CatchupTimeBaseLocal = "local" // 本地时间，使用${(b)yyyyMMddHHmmss}、${(e)yyyyMMddHHmmss}格式，e.g DIYP、TVBox
+	CatchupTimeBaseUTC   = "utc"   // UTC时间，使用{utc:YmdHMS}、{utcend:YmdHMS}格式，e.g Kodi、TiviMate
+)
+
+// CatchupSourceFlussonicUTC Flussonic风格的回看请求参数，开始时间及请求时间均为Unix时间戳（flussonic-utc）
+const CatchupSourceFlussonicUTC = "utc=${start}&lutc=${timestamp}"
+
+// 可通过配置覆盖模板的回看模式
+const (
+	CatchupModeFlussonic = "flussonic" // Flussonic风格，缺省模板为CatchupSourceFlussonicUTC
+	CatchupModeXdomo     = "xdomo"     // xdomo风格，没有内置的模板，需通过配置提供
+)
+
+// catchupUnixStartPlaceholders 以Unix时间戳表示开始时间的占位符
+var catchupUnixStartPlaceholders = []string{"${start}", "${timestamp}", "{timestamp}", "${utc}", "{utc}", "{start}"}
+
+// catchupUnixEndPlaceholders 以Unix时间戳表示结束时间的占位符
+var catchupUnixEndPlaceholders = []string{"${end}", "{utcend}", "{end}"}
+
+// DefaultCatchupModeSource 获取回看模式的内置模板，没有内置模板时返回空字符串
+func DefaultCatchupModeSource(mode string) string {
+	if mode == CatchupModeFlussonic {
+		return CatchupSourceFlussonicUTC
+	}
+	return ""
+}
+
+// HasCatchupTimePlaceholder 判断回看请求格式中是否包含ExpandCatchupSource支持的开始时间占位符
+func HasCatchupTimePlaceholder(catchupSource string) bool {
+	for _, match := range catchupTimeRegexp.FindAllStringSubmatch(catchupSource, -1) {
+		if match[1] == "b" {
+			return true
+		}
+	}
+	for _, match := range catchupUtcRegexp.FindAllStringSubmatch(catchupSource, -1) {
+		if match[1] == "utc" {
+			return true
+		}
+	}
+	for _, placeholder := range catchupUnixStartPlaceholders {
+		if strings.Contains(catchupSource, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetChannelCatchupSource 获取频道完整的回看地址（包含占位符），频道不支持回看时返回空字符串
+func GetChannelCatchupSource(channel *Channel, catchupSource string) string {
+	catchupSource = strings.TrimLeft(catchupSource, "?&")
+	if catchupSource == "" || channel.TimeShift != "1" || channel.TimeShiftLength <= 0 {
+		return ""
+	}
+
+	// 替换频道信息的占位符
+	catchupSource = replaceCatchupChannelPlaceholders(catchupSource, channel)
+
+	// 回看地址指向独立的录制代理，不依赖上游的时移地址
+	if isCatchupProxySource(catchupSource) {
+		return catchupSource
+	}
+
+	if channel.TimeShiftURL == nil {
+		return ""
+	}
+	if channel.TimeShiftURL.RawQuery != "" {
+		return channel.TimeShiftURL.String() + "&" + catchupSource
+	}
+	return channel.TimeShiftURL.String() + "?" + catchupSource
+}
+
+// SetChannelLiveTimeShiftURL 为支持时移但没有时移地址的频道，使用单播直播地址作为时移地址
+// 适用于直播地址本身支持定位回看时间的IPTV，只有组播地址的频道保持不变
+func SetChannelLiveTimeShiftURL(channels []Channel) {
+	for i := range channels {
+		channel := &channels[i]
+		if channel.TimeShift != "1" || channel.TimeShiftURL != nil || len(channel.ChannelURLs) == 0 {
+			continue
+		}
+
+		liveURL := channel.ChannelURLs[getChannelURLIndex(channel.ChannelURLs, false)]
+		if liveURL.Scheme != SCHEME_IGMP {
+			channel.TimeShiftURL = &liveURL
+		}
+	}
+}
+
+// ConvertCatchupTimeBase 将回看请求格式中的开始及结束时间占位符转换为指定时间基准的写法，时间格式保持一致
+// timeBase为空时保持不变；Unix时间戳等与时区无关的占位符不受影响
+func ConvertCatchupTimeBase(catchupSource, timeBase string) string {
+	switch timeBase {
+	case CatchupTimeBaseUTC:
+		return catchupTimeRegexp.ReplaceAllStringFunc(catchupSource, func(s string) string {
+			match := catchupTimeRegexp.FindStringSubmatch(s)
+			tag := "utc"
+			if match[1] == "e" {
+				tag = "utcend"
+			}
+			return "{" + tag + ":" + catchupJavaToStrftimeReplacer.Replace(match[2]) + "}"
+		})
+	case CatchupTimeBaseLocal:
+		return catchupUtcRegexp.ReplaceAllStringFunc(catchupSource, func(s string) string {
+			match := catchupUtcRegexp.FindStringSubmatch(s)
+			tag := "b"
+			if match[1] == "utcend" {
+				tag = "e"
+			}
+			return "${(" + tag + ")" + catchupStrftimeToJavaReplacer.Replace(match[2]) + "}"
+		})
+	default:
+		return catchupSource
+	}
+}
+
+// ExpandCatchupSource 按指定的开始及结束时间替换回看地址中的占位符，用于预览播放器实际请求的回看地址
+func ExpandCatchupSource(catchupSource string, start, end time.Time) string {
+	result := catchupTimeRegexp.ReplaceAllStringFunc(catchupSource, func(s string) string {
+		match := catchupTimeRegexp.FindStringSubmatch(s)
+		t := start
+		if match[1] == "e" {
+			t = end
+		}
+		return t.Format(catchupJavaLayoutReplacer.Replace(match[2]))
+	})
+	result = catchupUtcRegexp.ReplaceAllStringFunc(result, func(s string) string {
+		match := catchupUtcRegexp.FindStringSubmatch(s)
+		t := start
+		if match[1] == "utcend" {
+			t = end
+		}
+		return t.UTC().Format(catchupStrftimeLayoutReplacer.Replace(match[2]))
+	})
+
+	// 以Unix时间戳表示的占位符
+	startUnix, endUnix := strconv.FormatInt(start.Unix(), 10), strconv.FormatInt(end.Unix(), 10)
+	oldnew := make([]string, 0, 2*(len(catchupUnixStartPlaceholders)+len(catchupUnixEndPlaceholders)))
+	for _, placeholder := range catchupUnixStartPlaceholders {
+		oldnew = append(oldnew, placeholder, startUnix)
+	}
+	for _, placeholder := range catchupUnixEndPlaceholders {
+		oldnew = append(oldnew, placeholder, endUnix)
+	}
+	return strings.NewReplacer(oldnew...).Replace(result)
+}
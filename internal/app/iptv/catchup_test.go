@@ -0,0 +1,101 @@
+package iptv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertCatchupTimeBase(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		timeBase string
+		want     string
+	}{
+		{
+			name:     "local to utc",
+			source:   "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+			timeBase: CatchupTimeBaseUTC,
+			want:     "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+		},
+		{
+			name:     "utc to local",
+			source:   "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+			timeBase: CatchupTimeBaseLocal,
+			want:     "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+		},
+		{
+			name:     "already utc",
+			source:   "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+			timeBase: CatchupTimeBaseUTC,
+			want:     "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+		},
+		{
+			name:     "unchanged",
+			source:   "playseek=${(b)yyyyMMddHHmmss}-{utcend:YmdHMS}",
+			timeBase: "",
+			want:     "playseek=${(b)yyyyMMddHHmmss}-{utcend:YmdHMS}",
+		},
+		{
+			name:     "timestamp",
+			source:   "utc=${start}&lutc=${timestamp}",
+			timeBase: CatchupTimeBaseLocal,
+			want:     "utc=${start}&lutc=${timestamp}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConvertCatchupTimeBase(tt.source, tt.timeBase); got != tt.want {
+				t.Errorf("ConvertCatchupTimeBase() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 转换后的占位符按对应的时间基准展开
+	loc := time.FixedZone("CST", 8*3600)
+	start := time.Date(2024, 11, 22, 20, 0, 0, 0, loc)
+	end := start.Add(time.Hour)
+	utcSource := ConvertCatchupTimeBase("playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", CatchupTimeBaseUTC)
+	if got, want := ExpandCatchupSource(utcSource, start, end), "playseek=20241122120000-20241122130000"; got != want {
+		t.Errorf("ExpandCatchupSource() = %q, want %q", got, want)
+	}
+}
+
+func TestGetChannelCatchupSourcePlaceholders(t *testing.T) {
+	channel := newTestChannel(t, "5", "CCTV 5+", "http://10.0.0.1/live/5")
+	channel.TimeShiftLength = 48 * time.Hour
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "append",
+			source: "playseek=${(b)yyyyMMddHHmmss}&name=${channelName}&len=${timeshiftLen}",
+			want:   "http://10.0.0.1/timeshift/5?a=1&playseek=${(b)yyyyMMddHHmmss}&name=CCTV+5%2B&len=48",
+		},
+		{
+			name:   "proxy",
+			source: "http://192.168.1.2:8080/record/${channelId}/${timeshiftLen}?start=${(b)yyyyMMddHHmmss}",
+			want:   "http://192.168.1.2:8080/record/5/48?start=${(b)yyyyMMddHHmmss}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetChannelCatchupSource(&channel, tt.source); got != tt.want {
+				t.Errorf("GetChannelCatchupSource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandCatchupSourceFlussonicUTC(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	start := time.Date(2024, 11, 22, 20, 0, 0, 0, loc)
+	got := ExpandCatchupSource(CatchupSourceFlussonicUTC, start, start.Add(time.Hour))
+	if want := "utc=1732276800&lutc=1732276800"; got != want {
+		t.Errorf("ExpandCatchupSource() = %q, want %q", got, want)
+	}
+}
@@ -1,18 +1,44 @@
 package iptv
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"iptv/internal/pkg/util"
+	"net"
 	"net/url"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const SCHEME_IGMP = "igmp"
 
+// 回看请求格式中的频道信息占位符
+const (
+	CatchupPlaceholderChannelID    = "${channelId}"    // 频道ID
+	CatchupPlaceholderChannelName  = "${channelName}"  // 频道名称（URL编码）
+	CatchupPlaceholderTimeShiftLen = "${timeshiftLen}" // 频道的时移长度，单位为小时
+)
+
+// catchupEntrySuffix 额外输出的回看条目的名称后缀
+const catchupEntrySuffix = " 回看"
+
+// 组播转单播地址模板中的占位符
+const (
+	RelayPlaceholderHost = "${host}" // 组播地址及端口，e.g 239.1.1.1:5000
+	RelayPlaceholderAddr = "${addr}" // 组播地址
+	RelayPlaceholderPort = "${port}" // 组播端口
+)
+
+// DefaultMulticastRelayPath 缺省的组播转单播路径，与udpxy保持一致
+const DefaultMulticastRelayPath = "/rtp/" + RelayPlaceholderAddr + ":" + RelayPlaceholderPort
+
+const (
+	M3UTargetDefault   = ""          // 标准的m3u格式
+	M3UTargetTvheadend = "tvheadend" // 适用于Tvheadend的IPTV自动网络，额外输出tvh-标签
+)
+
 // Channel 频道信息
 type Channel struct {
 	ChannelID       string        `json:"channelID"`       // 频道ID
@@ -23,80 +49,247 @@ type Channel struct {
 	TimeShiftLength time.Duration `json:"timeShiftLength"` // 支持的时移长度
 	TimeShiftURL    *url.URL      `json:"timeShiftURL"`    // 时移地址（回放地址）
 
-	GroupName string `json:"groupName"` // 程序识别的频道分类
-	LogoName  string `json:"logoName"`  // 频道台标名称
+	GroupName string `json:"groupName"`       // 程序识别的频道分类
+	LogoName  string `json:"logoName"`        // 频道台标名称
+	TvgID     string `json:"tvgId,omitempty"` // 输出的tvg-id，为空时使用频道ID
+
+	DRM    *ChannelDRM    `json:"drm,omitempty"`    // 频道的DRM信息
+	Locale *ChannelLocale `json:"locale,omitempty"` // 频道的国家和语言信息
+}
+
+// M3UOptions 生成M3U格式内容的可选参数，零值表示不启用对应的功能
+type M3UOptions struct {
+	LogoBaseURL     string               // 台标的Base URL，可以是完整的URL地址，也可以是相对路径（如：/logo）
+	NowNextMap      map[string][]Program // 不为空时，在每个频道下以注释行的形式输出当前及下一个节目
+	ExtInfDuration  int                  // #EXTINF的时长字段，直播频道通常为-1
+	CatchupEntry    bool                 // 为true时，支持回看的频道会额外输出一个名为“频道名称 回看”的条目，指向频道的时移地址
+	Target          string               // 为M3UTargetTvheadend时，额外输出Tvheadend识别的tvh-uuid、tvh-chnum、tvh-tags等属性
+	TvgRec          bool                 // 为true时，为支持时移的频道输出tvg-rec="1"，标记频道可录制
+	GroupComments   bool                 // 为true时，在每个分组的第一个频道前输出注释行，标明分组名称及频道数量
+	MaxCatchupDays  int                  // 大于0时，输出的catchup-days不超过该天数
+	LogoDir         string               // 台标文件所在的目录，为空时使用程序所在目录下的logos目录
+	EPGURL          string               // 不为空时，在#EXTM3U行输出url-tvg属性，供播放器自动关联XMLTV节目单
+	EPGBackDaysMap  map[string]int       // 不为空时，catchup-days不超过频道节目单实际覆盖的回看天数，映射中不存在的频道不受限制
+	LogoPlaceholder bool                 // 为true时，台标文件不存在也输出tvg-logo，由服务端生成占位台标
+	GroupRenameMap  map[string]string    // 不为空时，按映射改写输出的分组名称，不修改频道原有的分组名称
+	Strict          bool                 // 为false时，跳过无法获取URL地址的频道并返回被跳过的频道名称，为true时任一频道失败则返回错误
 }
 
-// ToM3UFormat 转换为M3U格式内容
-func ToM3UFormat(channels []Channel, udpxyURL, catchupSource string, multicastFirst bool, logoBaseUrl string) (string, error) {
+// ToM3UFormat 转换为M3U格式内容，opts为可选参数，返回内容及被跳过的频道名称
+func ToM3UFormat(channels []Channel, udpxyURL, catchupSource string, multicastFirst bool, opts M3UOptions) (string, []string, error) {
 	if len(channels) == 0 {
-		return "", errors.New("no channels found")
+		return "", nil, errors.New("no channels found")
 	}
+	channels = renameChannelGroups(channels, opts.GroupRenameMap)
 
 	catchupSource = strings.TrimLeft(catchupSource, "?&")
 
-	currDir, err := util.GetCurrentAbPathByExecutable()
+	logoDir, err := ResolveLogoDir(opts.LogoDir)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	var sb strings.Builder
-	sb.WriteString("#EXTM3U\n")
-	for _, channel := range channels {
-		// 根据指定条件，获取频道URL地址
-		channelURLStr, isMulticastCh, err := getChannelURLStr(channel.ChannelURLs, udpxyURL, multicastFirst)
+	// 根据指定条件，获取各频道的URL地址，跳过无法获取的频道
+	var skipped []string
+	channelURLStrs := make([]string, len(channels))
+	multicastChs := make([]bool, len(channels))
+	for i := range channels {
+		channelURLStrs[i], multicastChs[i], err = getChannelURLStr(channels[i].ChannelURLs, udpxyURL, multicastFirst)
 		if err != nil {
-			return "", err
+			if opts.Strict {
+				return "", nil, fmt.Errorf("channel %s: %w", channels[i].ChannelName, err)
+			}
+			skipped = append(skipped, channels[i].ChannelName)
 		}
+	}
 
-		var m3uLineSb strings.Builder
+	// 统计各分组的频道数量
+	var groupCountMap map[string]int
+	if opts.GroupComments {
+		groupCountMap = make(map[string]int)
+		for i, channel := range channels {
+			if channelURLStrs[i] != "" {
+				groupCountMap[channel.GroupName]++
+			}
+		}
+	}
 
-		// 设置频道ID和序号
-		m3uLineSb.WriteString(fmt.Sprintf("#EXTINF:-1 tvg-id=\"%s\" tvg-chno=\"%s\"",
-			channel.ChannelID, channel.UserChannelID))
+	var sb strings.Builder
+	if opts.EPGURL != "" {
+		sb.WriteString(fmt.Sprintf("#EXTM3U url-tvg=\"%s\"\n", opts.EPGURL))
+	} else {
+		sb.WriteString("#EXTM3U\n")
+	}
+	for i, channel := range channels {
+		channelURLStr, isMulticastCh := channelURLStrs[i], multicastChs[i]
+		if channelURLStr == "" {
+			continue
+		}
+
+		// 在分组的第一个频道前输出分组名称及频道数量
+		if count, ok := groupCountMap[channel.GroupName]; ok {
+			sb.WriteString(fmt.Sprintf("# %s (%d channels)\n", channel.GroupName, count))
+			delete(groupCountMap, channel.GroupName)
+		}
+
+		var chAttrSb strings.Builder
+
+		// 设置频道ID、序号和名称，部分播放器按tvg-name匹配节目单
+		chAttrSb.WriteString(fmt.Sprintf("tvg-id=\"%s\" tvg-chno=\"%s\" tvg-name=\"%s\"",
+			channel.GetTvgID(), channel.UserChannelID, escapeM3UAttrValue(channel.ChannelName)))
 		// 设置频道的台标URL
-		if logoBaseUrl != "" && channel.LogoName != "" {
-			logoFile := channel.LogoName + ".png"
-			if _, err = os.Stat(filepath.Join(currDir, logoDirName, logoFile)); !os.IsNotExist(err) {
-				if logoUrl, err := url.JoinPath(logoBaseUrl, logoFile); err == nil {
-					m3uLineSb.WriteString(fmt.Sprintf(" tvg-logo=\"%s\"",
-						logoUrl))
-				}
+		if logoUrl := getExistingChannelLogoURL(channel.LogoName, opts.LogoBaseURL, logoDir, opts.LogoPlaceholder); logoUrl != "" {
+			chAttrSb.WriteString(fmt.Sprintf(" tvg-logo=\"%s\"", logoUrl))
+		}
+		// 设置Tvheadend的频道属性
+		if opts.Target == M3UTargetTvheadend {
+			chAttrSb.WriteString(getTvheadendAttrs(&channel))
+		}
+		// 标记支持时移的频道可录制
+		if opts.TvgRec && channel.TimeShift == "1" && channel.TimeShiftLength > 0 {
+			chAttrSb.WriteString(" tvg-rec=\"1\"")
+		}
+		// 设置频道的国家和语言
+		if channel.Locale != nil {
+			if channel.Locale.Country != "" {
+				chAttrSb.WriteString(fmt.Sprintf(" tvg-country=\"%s\"", channel.Locale.Country))
+			}
+			if channel.Locale.Language != "" {
+				chAttrSb.WriteString(fmt.Sprintf(" tvg-language=\"%s\"", channel.Locale.Language))
 			}
 		}
-		// 设置频道回看参数
-		if catchupSource != "" &&
-			channel.TimeShift == "1" && channel.TimeShiftLength > 0 && channel.TimeShiftURL != nil {
-			var chCatchup, chCatchupSource string
-			if isMulticastCh {
-				chCatchup = "default"
-				chCatchupSource = channel.TimeShiftURL.String()
-				if channel.TimeShiftURL.RawQuery != "" {
-					chCatchupSource += "&" + catchupSource
-				} else {
-					chCatchupSource += "?" + catchupSource
-				}
+		// 设置频道回看参数，entryCatchupAttr为额外的回看条目使用的回看参数
+		var catchupAttr, entryCatchupAttr string
+		if chCatchupSource := GetChannelCatchupSource(&channel, catchupSource); chCatchupSource != "" {
+			catchupDays := getCatchupDays(&channel, opts.MaxCatchupDays, opts.EPGBackDaysMap)
+
+			// 回看条目直接指向时移地址，因此始终使用完整的回看地址
+			entryCatchupAttr = fmt.Sprintf(" catchup=\"default\" catchup-source=\"%s\" catchup-days=\"%d\"",
+				chCatchupSource, catchupDays)
+			// 回看地址指向独立的录制代理或频道为组播地址时，使用完整的回看地址，否则追加在直播地址后面
+			if isCatchupProxySource(catchupSource) || isMulticastCh {
+				catchupAttr = entryCatchupAttr
 			} else {
-				chCatchup = "append"
-				chCatchupSource = "?" + catchupSource
+				catchupAttr = fmt.Sprintf(" catchup=\"append\" catchup-source=\"?%s\" catchup-days=\"%d\"",
+					replaceCatchupChannelPlaceholders(catchupSource, &channel), catchupDays)
 			}
-
-			m3uLineSb.WriteString(fmt.Sprintf(" catchup=\"%s\" catchup-source=\"%s\" catchup-days=\"%d\"",
-				chCatchup, chCatchupSource, int64(channel.TimeShiftLength.Hours()/24)))
 		}
+
+		var m3uLineSb strings.Builder
+		m3uLineSb.WriteString(fmt.Sprintf("#EXTINF:%d %s%s", opts.ExtInfDuration, chAttrSb.String(), catchupAttr))
 		// 设置频道分组和名称
-		m3uLineSb.WriteString(fmt.Sprintf(" group-title=\"%s\",%s\n%s\n",
-			channel.GroupName, channel.ChannelName, channelURLStr))
+		m3uLineSb.WriteString(fmt.Sprintf(" group-title=\"%s\",%s\n",
+			channel.GroupName, channel.ChannelName))
+		// 设置频道的DRM信息，供Kodi的inputstream.adaptive使用
+		if channel.DRM != nil {
+			m3uLineSb.WriteString("#KODIPROP:inputstream=inputstream.adaptive\n")
+			if channel.DRM.LicenseType != "" {
+				m3uLineSb.WriteString(fmt.Sprintf("#KODIPROP:inputstream.adaptive.license_type=%s\n", channel.DRM.LicenseType))
+			}
+			m3uLineSb.WriteString(fmt.Sprintf("#KODIPROP:inputstream.adaptive.license_key=%s\n", channel.DRM.LicenseKey))
+		}
+		// 设置频道当前及下一个节目，供不支持XMLTV的播放器使用
+		for i, program := range opts.NowNextMap[channel.ChannelID] {
+			label := "Now"
+			if i > 0 {
+				label = "Next"
+			}
+			m3uLineSb.WriteString(fmt.Sprintf("# %s: %s-%s %s\n", label, program.StartTime, program.EndTime, program.ProgramName))
+		}
+		// 设置频道URL
+		m3uLineSb.WriteString(channelURLStr + "\n")
+		// 为支持回看的频道额外输出一个指向时移地址的回看条目，tvg-id与直播条目保持一致
+		if opts.CatchupEntry && entryCatchupAttr != "" && channel.TimeShiftURL != nil {
+			m3uLineSb.WriteString(fmt.Sprintf("#EXTINF:%d %s%s group-title=\"%s\",%s%s\n",
+				opts.ExtInfDuration, chAttrSb.String(), entryCatchupAttr, channel.GroupName, channel.ChannelName, catchupEntrySuffix))
+			m3uLineSb.WriteString(channel.TimeShiftURL.String() + "\n")
+		}
 		sb.WriteString(m3uLineSb.String())
 	}
-	return sb.String(), nil
+	return sb.String(), skipped, nil
+}
+
+// NormalizeTrailingNewline 规范直播源内容末尾的换行符，trailingNewline为true时保留一个换行符，否则不保留
+func NormalizeTrailingNewline(content string, trailingNewline bool) string {
+	content = strings.TrimRight(content, "\r\n")
+	if trailingNewline {
+		content += "\n"
+	}
+	return content
+}
+
+// m3uAttrValueReplacer 替换m3u属性值中会破坏#EXTINF行解析的字符
+var m3uAttrValueReplacer = strings.NewReplacer(`"`, "'", "\r", "", "\n", "")
+
+// escapeM3UAttrValue 转义m3u属性值，双引号替换为单引号并去除换行符，逗号位于引号内不影响解析
+func escapeM3UAttrValue(value string) string {
+	return m3uAttrValueReplacer.Replace(value)
+}
+
+// getCatchupDays 根据频道的时移长度获取回看天数，maxCatchupDays大于0时不超过该天数
+// epgBackDaysMap中存在该频道时，不超过节目单实际覆盖的回看天数
+func getCatchupDays(channel *Channel, maxCatchupDays int, epgBackDaysMap map[string]int) int64 {
+	catchupDays := int64(channel.TimeShiftLength.Hours() / 24)
+	if maxCatchupDays > 0 && catchupDays > int64(maxCatchupDays) {
+		catchupDays = int64(maxCatchupDays)
+	}
+	if backDays, ok := epgBackDaysMap[channel.ChannelID]; ok && catchupDays > int64(backDays) {
+		catchupDays = int64(backDays)
+	}
+	return catchupDays
+}
+
+// getTvheadendAttrs 获取Tvheadend的频道属性，tvh-uuid根据tvg-id生成，保证多次刷新时保持不变
+func getTvheadendAttrs(channel *Channel) string {
+	sum := md5.Sum([]byte(channel.GetTvgID()))
+	return fmt.Sprintf(" tvh-uuid=\"%s\" tvh-chnum=\"%s\" tvh-tags=\"%s\"",
+		hex.EncodeToString(sum[:]), channel.UserChannelID, channel.GroupName)
+}
+
+// isCatchupProxySource 判断回看请求格式是否为完整的代理地址（如：自建的录制代理）
+func isCatchupProxySource(catchupSource string) bool {
+	return strings.HasPrefix(catchupSource, "http://") || strings.HasPrefix(catchupSource, "https://")
+}
+
+// replaceCatchupChannelPlaceholders 根据频道信息，替换回看请求格式中的频道ID、频道名称及时移长度占位符
+func replaceCatchupChannelPlaceholders(catchupSource string, channel *Channel) string {
+	if !strings.Contains(catchupSource, "${") {
+		return catchupSource
+	}
+	return strings.NewReplacer(
+		CatchupPlaceholderChannelID, url.QueryEscape(channel.ChannelID),
+		CatchupPlaceholderChannelName, url.QueryEscape(channel.ChannelName),
+		CatchupPlaceholderTimeShiftLen, strconv.FormatInt(int64(channel.TimeShiftLength.Hours()), 10),
+	).Replace(catchupSource)
+}
+
+// NormalizeMulticastHost 校验组播地址是否为合法的ip:port格式，并返回规范化后的地址
+func NormalizeMulticastHost(host string) (string, error) {
+	ipStr, portStr, err := net.SplitHostPort(strings.TrimSpace(host))
+	if err != nil {
+		return "", fmt.Errorf("invalid multicast host %q: %w", host, err)
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return "", fmt.Errorf("invalid multicast ip: %q", ipStr)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid multicast port: %q", portStr)
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
 }
 
 // ToTxtFormat 转换为txt格式内容
-func ToTxtFormat(channels []Channel, udpxyURL string, multicastFirst bool) (string, error) {
+// groupRenameMap的含义与ToM3UFormat相同，改写后名称相同的分组合并输出
+func ToTxtFormat(channels []Channel, udpxyURL string, multicastFirst bool, groupRenameMap map[string]string) (string, error) {
 	if len(channels) == 0 {
 		return "", errors.New("no channels found")
 	}
+	channels = renameChannelGroups(channels, groupRenameMap)
 
 	// 对频道列表，按分组名称进行分组
 	groupNames := make([]string, 0)
@@ -170,23 +363,64 @@ func getChannelURLStr(channelURLs []url.URL, udpxyURL string, multicastFirst boo
 		return "", false, errors.New("no channel urls found")
 	}
 
-	var channelURL url.URL
-	if len(channelURLs) == 1 {
-		channelURL = channelURLs[0]
-	} else {
-		for _, channelURL = range channelURLs {
-			if (multicastFirst && channelURL.Scheme == SCHEME_IGMP) ||
-				(!multicastFirst && channelURL.Scheme != SCHEME_IGMP) {
-				break
-			}
-		}
-	}
-
+	channelURL := channelURLs[getChannelURLIndex(channelURLs, multicastFirst)]
 	isMulticastCh := channelURL.Scheme == SCHEME_IGMP
 	if udpxyURL != "" && isMulticastCh {
-		result, err := url.JoinPath(udpxyURL, fmt.Sprintf("/rtp/%s", channelURL.Host))
+		result, err := getMulticastRelayURL(udpxyURL, channelURL.Host)
 		return result, isMulticastCh, err
 	} else {
 		return channelURL.String(), isMulticastCh, nil
 	}
 }
+
+// getChannelURLIndex 频道存在多个URL地址时，根据是否优先使用组播地址选择其中一个，均不满足时使用最后一个
+func getChannelURLIndex(channelURLs []url.URL, multicastFirst bool) int {
+	for i, channelURL := range channelURLs {
+		if (multicastFirst && channelURL.Scheme == SCHEME_IGMP) ||
+			(!multicastFirst && channelURL.Scheme != SCHEME_IGMP) {
+			return i
+		}
+	}
+	return len(channelURLs) - 1
+}
+
+// WithMulticastRelayPath 为udpxy地址追加组播转单播的路径模板
+// udpxy地址中已包含占位符时，视为完整的地址模板，保持不变
+func WithMulticastRelayPath(udpxyURL, relayPath string) string {
+	if udpxyURL == "" || relayPath == "" || hasRelayPlaceholder(udpxyURL) {
+		return udpxyURL
+	}
+	return strings.TrimRight(udpxyURL, "/") + "/" + strings.TrimLeft(relayPath, "/")
+}
+
+// hasRelayPlaceholder 判断地址模板中是否包含组播地址的占位符
+func hasRelayPlaceholder(tmpl string) bool {
+	return strings.Contains(tmpl, RelayPlaceholderHost) ||
+		strings.Contains(tmpl, RelayPlaceholderAddr) ||
+		strings.Contains(tmpl, RelayPlaceholderPort)
+}
+
+// getMulticastRelayURL 根据udpxy的地址模板，获取组播转单播的地址
+func getMulticastRelayURL(udpxyURL, host string) (string, error) {
+	if !hasRelayPlaceholder(udpxyURL) {
+		udpxyURL = WithMulticastRelayPath(udpxyURL, DefaultMulticastRelayPath)
+	}
+
+	// IPv6组播地址包含方括号，e.g [ff15::1]:5000，${host}保留方括号，${addr}不包含方括号
+	addr, port, err := net.SplitHostPort(host)
+	if err != nil {
+		addr, port = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+	}
+	// 组播地址未指定端口时，不输出多余的冒号
+	result := strings.NewReplacer(
+		RelayPlaceholderAddr+":"+RelayPlaceholderPort, host,
+		RelayPlaceholderHost, host,
+		RelayPlaceholderAddr, addr,
+		RelayPlaceholderPort, port,
+	).Replace(udpxyURL)
+
+	if _, err = url.Parse(result); err != nil {
+		return "", err
+	}
+	return result, nil
+}
@@ -0,0 +1,35 @@
+package iptv
+
+import (
+	"net/url"
+	"slices"
+)
+
+// MergeDuplicateChannels 合并频道ID相同的频道，返回合并后的频道列表及被合并的频道数量
+// 保留首次出现的频道的名称、分组等信息，合并所有频道的地址（去除重复的地址），使组播与单播地址可以按需选择
+func MergeDuplicateChannels(channels []Channel) ([]Channel, int) {
+	indexMap := make(map[string]int, len(channels))
+	result := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		idx, ok := indexMap[channel.ChannelID]
+		if !ok {
+			indexMap[channel.ChannelID] = len(result)
+			result = append(result, channel)
+			continue
+		}
+
+		// 合并频道地址，避免修改原有的地址列表
+		merged := &result[idx]
+		merged.ChannelURLs = slices.Clip(merged.ChannelURLs)
+		for _, channelURL := range channel.ChannelURLs {
+			if !slices.ContainsFunc(merged.ChannelURLs, func(u url.URL) bool { return u.String() == channelURL.String() }) {
+				merged.ChannelURLs = append(merged.ChannelURLs, channelURL)
+			}
+		}
+		// 首个频道不支持时移时，使用重复频道的时移信息
+		if merged.TimeShiftURL == nil && channel.TimeShiftURL != nil {
+			merged.TimeShift, merged.TimeShiftLength, merged.TimeShiftURL = channel.TimeShift, channel.TimeShiftLength, channel.TimeShiftURL
+		}
+	}
+	return result, len(channels) - len(result)
+}
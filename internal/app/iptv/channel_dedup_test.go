@@ -0,0 +1,48 @@
+package iptv
+
+import (
+	"testing"
+)
+
+func TestMergeDuplicateChannels(t *testing.T) {
+	multicast := newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000")
+	multicast.TimeShiftURL = nil
+	unicast := newTestChannel(t, "1", "CCTV-1综合", "http://10.0.0.1/live/1", "igmp://239.1.1.1:5000")
+	unicast.GroupName = "其他"
+	channels := []Channel{
+		multicast,
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+		unicast,
+	}
+
+	got, merged := MergeDuplicateChannels(channels)
+	if merged != 1 || len(got) != 2 {
+		t.Fatalf("MergeDuplicateChannels() = %d channels, %d merged, want 2, 1", len(got), merged)
+	}
+
+	// 保留首个频道的名称及分组，合并去重后的地址
+	ch := got[0]
+	if ch.ChannelName != "CCTV1" || ch.GroupName != "央视" {
+		t.Errorf("merged channel = %s/%s, want 央视/CCTV1", ch.GroupName, ch.ChannelName)
+	}
+	if len(ch.ChannelURLs) != 2 || ch.ChannelURLs[0].String() != "igmp://239.1.1.1:5000" ||
+		ch.ChannelURLs[1].String() != "http://10.0.0.1/live/1" {
+		t.Errorf("merged urls = %v, want [igmp://239.1.1.1:5000 http://10.0.0.1/live/1]", ch.ChannelURLs)
+	}
+	// 首个频道没有时移地址时，使用重复频道的时移地址
+	if ch.TimeShiftURL == nil || ch.TimeShiftURL.String() != unicast.TimeShiftURL.String() {
+		t.Errorf("merged timeshift url = %v, want %v", ch.TimeShiftURL, unicast.TimeShiftURL)
+	}
+	if got[1].ChannelID != "2" {
+		t.Errorf("second channel = %s, want 2", got[1].ChannelID)
+	}
+
+	// 不修改原有频道的地址列表
+	if len(channels[0].ChannelURLs) != 1 {
+		t.Errorf("original urls = %v, want unchanged", channels[0].ChannelURLs)
+	}
+	// 选择地址时可以按需使用组播或单播地址
+	if urlStr, _, err := getChannelURLStr(ch.ChannelURLs, "", false); err != nil || urlStr != "http://10.0.0.1/live/1" {
+		t.Errorf("getChannelURLStr() = %s, %v, want the unicast url", urlStr, err)
+	}
+}
@@ -0,0 +1,51 @@
+package iptv
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"slices"
+)
+
+// ReadChannelSnapshot 读取上次保存的频道列表
+func ReadChannelSnapshot(r io.Reader) ([]Channel, error) {
+	var channels []Channel
+	if err := json.NewDecoder(r).Decode(&channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// WriteChannelSnapshot 保存本次获取的频道列表，供下次比较变化
+func WriteChannelSnapshot(w io.Writer, channels []Channel) error {
+	return json.NewEncoder(w).Encode(channels)
+}
+
+// GetChangedChannels 与上次的频道列表比较，返回新增或地址、名称、分组发生变化的频道
+func GetChangedChannels(prevChannels, channels []Channel) []Channel {
+	prevChannelMap := make(map[string]Channel, len(prevChannels))
+	for _, channel := range prevChannels {
+		prevChannelMap[channel.ChannelID] = channel
+	}
+
+	result := make([]Channel, 0)
+	for _, channel := range channels {
+		prevChannel, ok := prevChannelMap[channel.ChannelID]
+		if !ok || isChannelChanged(prevChannel, channel) {
+			result = append(result, channel)
+		}
+	}
+	return result
+}
+
+// isChannelChanged 判断频道的地址、名称或分组是否发生变化
+func isChannelChanged(prevChannel, channel Channel) bool {
+	if prevChannel.ChannelName != channel.ChannelName ||
+		prevChannel.GroupName != channel.GroupName {
+		return true
+	}
+
+	return !slices.EqualFunc(prevChannel.ChannelURLs, channel.ChannelURLs, func(a, b url.URL) bool {
+		return a.String() == b.String()
+	})
+}
@@ -0,0 +1,64 @@
+package iptv
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestGetChangedChannels(t *testing.T) {
+	prevChannels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.2:5000"),
+		newTestChannel(t, "3", "CCTV3", "igmp://239.1.1.3:5000"),
+		newTestChannel(t, "4", "CCTV4", "igmp://239.1.1.4:5000"),
+		newTestChannel(t, "5", "CCTV5", "igmp://239.1.1.5:5000"),
+	}
+
+	// 通过快照文件保存并读取上次的频道列表
+	var buf bytes.Buffer
+	if err := WriteChannelSnapshot(&buf, prevChannels); err != nil {
+		t.Fatalf("WriteChannelSnapshot() error = %v", err)
+	}
+	prevChannels, err := ReadChannelSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("ReadChannelSnapshot() error = %v", err)
+	}
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),                      // 未变化
+		newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.20:5000"),                     // 地址变化
+		newTestChannel(t, "3", "CCTV3高清", "igmp://239.1.1.3:5000"),                    // 名称变化
+		newTestChannel(t, "4", "CCTV4", "igmp://239.1.1.4:5000"),                      // 分组变化
+		newTestChannel(t, "6", "CCTV6", "igmp://239.1.1.6:5000"),                      // 新增
+		newTestChannel(t, "5", "CCTV5", "igmp://239.1.1.5:5000", "rtsp://10.0.0.1/5"), // 地址增加
+	}
+	channels[3].GroupName = "其他"
+
+	got := GetChangedChannels(prevChannels, channels)
+	gotIDs := make([]string, 0, len(got))
+	for _, channel := range got {
+		gotIDs = append(gotIDs, channel.ChannelID)
+	}
+	if want := []string{"2", "3", "4", "6", "5"}; !slices.Equal(gotIDs, want) {
+		t.Errorf("GetChangedChannels() = %v, want %v", gotIDs, want)
+	}
+
+	content, err := ToTxtFormat(got[:1], "", false, nil)
+	if err != nil {
+		t.Fatalf("ToTxtFormat() error = %v", err)
+	}
+	if want := "央视,#genre#\nCCTV2,igmp://239.1.1.20:5000\n"; content != want {
+		t.Errorf("ToTxtFormat() = %q, want %q", content, want)
+	}
+}
+
+func TestGetChangedChannelsNoPrevious(t *testing.T) {
+	channels := []Channel{newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000")}
+	if got := GetChangedChannels(nil, channels); len(got) != 1 {
+		t.Errorf("len(GetChangedChannels()) = %d, want 1", len(got))
+	}
+	if got := GetChangedChannels(channels, channels); len(got) != 0 {
+		t.Errorf("len(GetChangedChannels()) = %d, want 0", len(got))
+	}
+}
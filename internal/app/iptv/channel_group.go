@@ -2,10 +2,17 @@ package iptv
 
 import (
 	"regexp"
+	"slices"
+	"strings"
 )
 
 const otherChGroupName = "其他"
 
+const (
+	GroupUnlistedAppend = "append" // 未列出的分组按原有顺序追加在末尾
+	GroupUnlistedDrop   = "drop"   // 未列出的分组不输出
+)
+
 type ChannelGroupRules struct {
 	Name  string           // 分组名称
 	Rules []*regexp.Regexp // 分组规则
@@ -23,3 +30,93 @@ func GetChannelGroupName(chGroupRulesList []ChannelGroupRules, channelName strin
 	}
 	return otherChGroupName
 }
+
+// SetChannelDefaultGroup 为没有分组的频道设置缺省的分组名称，避免输出空的分组
+func SetChannelDefaultGroup(channels []Channel, defaultGroup string) {
+	if defaultGroup == "" {
+		return
+	}
+
+	for i := range channels {
+		if channels[i].GroupName == "" {
+			channels[i].GroupName = defaultGroup
+		}
+	}
+}
+
+// SortChannelsByGroupOrder 按指定的分组顺序重新排列频道，分组内的频道保持原有顺序
+// unlisted为GroupUnlistedDrop时丢弃未列出分组的频道，否则将其按原有顺序追加在末尾
+func SortChannelsByGroupOrder(channels []Channel, groups []string, unlisted string) []Channel {
+	if len(groups) == 0 {
+		return channels
+	}
+
+	groupIndexMap := make(map[string]int, len(groups))
+	for i, group := range groups {
+		if _, ok := groupIndexMap[group]; !ok {
+			groupIndexMap[group] = i
+		}
+	}
+
+	buckets := make([][]Channel, len(groups))
+	var unlistedChannels []Channel
+	for _, channel := range channels {
+		if i, ok := groupIndexMap[channel.GroupName]; ok {
+			buckets[i] = append(buckets[i], channel)
+		} else if unlisted != GroupUnlistedDrop {
+			unlistedChannels = append(unlistedChannels, channel)
+		}
+	}
+
+	result := make([]Channel, 0, len(channels))
+	for _, bucket := range buckets {
+		result = append(result, bucket...)
+	}
+	return append(result, unlistedChannels...)
+}
+
+// FilterChannelsByGroups 按分组名称过滤频道，分组名称不区分大小写
+// include为空时保留所有分组，exclude中的分组始终被过滤
+func FilterChannelsByGroups(channels []Channel, include, exclude []string) []Channel {
+	if len(include) == 0 && len(exclude) == 0 {
+		return channels
+	}
+
+	result := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if len(include) > 0 && !containsGroupName(include, channel.GroupName) {
+			continue
+		}
+		if containsGroupName(exclude, channel.GroupName) {
+			continue
+		}
+		result = append(result, channel)
+	}
+	return result
+}
+
+// containsGroupName 判断分组列表中是否包含指定的分组名称，不区分大小写
+func containsGroupName(groups []string, groupName string) bool {
+	for _, group := range groups {
+		if strings.EqualFold(strings.TrimSpace(group), groupName) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameChannelGroups 按映射改写频道的分组名称，返回新的频道列表，不修改原有的频道列表
+// 映射中不存在的分组保持不变
+func renameChannelGroups(channels []Channel, groupRenameMap map[string]string) []Channel {
+	if len(groupRenameMap) == 0 {
+		return channels
+	}
+
+	result := slices.Clone(channels)
+	for i := range result {
+		if groupName, ok := groupRenameMap[result[i].GroupName]; ok {
+			result[i].GroupName = groupName
+		}
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package iptv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetChannelDefaultGroup(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "测试频道", "igmp://239.1.1.2:5000"),
+	}
+	channels[1].GroupName = ""
+
+	// 未配置时保持不变
+	SetChannelDefaultGroup(channels, "")
+	if channels[1].GroupName != "" {
+		t.Fatalf("GroupName = %q, want empty", channels[1].GroupName)
+	}
+
+	SetChannelDefaultGroup(channels, "未分组")
+	if channels[0].GroupName != "央视" {
+		t.Errorf("channels[0].GroupName = %q, want 央视", channels[0].GroupName)
+	}
+	if channels[1].GroupName != "未分组" {
+		t.Errorf("channels[1].GroupName = %q, want 未分组", channels[1].GroupName)
+	}
+
+	m3u, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if strings.Contains(m3u, `group-title=""`) || !strings.Contains(m3u, `group-title="未分组"`) {
+		t.Errorf("ToM3UFormat() = %s, want group-title=\"未分组\"", m3u)
+	}
+
+	txt, err := ToTxtFormat(channels, "", false, nil)
+	if err != nil {
+		t.Fatalf("ToTxtFormat() error = %v", err)
+	}
+	if !strings.Contains(txt, "未分组,#genre#\n测试频道,") {
+		t.Errorf("ToTxtFormat() = %q, want group 未分组", txt)
+	}
+}
+
+func TestSortChannelsByGroupOrder(t *testing.T) {
+	newChannel := func(id, name, group string) Channel {
+		channel := newTestChannel(t, id, name, "igmp://239.1.1."+id+":5000")
+		channel.GroupName = group
+		return channel
+	}
+	channels := []Channel{
+		newChannel("1", "CCTV1", "央视"),
+		newChannel("2", "湖南卫视", "卫视"),
+		newChannel("3", "CCTV2", "央视"),
+		newChannel("4", "少儿频道", "少儿"),
+		newChannel("5", "东方卫视", "卫视"),
+	}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		unlisted string
+		want     []string
+	}{
+		{name: "none", want: []string{"1", "2", "3", "4", "5"}},
+		{name: "append_unlisted", groups: []string{"卫视", "少儿"}, unlisted: GroupUnlistedAppend, want: []string{"2", "5", "4", "1", "3"}},
+		{name: "default_append", groups: []string{"少儿"}, want: []string{"4", "1", "2", "3", "5"}},
+		{name: "drop_unlisted", groups: []string{"卫视", "不存在"}, unlisted: GroupUnlistedDrop, want: []string{"2", "5"}},
+		{name: "reverse", groups: []string{"少儿", "卫视", "央视"}, unlisted: GroupUnlistedDrop, want: []string{"4", "2", "5", "1", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SortChannelsByGroupOrder(channels, tt.groups, tt.unlisted)
+			ids := make([]string, 0, len(got))
+			for _, channel := range got {
+				ids = append(ids, channel.ChannelID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SortChannelsByGroupOrder() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterChannelsByGroups(t *testing.T) {
+	newChannel := func(id, group string) Channel {
+		channel := newTestChannel(t, id, "频道"+id, "igmp://239.1.1."+id+":5000")
+		channel.GroupName = group
+		return channel
+	}
+	channels := []Channel{
+		newChannel("1", "CCTV"),
+		newChannel("2", "卫视"),
+		newChannel("3", "湖南"),
+		newChannel("4", "其他"),
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "all", want: []string{"1", "2", "3", "4"}},
+		{name: "include_case_insensitive", include: []string{"cctv", " 湖南 "}, want: []string{"1", "3"}},
+		{name: "exclude", exclude: []string{"其他"}, want: []string{"1", "2", "3"}},
+		{name: "include_and_exclude", include: []string{"CCTV", "卫视"}, exclude: []string{"卫视"}, want: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FilterChannelsByGroups(channels, tt.include, tt.exclude)
+			ids := make([]string, 0, len(got))
+			for _, channel := range got {
+				ids = append(ids, channel.ChannelID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FilterChannelsByGroups() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameChannelGroups(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "金鹰卡通", "http://10.0.0.1/live/2"),
+		newTestChannel(t, "3", "卡酷少儿", "http://10.0.0.1/live/3"),
+	}
+	channels[1].GroupName = "少儿"
+	channels[2].GroupName = "卡通"
+	groupRenameMap := map[string]string{"少儿": "动画", "卡通": "动画", "不存在": "其他"}
+
+	m3u, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, GroupRenameMap: groupRenameMap})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if !strings.Contains(m3u, `group-title="央视",CCTV1`) || strings.Count(m3u, `group-title="动画"`) != 2 {
+		t.Errorf("ToM3UFormat() = %s, want renamed group-title", m3u)
+	}
+
+	// 改写后名称相同的分组合并输出
+	txt, err := ToTxtFormat(channels, "", false, groupRenameMap)
+	if err != nil {
+		t.Fatalf("ToTxtFormat() error = %v", err)
+	}
+	want := "央视,#genre#\nCCTV1,http://10.0.0.1/live/1\n动画,#genre#\n金鹰卡通,http://10.0.0.1/live/2\n卡酷少儿,http://10.0.0.1/live/3\n"
+	if txt != want {
+		t.Errorf("ToTxtFormat() = %q, want %q", txt, want)
+	}
+
+	// 不修改频道原有的分组名称
+	if channels[1].GroupName != "少儿" || channels[2].GroupName != "卡通" {
+		t.Errorf("GroupName = %q, %q, want unchanged", channels[1].GroupName, channels[2].GroupName)
+	}
+}
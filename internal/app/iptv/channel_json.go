@@ -0,0 +1,116 @@
+package iptv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// 频道地址的流类型，供前端判断如何播放或转发
+const (
+	StreamTypeMulticast = "multicast" // 组播地址，需要组播网络或udpxy转发
+	StreamTypeUnicast   = "unicast"   // 单播地址，包括经udpxy转为单播的组播地址
+	StreamTypeHLS       = "hls"       // HLS单播地址（.m3u8）
+)
+
+// jsonChannel JSON格式输出的频道信息
+type jsonChannel struct {
+	ChannelID     string           `json:"channelID"`         // 频道ID
+	ChannelName   string           `json:"channelName"`       // 频道名称
+	UserChannelID string           `json:"userChannelID"`     // 频道号
+	TvgID         string           `json:"tvgId"`             // 输出的tvg-id
+	GroupName     string           `json:"groupName"`         // 频道分组
+	LogoName      string           `json:"logoName"`          // 频道台标名称
+	LogoURL       string           `json:"logoUrl,omitempty"` // 台标的访问地址，台标文件不存在时不输出
+	URL           string           `json:"url"`               // 实际播放使用的地址
+	StreamType    string           `json:"streamType"`        // 实际播放使用的地址的流类型，e.g multicast、unicast、hls
+	Catchup       *jsonCatchup     `json:"catchup,omitempty"` // 回看信息，频道不支持回看时不输出
+	URLs          []jsonChannelURL `json:"urls,omitempty"`    // 上游返回的所有原始地址，仅verbose时输出
+}
+
+// jsonCatchup 频道的回看信息
+type jsonCatchup struct {
+	Source string `json:"source"` // 完整的回看地址，包含开始及结束时间的占位符
+	Days   int64  `json:"days"`   // 回看天数
+}
+
+// jsonChannelURL 频道的原始地址，用于排查组播及单播地址的选择
+type jsonChannelURL struct {
+	URL    string `json:"url"`    // 原始地址
+	Scheme string `json:"scheme"` // 地址的协议，e.g igmp、rtsp、http
+	Chosen bool   `json:"chosen"` // 是否为实际选择的地址
+}
+
+// ToJSONFormat 转换为JSON格式内容，播放地址的选择与m3u格式保持一致
+// logoBaseUrl、catchupSource、maxCatchupDays及logoDir的含义与ToM3UFormat相同
+// verbose为true时，额外输出频道的所有原始地址及实际选择的地址，便于排查multicastFirst及udpxy的选择结果
+func ToJSONFormat(channels []Channel, udpxyURL, catchupSource string, multicastFirst bool, logoBaseUrl string,
+	maxCatchupDays int, logoDir string, verbose bool) (string, error) {
+	if len(channels) == 0 {
+		return "", errors.New("no channels found")
+	}
+
+	logoDir, err := ResolveLogoDir(logoDir)
+	if err != nil {
+		return "", err
+	}
+
+	result := make([]jsonChannel, 0, len(channels))
+	for _, channel := range channels {
+		// 根据指定条件，获取频道URL地址
+		channelURLStr, isMulticastCh, err := getChannelURLStr(channel.ChannelURLs, udpxyURL, multicastFirst)
+		if err != nil {
+			return "", err
+		}
+
+		jsonCh := jsonChannel{
+			ChannelID:     channel.ChannelID,
+			ChannelName:   channel.ChannelName,
+			UserChannelID: channel.UserChannelID,
+			TvgID:         channel.GetTvgID(),
+			GroupName:     channel.GroupName,
+			LogoName:      channel.LogoName,
+			LogoURL:       getExistingChannelLogoURL(channel.LogoName, logoBaseUrl, logoDir, false),
+			URL:           channelURLStr,
+			StreamType:    getStreamType(channelURLStr, isMulticastCh && udpxyURL == ""),
+		}
+		if chCatchupSource := GetChannelCatchupSource(&channel, catchupSource); chCatchupSource != "" {
+			jsonCh.Catchup = &jsonCatchup{
+				Source: chCatchupSource,
+				Days:   getCatchupDays(&channel, maxCatchupDays, nil),
+			}
+		}
+		if verbose {
+			chosenIndex := getChannelURLIndex(channel.ChannelURLs, multicastFirst)
+			jsonCh.URLs = make([]jsonChannelURL, 0, len(channel.ChannelURLs))
+			for i, channelURL := range channel.ChannelURLs {
+				jsonCh.URLs = append(jsonCh.URLs, jsonChannelURL{
+					URL:    channelURL.String(),
+					Scheme: channelURL.Scheme,
+					Chosen: i == chosenIndex,
+				})
+			}
+		}
+		result = append(result, jsonCh)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// getStreamType 根据实际播放使用的地址获取流类型，未经udpxy转发的组播地址为multicast，.m3u8结尾的地址为hls
+func getStreamType(channelURLStr string, isMulticast bool) string {
+	if isMulticast {
+		return StreamTypeMulticast
+	}
+
+	if u, err := url.Parse(channelURLStr); err == nil && strings.EqualFold(path.Ext(u.Path), ".m3u8") {
+		return StreamTypeHLS
+	}
+	return StreamTypeUnicast
+}
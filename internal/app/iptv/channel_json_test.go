@@ -0,0 +1,111 @@
+package iptv
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToJSONFormatVerbose(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "rtsp://10.0.0.1/live/1", "igmp://239.1.1.1:5000", "http://10.0.0.2/live/1"),
+	}
+
+	// 缺省不输出原始地址
+	content, err := ToJSONFormat(channels, "http://192.168.1.1:4022", "", true, "", 0, "", false)
+	if err != nil {
+		t.Fatalf("ToJSONFormat() error = %v", err)
+	}
+	var got []jsonChannel
+	if err = json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(got) != 1 || got[0].URL != "http://192.168.1.1:4022/rtp/239.1.1.1:5000" {
+		t.Fatalf("ToJSONFormat() = %+v", got)
+	}
+	if got[0].URLs != nil {
+		t.Errorf("URLs = %+v, want nil", got[0].URLs)
+	}
+
+	content, err = ToJSONFormat(channels, "http://192.168.1.1:4022", "", true, "", 0, "", true)
+	if err != nil {
+		t.Fatalf("ToJSONFormat() error = %v", err)
+	}
+	got = nil
+	if err = json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := []jsonChannelURL{
+		{URL: "rtsp://10.0.0.1/live/1", Scheme: "rtsp"},
+		{URL: "igmp://239.1.1.1:5000", Scheme: "igmp", Chosen: true},
+		{URL: "http://10.0.0.2/live/1", Scheme: "http"},
+	}
+	if len(got[0].URLs) != len(want) {
+		t.Fatalf("len(URLs) = %d, want %d", len(got[0].URLs), len(want))
+	}
+	for i := range want {
+		if got[0].URLs[i] != want[i] {
+			t.Errorf("URLs[%d] = %+v, want %+v", i, got[0].URLs[i], want[i])
+		}
+	}
+}
+
+func TestToJSONFormatStreamType(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+		newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3/index.M3U8?token=abc"),
+	}
+
+	tests := []struct {
+		name     string
+		udpxyURL string
+		want     []string
+	}{
+		{"multicast", "", []string{StreamTypeMulticast, StreamTypeUnicast, StreamTypeHLS}},
+		{"udpxy", "http://192.168.1.1:4022", []string{StreamTypeUnicast, StreamTypeUnicast, StreamTypeHLS}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := ToJSONFormat(channels, tt.udpxyURL, "", true, "", 0, "", false)
+			if err != nil {
+				t.Fatalf("ToJSONFormat() error = %v", err)
+			}
+			var got []jsonChannel
+			if err = json.Unmarshal([]byte(content), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			for i, want := range tt.want {
+				if got[i].StreamType != want {
+					t.Errorf("%s streamType = %q, want %q", got[i].URL, got[i].StreamType, want)
+				}
+			}
+		})
+	}
+}
+
+func TestToJSONFormatCatchup(t *testing.T) {
+	noTimeShift := newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2")
+	noTimeShift.TimeShift = "0"
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		noTimeShift,
+	}
+
+	content, err := ToJSONFormat(channels, "", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", true, "", 2, "", false)
+	if err != nil {
+		t.Fatalf("ToJSONFormat() error = %v", err)
+	}
+	var got []jsonChannel
+	if err = json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := jsonCatchup{Source: "http://10.0.0.1/timeshift/1?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", Days: 2}
+	if got[0].Catchup == nil || *got[0].Catchup != want {
+		t.Errorf("Catchup = %+v, want %+v", got[0].Catchup, want)
+	}
+	if got[1].Catchup != nil {
+		t.Errorf("Catchup = %+v, want nil", got[1].Catchup)
+	}
+}
@@ -0,0 +1,41 @@
+package iptv
+
+import (
+	"strconv"
+)
+
+// CheckChannelNumbers 检查重复的频道号（tvg-chno），返回重复的频道号及对应的频道名称列表
+// renumber为true时，保留首个频道的频道号，其余重复的频道依次使用当前最大频道号之后的编号
+func CheckChannelNumbers(channels []Channel, renumber bool) map[string][]string {
+	chNameMap := make(map[string][]string)
+	maxNumber := 0
+	for _, channel := range channels {
+		chNameMap[channel.UserChannelID] = append(chNameMap[channel.UserChannelID], channel.ChannelName)
+		if number, err := strconv.Atoi(channel.UserChannelID); err == nil && number > maxNumber {
+			maxNumber = number
+		}
+	}
+
+	duplicates := make(map[string][]string)
+	for number, chNames := range chNameMap {
+		if len(chNames) > 1 {
+			duplicates[number] = chNames
+		}
+	}
+	if !renumber || len(duplicates) == 0 {
+		return duplicates
+	}
+
+	// 对重复的频道重新编号
+	seen := make(map[string]struct{}, len(channels))
+	for i := range channels {
+		if _, ok := seen[channels[i].UserChannelID]; !ok {
+			seen[channels[i].UserChannelID] = struct{}{}
+			continue
+		}
+
+		maxNumber++
+		channels[i].UserChannelID = strconv.Itoa(maxNumber)
+	}
+	return duplicates
+}
@@ -0,0 +1,62 @@
+package iptv
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckChannelNumbers(t *testing.T) {
+	newChannels := func() []Channel {
+		return []Channel{
+			{ChannelID: "1", ChannelName: "CCTV1", UserChannelID: "1"},
+			{ChannelID: "2", ChannelName: "CCTV1高清", UserChannelID: "1"},
+			{ChannelID: "3", ChannelName: "CCTV2", UserChannelID: "2"},
+			{ChannelID: "4", ChannelName: "CCTV5", UserChannelID: "5"},
+			{ChannelID: "5", ChannelName: "CCTV5+", UserChannelID: "5"},
+			{ChannelID: "6", ChannelName: "CCTV5体育", UserChannelID: "5"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		renumber bool
+		want     []string
+	}{
+		{name: "warn_only", renumber: false, want: []string{"1", "1", "2", "5", "5", "5"}},
+		{name: "renumber", renumber: true, want: []string{"1", "6", "2", "5", "7", "8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := newChannels()
+			duplicates := CheckChannelNumbers(channels, tt.renumber)
+			if len(duplicates) != 2 {
+				t.Fatalf("len(duplicates) = %d, want 2: %v", len(duplicates), duplicates)
+			}
+			if !slices.Equal(duplicates["1"], []string{"CCTV1", "CCTV1高清"}) {
+				t.Errorf("duplicates[1] = %v", duplicates["1"])
+			}
+			if !slices.Equal(duplicates["5"], []string{"CCTV5", "CCTV5+", "CCTV5体育"}) {
+				t.Errorf("duplicates[5] = %v", duplicates["5"])
+			}
+
+			got := make([]string, 0, len(channels))
+			for _, channel := range channels {
+				got = append(got, channel.UserChannelID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("UserChannelIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckChannelNumbersUnique(t *testing.T) {
+	channels := []Channel{
+		{ChannelName: "CCTV1", UserChannelID: "1"},
+		{ChannelName: "CCTV2", UserChannelID: "2"},
+	}
+	if duplicates := CheckChannelNumbers(channels, true); len(duplicates) != 0 {
+		t.Errorf("unexpected duplicates: %v", duplicates)
+	}
+}
@@ -0,0 +1,27 @@
+package iptv
+
+import (
+	"regexp"
+)
+
+// ChannelRules 频道的过滤、分组及台标规则
+type ChannelRules struct {
+	ExcludeRule    *regexp.Regexp      // 频道的过滤规则
+	GroupRulesList []ChannelGroupRules // 频道分组的规则
+	LogoRuleList   []ChannelLogoRule   // 频道台标的匹配规则
+}
+
+// ApplyChannelRules 按规则重新过滤频道，并根据频道名称重新识别分组及台标，返回新的频道列表
+func ApplyChannelRules(channels []Channel, rules *ChannelRules) []Channel {
+	result := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if rules.ExcludeRule != nil && rules.ExcludeRule.MatchString(channel.ChannelName) {
+			continue
+		}
+
+		channel.GroupName = GetChannelGroupName(rules.GroupRulesList, channel.ChannelName)
+		channel.LogoName = GetChannelLogoName(rules.LogoRuleList, channel.ChannelName)
+		result = append(result, channel)
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package iptv
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+)
+
+const (
+	ChannelSortNone = "none" // 保持上游返回的频道顺序
+	ChannelSortChNo = "chno" // 按频道号排序
+	ChannelSortName = "name" // 按频道名称排序
+)
+
+// IsValidChannelSort 判断是否为支持的频道排序方式
+func IsValidChannelSort(sortBy string) bool {
+	return sortBy == ChannelSortNone || sortBy == ChannelSortChNo || sortBy == ChannelSortName
+}
+
+// SortChannels 按指定的方式对频道进行稳定排序，返回排序后的新列表，不修改原有的频道列表
+// sortBy为ChannelSortNone或不支持的排序方式时，直接返回原有的频道列表
+func SortChannels(channels []Channel, sortBy string) []Channel {
+	var compare func(a, b Channel) int
+	switch sortBy {
+	case ChannelSortChNo:
+		compare = func(a, b Channel) int {
+			return compareChannelNumber(a.UserChannelID, b.UserChannelID)
+		}
+	case ChannelSortName:
+		compare = func(a, b Channel) int {
+			return cmp.Compare(a.ChannelName, b.ChannelName)
+		}
+	default:
+		return channels
+	}
+
+	result := slices.Clone(channels)
+	slices.SortStableFunc(result, compare)
+	return result
+}
+
+// compareChannelNumber 比较频道号，均为数字时按数值比较，数字排在非数字之前，其他情况按字符串比较
+func compareChannelNumber(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(aNum, bNum)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	default:
+		return cmp.Compare(a, b)
+	}
+}
@@ -0,0 +1,47 @@
+package iptv
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSortChannels(t *testing.T) {
+	newChannel := func(chNo, name string) Channel {
+		return Channel{ChannelID: name, UserChannelID: chNo, ChannelName: name}
+	}
+	channels := []Channel{
+		newChannel("10", "CCTV10"),
+		newChannel("2", "CCTV2"),
+		newChannel("A1", "BTV"),
+		newChannel("1", "CCTV1"),
+		newChannel("", "AHTV"),
+	}
+
+	tests := []struct {
+		sortBy string
+		want   []string
+	}{
+		{sortBy: ChannelSortNone, want: []string{"CCTV10", "CCTV2", "BTV", "CCTV1", "AHTV"}},
+		{sortBy: "unknown", want: []string{"CCTV10", "CCTV2", "BTV", "CCTV1", "AHTV"}},
+		{sortBy: ChannelSortChNo, want: []string{"CCTV1", "CCTV2", "CCTV10", "AHTV", "BTV"}},
+		{sortBy: ChannelSortName, want: []string{"AHTV", "BTV", "CCTV1", "CCTV10", "CCTV2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			got := SortChannels(channels, tt.sortBy)
+			names := make([]string, 0, len(got))
+			for _, channel := range got {
+				names = append(names, channel.ChannelName)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("SortChannels() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	// 不修改原有的频道列表
+	if channels[0].ChannelName != "CCTV10" {
+		t.Errorf("original channels modified: %v", channels)
+	}
+}
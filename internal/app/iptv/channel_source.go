@@ -0,0 +1,117 @@
+package iptv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	ChannelSourceTypeDefault = ""     // 缺省从IPTV平台的接口获取频道列表
+	ChannelSourceTypeFile    = "file" // 从本地的静态文件中读取频道列表
+)
+
+// ChannelSource 频道列表的来源
+type ChannelSource interface {
+	// GetAllChannelList 获取频道列表
+	GetAllChannelList(ctx context.Context) ([]Channel, error)
+}
+
+// channelSourceClient 使用自定义的频道来源获取频道列表，节目单仍由原客户端获取
+type channelSourceClient struct {
+	Client
+	source ChannelSource
+}
+
+// WithChannelSource 替换客户端的频道列表来源
+func WithChannelSource(client Client, source ChannelSource) Client {
+	return &channelSourceClient{
+		Client: client,
+		source: source,
+	}
+}
+
+func (c *channelSourceClient) GetAllChannelList(ctx context.Context) ([]Channel, error) {
+	return c.source.GetAllChannelList(ctx)
+}
+
+// fileChannel 频道列表文件中的频道信息
+type fileChannel struct {
+	ChannelID       string   `json:"channelID"`                 // 频道ID
+	ChannelName     string   `json:"channelName"`               // 频道名称
+	UserChannelID   string   `json:"userChannelID,omitempty"`   // 频道号
+	ChannelURLs     []string `json:"channelURLs"`               // 频道URL列表
+	TimeShift       string   `json:"timeShift,omitempty"`       // 时移类型
+	TimeShiftLength int64    `json:"timeShiftLength,omitempty"` // 支持的时移长度，单位为分钟
+	TimeShiftURL    string   `json:"timeShiftURL,omitempty"`    // 时移地址（回放地址）
+	GroupName       string   `json:"groupName,omitempty"`       // 频道分类
+	LogoName        string   `json:"logoName,omitempty"`        // 频道台标名称
+}
+
+// FileChannelSource 从JSON格式的静态文件中读取频道列表
+type FileChannelSource struct {
+	filePath string
+}
+
+var _ ChannelSource = (*FileChannelSource)(nil)
+
+func NewFileChannelSource(filePath string) *FileChannelSource {
+	return &FileChannelSource{filePath: filePath}
+}
+
+func (s *FileChannelSource) GetAllChannelList(ctx context.Context) ([]Channel, error) {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileChannels []fileChannel
+	if err = json.Unmarshal(data, &fileChannels); err != nil {
+		return nil, fmt.Errorf("parse channel file failed: %w", err)
+	}
+
+	channels := make([]Channel, 0, len(fileChannels))
+	for _, fileCh := range fileChannels {
+		if fileCh.ChannelID == "" || fileCh.ChannelName == "" {
+			return nil, fmt.Errorf("channel id and name are required: %+v", fileCh)
+		}
+
+		// 解析频道URL
+		channelURLs := make([]url.URL, 0, len(fileCh.ChannelURLs))
+		for _, rawURL := range fileCh.ChannelURLs {
+			channelURL, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url of channel %s: %w", fileCh.ChannelName, err)
+			}
+			channelURLs = append(channelURLs, *channelURL)
+		}
+		if len(channelURLs) == 0 {
+			return nil, fmt.Errorf("no url of channel %s", fileCh.ChannelName)
+		}
+
+		// 解析时移地址
+		var timeShiftURL *url.URL
+		if fileCh.TimeShiftURL != "" {
+			timeShiftURL, err = url.Parse(fileCh.TimeShiftURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeshift url of channel %s: %w", fileCh.ChannelName, err)
+			}
+		}
+
+		channels = append(channels, Channel{
+			ChannelID:       fileCh.ChannelID,
+			ChannelName:     fileCh.ChannelName,
+			UserChannelID:   fileCh.UserChannelID,
+			ChannelURLs:     channelURLs,
+			TimeShift:       fileCh.TimeShift,
+			TimeShiftLength: time.Duration(fileCh.TimeShiftLength) * time.Minute,
+			TimeShiftURL:    timeShiftURL,
+			GroupName:       fileCh.GroupName,
+			LogoName:        fileCh.LogoName,
+		})
+	}
+	return channels, nil
+}
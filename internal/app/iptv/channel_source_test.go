@@ -0,0 +1,117 @@
+package iptv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubClient 用于测试的IPTV客户端
+type stubClient struct {
+	channels []Channel
+}
+
+func (c *stubClient) GetAllChannelList(ctx context.Context) ([]Channel, error) {
+	return c.channels, nil
+}
+
+func (c *stubClient) GetAllChannelProgramList(ctx context.Context, channels []Channel) ([]ChannelProgramList, error) {
+	chProgLists := make([]ChannelProgramList, 0, len(channels))
+	for _, channel := range channels {
+		chProgLists = append(chProgLists, ChannelProgramList{ChannelId: channel.ChannelID, ChannelName: channel.ChannelName})
+	}
+	return chProgLists, nil
+}
+
+func TestFileChannelSource(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "channels.json")
+	content := `[
+  {
+    "channelID": "1",
+    "channelName": "CCTV1",
+    "userChannelID": "1",
+    "channelURLs": ["igmp://239.1.1.1:5000", "http://10.0.0.1/live/1"],
+    "timeShift": "1",
+    "timeShiftLength": 4320,
+    "timeShiftURL": "http://10.0.0.1/timeshift/1",
+    "groupName": "央视",
+    "logoName": "CCTV1"
+  },
+  {
+    "channelID": "2",
+    "channelName": "CCTV2",
+    "channelURLs": ["http://10.0.0.1/live/2"]
+  }
+]`
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write channel file: %v", err)
+	}
+
+	client := WithChannelSource(&stubClient{
+		channels: []Channel{{ChannelID: "100", ChannelName: "Portal"}},
+	}, NewFileChannelSource(filePath))
+
+	channels, err := client.GetAllChannelList(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllChannelList() error = %v", err)
+	}
+	if len(channels) != 2 {
+		t.Fatalf("len(channels) = %d, want 2", len(channels))
+	}
+
+	ch := channels[0]
+	if ch.ChannelID != "1" || ch.ChannelName != "CCTV1" || ch.UserChannelID != "1" ||
+		ch.GroupName != "央视" || ch.LogoName != "CCTV1" || ch.TimeShift != "1" {
+		t.Errorf("unexpected channel: %+v", ch)
+	}
+	if len(ch.ChannelURLs) != 2 || ch.ChannelURLs[0].Scheme != SCHEME_IGMP || ch.ChannelURLs[0].Host != "239.1.1.1:5000" {
+		t.Errorf("ChannelURLs = %v", ch.ChannelURLs)
+	}
+	if ch.TimeShiftLength != 72*time.Hour {
+		t.Errorf("TimeShiftLength = %v, want 72h", ch.TimeShiftLength)
+	}
+	if ch.TimeShiftURL == nil || ch.TimeShiftURL.String() != "http://10.0.0.1/timeshift/1" {
+		t.Errorf("TimeShiftURL = %v", ch.TimeShiftURL)
+	}
+	if channels[1].TimeShiftURL != nil {
+		t.Errorf("TimeShiftURL = %v, want nil", channels[1].TimeShiftURL)
+	}
+
+	// 节目单仍由原客户端获取
+	chProgLists, err := client.GetAllChannelProgramList(context.Background(), channels)
+	if err != nil {
+		t.Fatalf("GetAllChannelProgramList() error = %v", err)
+	}
+	if len(chProgLists) != 2 || chProgLists[0].ChannelId != "1" {
+		t.Errorf("unexpected program lists: %+v", chProgLists)
+	}
+}
+
+func TestFileChannelSourceInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid_json", content: `{`},
+		{name: "missing_name", content: `[{"channelID": "1", "channelURLs": ["http://10.0.0.1/live/1"]}]`},
+		{name: "missing_url", content: `[{"channelID": "1", "channelName": "CCTV1"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "channels.json")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write channel file: %v", err)
+			}
+			if _, err := NewFileChannelSource(filePath).GetAllChannelList(context.Background()); err == nil {
+				t.Error("GetAllChannelList() error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := NewFileChannelSource(filepath.Join(t.TempDir(), "missing.json")).GetAllChannelList(context.Background()); err == nil {
+		t.Error("GetAllChannelList() error = nil for missing file, want error")
+	}
+}
@@ -0,0 +1,771 @@
+package iptv
+
+import (
+	"iptv/internal/pkg/util"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustParseURLs 将URL字符串列表转换为url.URL列表
+func mustParseURLs(t *testing.T, rawURLs ...string) []url.URL {
+	t.Helper()
+	urls := make([]url.URL, 0, len(rawURLs))
+	for _, rawURL := range rawURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("failed to parse url %q: %v", rawURL, err)
+		}
+		urls = append(urls, *u)
+	}
+	return urls
+}
+
+// newTestChannel 创建用于测试的频道
+func newTestChannel(t *testing.T, id, name string, rawURLs ...string) Channel {
+	t.Helper()
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/" + id + "?a=1")
+	return Channel{
+		ChannelID:       id,
+		ChannelName:     name,
+		UserChannelID:   id,
+		ChannelURLs:     mustParseURLs(t, rawURLs...),
+		TimeShift:       "1",
+		TimeShiftLength: 72 * time.Hour,
+		TimeShiftURL:    timeShiftURL,
+		GroupName:       "央视",
+	}
+}
+
+func TestToM3UFormatCatchupProxy(t *testing.T) {
+	noTimeShift := newTestChannel(t, "3", "CCTV3", "igmp://239.1.1.3:5000")
+	noTimeShift.TimeShift = "0"
+	noTimeShiftURL := newTestChannel(t, "4", "CCTV4", "http://10.0.0.1/live/4")
+	noTimeShiftURL.TimeShiftURL = nil
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+		noTimeShift,
+		noTimeShiftURL,
+	}
+
+	tests := []struct {
+		name          string
+		catchupSource string
+		want          []string
+		notWant       []string
+	}{
+		{
+			name:          "proxy_with_channel_id",
+			catchupSource: "http://192.168.1.2:8080/record/${channelId}?start=${(b)yyyyMMddHHmmss}&end=${(e)yyyyMMddHHmmss}",
+			want: []string{
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="default" catchup-source="http://192.168.1.2:8080/record/1?start=${(b)yyyyMMddHHmmss}&end=${(e)yyyyMMddHHmmss}" catchup-days="3"`,
+				`tvg-id="2" tvg-chno="2" tvg-name="CCTV2" catchup="default" catchup-source="http://192.168.1.2:8080/record/2?start=${(b)yyyyMMddHHmmss}&end=${(e)yyyyMMddHHmmss}" catchup-days="3"`,
+				`tvg-id="4" tvg-chno="4" tvg-name="CCTV4" catchup="default" catchup-source="http://192.168.1.2:8080/record/4?start=${(b)yyyyMMddHHmmss}&end=${(e)yyyyMMddHHmmss}" catchup-days="3"`,
+			},
+			notWant: []string{
+				`tvg-id="3" tvg-chno="3" tvg-name="CCTV3" catchup=`,
+				"10.0.0.1/timeshift",
+			},
+		},
+		{
+			name:          "proxy_https_without_placeholder",
+			catchupSource: "https://dvr.example.com/replay?ts=${timestamp}",
+			want: []string{
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="default" catchup-source="https://dvr.example.com/replay?ts=${timestamp}"`,
+			},
+		},
+		{
+			name:          "append_to_timeshift_url",
+			catchupSource: "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+			want: []string{
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="default" catchup-source="http://10.0.0.1/timeshift/1?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"`,
+				`tvg-id="2" tvg-chno="2" tvg-name="CCTV2" catchup="append" catchup-source="?playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"`,
+			},
+			notWant: []string{
+				`tvg-id="4" tvg-chno="4" tvg-name="CCTV4" catchup=`,
+			},
+		},
+		{
+			name:          "append_with_channel_placeholders",
+			catchupSource: "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}&cid=${channelId}&name=${channelName}&len=${timeshiftLen}",
+			want: []string{
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="default" catchup-source="http://10.0.0.1/timeshift/1?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}&cid=1&name=CCTV1&len=72"`,
+				`tvg-id="2" tvg-chno="2" tvg-name="CCTV2" catchup="append" catchup-source="?playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}&cid=2&name=CCTV2&len=72"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", tt.catchupSource, true, M3UOptions{ExtInfDuration: -1})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("content missing %q\n%s", want, content)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(content, notWant) {
+					t.Errorf("content unexpectedly contains %q\n%s", notWant, content)
+				}
+			}
+		})
+	}
+}
+
+func TestToM3UFormatDRM(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1.mpd"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2.mpd"),
+		newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3.m3u8"),
+	}
+	SetChannelDRM(channels, map[string]ChannelDRM{
+		"CCTV1": {LicenseType: "clearkey", LicenseKey: "0123:4567"},
+		"2":     {LicenseKey: "https://license.example.com/wv"},
+	})
+
+	content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+
+	want := `#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1
+#KODIPROP:inputstream=inputstream.adaptive
+#KODIPROP:inputstream.adaptive.license_type=clearkey
+#KODIPROP:inputstream.adaptive.license_key=0123:4567
+http://10.0.0.1/live/1.mpd
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" group-title="央视",CCTV2
+#KODIPROP:inputstream=inputstream.adaptive
+#KODIPROP:inputstream.adaptive.license_key=https://license.example.com/wv
+http://10.0.0.1/live/2.mpd
+#EXTINF:-1 tvg-id="3" tvg-chno="3" tvg-name="CCTV3" group-title="央视",CCTV3
+http://10.0.0.1/live/3.m3u8
+`
+	if content != "#EXTM3U\n"+want {
+		t.Errorf("ToM3UFormat() =\n%s\nwant:\n#EXTM3U\n%s", content, want)
+	}
+}
+
+func TestToM3UFormatLocale(t *testing.T) {
+	intl := newTestChannel(t, "2", "CGTN", "http://10.0.0.1/live/2")
+	intl.GroupName = "国际"
+	local := newTestChannel(t, "3", "SCTV", "http://10.0.0.1/live/3")
+	local.GroupName = "地方"
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		intl,
+		local,
+	}
+
+	tests := []struct {
+		name           string
+		defaultLocale  ChannelLocale
+		groupLocaleMap map[string]ChannelLocale
+		want           []string
+		notWant        []string
+	}{
+		{
+			name:          "global_and_group",
+			defaultLocale: ChannelLocale{Country: "CN", Language: "zh"},
+			groupLocaleMap: map[string]ChannelLocale{
+				"国际": {Language: "en"},
+			},
+			want: []string{
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" tvg-country="CN" tvg-language="zh" group-title="央视"`,
+				`tvg-id="2" tvg-chno="2" tvg-name="CGTN" tvg-country="CN" tvg-language="en" group-title="国际"`,
+				`tvg-id="3" tvg-chno="3" tvg-name="SCTV" tvg-country="CN" tvg-language="zh" group-title="地方"`,
+			},
+		},
+		{
+			name: "group_only",
+			groupLocaleMap: map[string]ChannelLocale{
+				"地方": {Country: "CN"},
+			},
+			want: []string{
+				`tvg-id="3" tvg-chno="3" tvg-name="SCTV" tvg-country="CN" group-title="地方"`,
+			},
+			notWant: []string{
+				"tvg-language",
+				`tvg-id="1" tvg-chno="1" tvg-name="CCTV1" tvg-country`,
+			},
+		},
+		{
+			name:    "unset",
+			notWant: []string{"tvg-country", "tvg-language"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetChannelLocale(channels, tt.defaultLocale, tt.groupLocaleMap)
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("content missing %q\n%s", want, content)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(content, notWant) {
+					t.Errorf("content unexpectedly contains %q\n%s", notWant, content)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeMulticastHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", host: "239.1.1.1:5000", want: "239.1.1.1:5000"},
+		{name: "port_leading_zero", host: "239.1.1.1:05000", want: "239.1.1.1:5000"},
+		{name: "ipv6", host: "[ff3e::1]:5000", want: "[ff3e::1]:5000"},
+		{name: "missing_port", host: "239.1.1.1", wantErr: true},
+		{name: "invalid_ip", host: "239.1.1.256:5000", wantErr: true},
+		{name: "hostname", host: "multicast.local:5000", wantErr: true},
+		{name: "port_out_of_range", host: "239.1.1.1:70000", wantErr: true},
+		{name: "empty", host: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeMulticastHost(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeMulticastHost(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeMulticastHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToM3UFormatLogo(t *testing.T) {
+	// 在程序所在目录中准备台标文件
+	currDir, err := util.GetCurrentAbPathByExecutable()
+	if err != nil {
+		t.Fatalf("failed to get current dir: %v", err)
+	}
+	logoDir := filepath.Join(currDir, logoDirName)
+	if err = os.MkdirAll(logoDir, 0755); err != nil {
+		t.Fatalf("failed to create logo dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(logoDir) })
+	if err = os.WriteFile(filepath.Join(logoDir, "CCTV1.png"), nil, 0644); err != nil {
+		t.Fatalf("failed to create logo file: %v", err)
+	}
+
+	channel := newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1")
+	channel.LogoName = "CCTV1"
+	noLogo := newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2")
+	noLogo.LogoName = "CCTV2"
+	channels := []Channel{channel, noLogo}
+
+	tests := []struct {
+		name        string
+		logoBaseUrl string
+		want        string
+	}{
+		{name: "absolute", logoBaseUrl: "http://192.168.1.2:8080/logo", want: `tvg-logo="http://192.168.1.2:8080/logo/CCTV1.png"`},
+		{name: "relative", logoBaseUrl: "/logo", want: `tvg-logo="/logo/CCTV1.png"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{LogoBaseURL: tt.logoBaseUrl, ExtInfDuration: -1})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			if !strings.Contains(content, `tvg-id="1" tvg-chno="1" tvg-name="CCTV1" `+tt.want) {
+				t.Errorf("content missing %q\n%s", tt.want, content)
+			}
+			if strings.Count(content, "tvg-logo=") != 1 {
+				t.Errorf("only the channel with a logo file should have tvg-logo\n%s", content)
+			}
+		})
+	}
+}
+
+func TestToM3UFormatInlineEPG(t *testing.T) {
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId: "1",
+			DateProgramList: []DateProgram{
+				{
+					Date: date,
+					ProgramList: []Program{
+						{ProgramName: "朝闻天下", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122083000", StartTime: "06:00", EndTime: "08:30"},
+						{ProgramName: "新闻30分", BeginTimeFormat: "20241122083000", EndTimeFormat: "20241122090000", StartTime: "08:30", EndTime: "09:00"},
+						{ProgramName: "今日说法", BeginTimeFormat: "20241122090000", EndTimeFormat: "20241122100000", StartTime: "09:00", EndTime: "10:00"},
+					},
+				},
+			},
+		},
+		{
+			// 节目单尚未开始的频道
+			ChannelId: "2",
+			DateProgramList: []DateProgram{
+				{
+					Date: date,
+					ProgramList: []Program{
+						{ProgramName: "体育新闻", BeginTimeFormat: "20241122120000", EndTimeFormat: "20241122130000", StartTime: "12:00", EndTime: "13:00"},
+					},
+				},
+			},
+		},
+	}
+	nowNextMap := GetNowNextPrograms(chProgLists, time.Date(2024, 11, 22, 8, 0, 0, 0, time.Local), time.Local)
+	if len(nowNextMap) != 1 || len(nowNextMap["1"]) != 2 {
+		t.Fatalf("unexpected now/next programs: %+v", nowNextMap)
+	}
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+	}
+	content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{NowNextMap: nowNextMap, ExtInfDuration: -1})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+
+	want := `#EXTM3U
+#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1
+# Now: 06:00-08:30 朝闻天下
+# Next: 08:30-09:00 新闻30分
+http://10.0.0.1/live/1
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" group-title="央视",CCTV2
+http://10.0.0.1/live/2
+`
+	if content != want {
+		t.Errorf("ToM3UFormat() =\n%s\nwant:\n%s", content, want)
+	}
+}
+
+func TestToM3UFormatTvgName(t *testing.T) {
+	channels := []Channel{newTestChannel(t, "1", `CCTV-5+ "体育赛事", 高清`, "http://10.0.0.1/live/1")}
+
+	content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	lines := strings.Split(content, "\n")
+	// 双引号替换为单引号，逗号位于引号内
+	want := `#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV-5+ '体育赛事', 高清" group-title="央视",CCTV-5+ "体育赛事", 高清`
+	if lines[1] != want {
+		t.Fatalf("lines[1] = %s, want %s", lines[1], want)
+	}
+
+	// 属性中的引号成对出现，显示名称为最后一个属性之后逗号后的内容
+	attrs, display, _ := strings.Cut(lines[1], `group-title="央视",`)
+	if n := strings.Count(attrs, `"`); n%2 != 0 {
+		t.Errorf("unbalanced quotes in attributes: %s", attrs)
+	}
+	if display != `CCTV-5+ "体育赛事", 高清` {
+		t.Errorf("display name = %q, want the channel name", display)
+	}
+}
+
+func TestToM3UFormatExtInfDuration(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+	}
+
+	tests := []struct {
+		name     string
+		duration int
+		want     string
+	}{
+		{name: "live", duration: -1, want: `#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1`},
+		{name: "zero", duration: 0, want: `#EXTINF:0 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1`},
+		{name: "positive", duration: 3600, want: `#EXTINF:3600 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: tt.duration})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(content), "\n")
+			if len(lines) != 5 {
+				t.Fatalf("unexpected line count %d\n%s", len(lines), content)
+			}
+			if lines[1] != tt.want {
+				t.Errorf("line = %q, want %q", lines[1], tt.want)
+			}
+			// 每个#EXTINF行后紧跟频道URL
+			if lines[2] != "http://10.0.0.1/live/1" || !strings.HasPrefix(lines[3], "#EXTINF:"+strconv.Itoa(tt.duration)+" ") {
+				t.Errorf("unexpected layout\n%s", content)
+			}
+		})
+	}
+}
+
+func TestToM3UFormatCatchupEntry(t *testing.T) {
+	noTimeShift := newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3")
+	noTimeShift.TimeShift = "0"
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.2:5000"),
+		noTimeShift,
+	}
+
+	content, _, err := ToM3UFormat(channels, "http://192.168.1.1:4022", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", true, M3UOptions{ExtInfDuration: -1, CatchupEntry: true})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+
+	want := `#EXTM3U
+#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="append" catchup-source="?playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}" catchup-days="3" group-title="央视",CCTV1
+http://10.0.0.1/live/1
+#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" catchup="default" catchup-source="http://10.0.0.1/timeshift/1?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}" catchup-days="3" group-title="央视",CCTV1 回看
+http://10.0.0.1/timeshift/1?a=1
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" catchup="default" catchup-source="http://10.0.0.1/timeshift/2?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}" catchup-days="3" group-title="央视",CCTV2
+http://192.168.1.1:4022/rtp/239.1.1.2:5000
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" catchup="default" catchup-source="http://10.0.0.1/timeshift/2?a=1&playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}" catchup-days="3" group-title="央视",CCTV2 回看
+http://10.0.0.1/timeshift/2?a=1
+#EXTINF:-1 tvg-id="3" tvg-chno="3" tvg-name="CCTV3" group-title="央视",CCTV3
+http://10.0.0.1/live/3
+`
+	if content != want {
+		t.Errorf("ToM3UFormat() =\n%s\nwant:\n%s", content, want)
+	}
+
+	// 未开启时，不输出回看条目
+	content, _, err = ToM3UFormat(channels, "http://192.168.1.1:4022", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", true, M3UOptions{ExtInfDuration: -1})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if strings.Contains(content, catchupEntrySuffix) {
+		t.Errorf("content unexpectedly contains catchup entry\n%s", content)
+	}
+}
+
+func TestToM3UFormatTvheadend(t *testing.T) {
+	channel := newTestChannel(t, "1001", "CCTV1", "http://10.0.0.1/live/1")
+	channel.UserChannelID = "1"
+	channels := []Channel{channel}
+
+	content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetTvheadend})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	// tvh-uuid为tvg-id（1001）的MD5值
+	want := `#EXTM3U
+#EXTINF:-1 tvg-id="1001" tvg-chno="1" tvg-name="CCTV1" tvh-uuid="b8c37e33defde51cf91e1e03e51657da" tvh-chnum="1" tvh-tags="央视" group-title="央视",CCTV1
+http://10.0.0.1/live/1
+`
+	if content != want {
+		t.Errorf("ToM3UFormat() =\n%s\nwant:\n%s", content, want)
+	}
+
+	// 缺省不输出tvh-标签
+	content, _, err = ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if strings.Contains(content, "tvh-") {
+		t.Errorf("content unexpectedly contains tvh- attributes\n%s", content)
+	}
+}
+
+func TestToM3UFormatTvgRec(t *testing.T) {
+	noTimeShift := newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2")
+	noTimeShift.TimeShift = "0"
+	noTimeShiftLength := newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3")
+	noTimeShiftLength.TimeShiftLength = 0
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		noTimeShift,
+		noTimeShiftLength,
+	}
+
+	tests := []struct {
+		name   string
+		tvgRec bool
+		want   string
+	}{
+		{
+			name:   "enabled",
+			tvgRec: true,
+			want: `#EXTM3U
+#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" tvg-rec="1" group-title="央视",CCTV1
+http://10.0.0.1/live/1
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" group-title="央视",CCTV2
+http://10.0.0.1/live/2
+#EXTINF:-1 tvg-id="3" tvg-chno="3" tvg-name="CCTV3" group-title="央视",CCTV3
+http://10.0.0.1/live/3
+`,
+		},
+		{
+			name:   "disabled",
+			tvgRec: false,
+			want: `#EXTM3U
+#EXTINF:-1 tvg-id="1" tvg-chno="1" tvg-name="CCTV1" group-title="央视",CCTV1
+http://10.0.0.1/live/1
+#EXTINF:-1 tvg-id="2" tvg-chno="2" tvg-name="CCTV2" group-title="央视",CCTV2
+http://10.0.0.1/live/2
+#EXTINF:-1 tvg-id="3" tvg-chno="3" tvg-name="CCTV3" group-title="央视",CCTV3
+http://10.0.0.1/live/3
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, TvgRec: tt.tvgRec})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			if content != tt.want {
+				t.Errorf("ToM3UFormat() =\n%s\nwant:\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestToM3UFormatEPGURL(t *testing.T) {
+	channels := []Channel{newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1")}
+
+	tests := []struct {
+		name   string
+		epgURL string
+		want   string
+	}{
+		{name: "with_epg_url", epgURL: "http://iptv.lan:8080/epg/xml", want: "#EXTM3U url-tvg=\"http://iptv.lan:8080/epg/xml\"\n"},
+		{name: "empty", epgURL: "", want: "#EXTM3U\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, EPGURL: tt.epgURL})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			if !strings.HasPrefix(content, tt.want) {
+				t.Errorf("ToM3UFormat() =\n%s\nwant prefix:\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChannelURLStrRelayPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		udpxyURL  string
+		relayPath string
+		host      string
+		want      string
+	}{
+		{name: "default", udpxyURL: "http://192.168.1.1:4022", relayPath: DefaultMulticastRelayPath, host: "239.1.1.1:5000", want: "http://192.168.1.1:4022/rtp/239.1.1.1:5000"},
+		{name: "empty_path", udpxyURL: "http://192.168.1.1:4022/", host: "239.1.1.1:5000", want: "http://192.168.1.1:4022/rtp/239.1.1.1:5000"},
+		{name: "udp", udpxyURL: "http://192.168.1.1:4022", relayPath: "/udp/${addr}:${port}", host: "239.1.1.1:5000", want: "http://192.168.1.1:4022/udp/239.1.1.1:5000"},
+		{name: "host", udpxyURL: "http://192.168.1.1:7088/", relayPath: "udp/${host}", host: "239.1.1.1:5000", want: "http://192.168.1.1:7088/udp/239.1.1.1:5000"},
+		{name: "query", udpxyURL: "http://192.168.1.1:8080", relayPath: "/stream?addr=${addr}&port=${port}", host: "239.1.1.1:5000", want: "http://192.168.1.1:8080/stream?addr=239.1.1.1&port=5000"},
+		{name: "full_template", udpxyURL: "http://192.168.1.1:4022/udp/${addr}:${port}", relayPath: DefaultMulticastRelayPath, host: "239.1.1.1:5000", want: "http://192.168.1.1:4022/udp/239.1.1.1:5000"},
+		{name: "missing_port", udpxyURL: "http://192.168.1.1:4022", relayPath: DefaultMulticastRelayPath, host: "239.1.1.1", want: "http://192.168.1.1:4022/rtp/239.1.1.1"},
+		{name: "ipv6", udpxyURL: "http://192.168.1.1:4022", relayPath: DefaultMulticastRelayPath, host: "[ff15::1]:5000", want: "http://192.168.1.1:4022/rtp/[ff15::1]:5000"},
+		{name: "ipv6_host", udpxyURL: "http://192.168.1.1:7088/", relayPath: "udp/${host}", host: "[ff15::1]:5000", want: "http://192.168.1.1:7088/udp/[ff15::1]:5000"},
+		{name: "ipv6_query", udpxyURL: "http://192.168.1.1:8080", relayPath: "/stream?addr=${addr}&port=${port}", host: "[ff15::1]:5000", want: "http://192.168.1.1:8080/stream?addr=ff15::1&port=5000"},
+		{name: "ipv6_missing_port", udpxyURL: "http://192.168.1.1:4022", relayPath: DefaultMulticastRelayPath, host: "[ff15::1]", want: "http://192.168.1.1:4022/rtp/[ff15::1]"},
+		{name: "ipv6_missing_port_query", udpxyURL: "http://192.168.1.1:8080", relayPath: "/stream?addr=${addr}", host: "[ff15::1]", want: "http://192.168.1.1:8080/stream?addr=ff15::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channelURLs := mustParseURLs(t, "igmp://"+tt.host)
+			got, isMulticastCh, err := getChannelURLStr(channelURLs, WithMulticastRelayPath(tt.udpxyURL, tt.relayPath), false)
+			if err != nil {
+				t.Fatalf("getChannelURLStr() error = %v", err)
+			}
+			if !isMulticastCh {
+				t.Error("isMulticastCh = false, want true")
+			}
+			if got != tt.want {
+				t.Errorf("getChannelURLStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTrailingNewline(t *testing.T) {
+	channels := []Channel{newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000")}
+	m3u, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	txt, err := ToTxtFormat(channels, "", false, nil)
+	if err != nil {
+		t.Fatalf("ToTxtFormat() error = %v", err)
+	}
+
+	for _, content := range []string{m3u, txt, m3u + "\n\n", txt + "\r\n"} {
+		got := NormalizeTrailingNewline(content, true)
+		if !strings.HasSuffix(got, "igmp://239.1.1.1:5000\n") {
+			t.Errorf("NormalizeTrailingNewline(%q, true) = %q, want exactly one trailing newline", content, got)
+		}
+
+		got = NormalizeTrailingNewline(content, false)
+		if !strings.HasSuffix(got, "igmp://239.1.1.1:5000") {
+			t.Errorf("NormalizeTrailingNewline(%q, false) = %q, want no trailing newline", content, got)
+		}
+	}
+}
+
+func TestToM3UFormatGroupComments(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "湖南卫视", "igmp://239.1.1.2:5000"),
+		newTestChannel(t, "3", "CCTV2", "igmp://239.1.1.3:5000"),
+	}
+	channels[1].GroupName = "卫视"
+
+	content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if strings.Contains(content, "channels)") {
+		t.Errorf("group comments should not be emitted by default:\n%s", content)
+	}
+
+	content, _, err = ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, GroupComments: true})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	lines := strings.Split(content, "\n")
+	if lines[1] != "# 央视 (2 channels)" {
+		t.Errorf("lines[1] = %q, want %q", lines[1], "# 央视 (2 channels)")
+	}
+	if lines[4] != "# 卫视 (1 channels)" {
+		t.Errorf("lines[4] = %q, want %q", lines[4], "# 卫视 (1 channels)")
+	}
+	// 每个分组只输出一次
+	if n := strings.Count(content, "# 央视 ("); n != 1 {
+		t.Errorf("group comment count = %d, want 1", n)
+	}
+}
+
+func TestToM3UFormatSkipChannelsWithoutURL(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2"),
+		newTestChannel(t, "3", "CCTV3", "igmp://239.1.1.3:5000"),
+	}
+
+	content, skipped, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, GroupComments: true})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if !slices.Equal(skipped, []string{"CCTV2"}) {
+		t.Errorf("skipped = %v, want [CCTV2]", skipped)
+	}
+	if strings.Contains(content, ",CCTV2\n") {
+		t.Errorf("channel without url should be skipped:\n%s", content)
+	}
+	// 分组的频道数量不包含被跳过的频道
+	if !strings.Contains(content, "# 央视 (2 channels)\n") {
+		t.Errorf("group comment should count 2 channels:\n%s", content)
+	}
+
+	if _, _, err = ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, Strict: true}); err == nil {
+		t.Error("ToM3UFormat() error = nil, want error in strict mode")
+	}
+}
+
+func TestToM3UFormatMaxCatchupDays(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+	}
+	channels[1].TimeShiftLength = 24 * time.Hour
+
+	tests := []struct {
+		name           string
+		maxCatchupDays int
+		epgBackDaysMap map[string]int
+		want           []string
+	}{
+		{name: "no_cap", maxCatchupDays: 0, want: []string{`catchup-days="3"`, `catchup-days="1"`}},
+		{name: "clamped", maxCatchupDays: 2, want: []string{`catchup-days="2"`, `catchup-days="1"`}},
+		{name: "not_exceeded", maxCatchupDays: 7, want: []string{`catchup-days="3"`, `catchup-days="1"`}},
+		{name: "epg_cap", epgBackDaysMap: map[string]int{"1": 2, "2": 5}, want: []string{`catchup-days="2"`, `catchup-days="1"`}},
+		{name: "epg_missing_channel", epgBackDaysMap: map[string]int{"2": 0}, want: []string{`catchup-days="3"`, `catchup-days="0"`}},
+		{name: "epg_and_max", maxCatchupDays: 1, epgBackDaysMap: map[string]int{"1": 2}, want: []string{`catchup-days="1"`, `catchup-days="1"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, err := ToM3UFormat(channels, "", "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}", false, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault, MaxCatchupDays: tt.maxCatchupDays, EPGBackDaysMap: tt.epgBackDaysMap})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			lines := strings.Split(content, "\n")
+			for i, want := range tt.want {
+				if line := lines[1+i*2]; !strings.Contains(line, want) {
+					t.Errorf("channel %d: %s, want %s", i+1, line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestToM3UFormatLiveTimeShiftFallback(t *testing.T) {
+	unicast := newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000", "http://10.0.0.1/live/1.m3u8?token=abc")
+	unicast.TimeShiftURL = nil
+	multicastOnly := newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.2:5000")
+	multicastOnly.TimeShiftURL = nil
+	noTimeShift := newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3.m3u8")
+	noTimeShift.TimeShiftURL = nil
+	noTimeShift.TimeShift = "0"
+	channels := []Channel{unicast, multicastOnly, noTimeShift, newTestChannel(t, "4", "CCTV4", "http://10.0.0.1/live/4.m3u8")}
+
+	// 未开启时，没有时移地址的频道不输出回看信息
+	m3u, _, err := ToM3UFormat(channels, "", "playseek=${(b)yyyyMMddHHmmss}", true, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if strings.Count(m3u, "catchup-source=") != 1 {
+		t.Fatalf("ToM3UFormat() = %s, want catchup only for CCTV4", m3u)
+	}
+
+	SetChannelLiveTimeShiftURL(channels)
+	if channels[0].TimeShiftURL == nil || channels[0].TimeShiftURL.String() != "http://10.0.0.1/live/1.m3u8?token=abc" {
+		t.Errorf("channels[0].TimeShiftURL = %v, want the unicast live url", channels[0].TimeShiftURL)
+	}
+	if channels[1].TimeShiftURL != nil || channels[2].TimeShiftURL != nil {
+		t.Errorf("TimeShiftURL = %v, %v, want nil", channels[1].TimeShiftURL, channels[2].TimeShiftURL)
+	}
+	if channels[3].TimeShiftURL.String() != "http://10.0.0.1/timeshift/4?a=1" {
+		t.Errorf("channels[3].TimeShiftURL = %v, want unchanged", channels[3].TimeShiftURL)
+	}
+
+	m3u, _, err = ToM3UFormat(channels, "", "playseek=${(b)yyyyMMddHHmmss}", true, M3UOptions{ExtInfDuration: -1, Target: M3UTargetDefault})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	want := `catchup-source="http://10.0.0.1/live/1.m3u8?token=abc&playseek=${(b)yyyyMMddHHmmss}"`
+	if !strings.Contains(m3u, want) {
+		t.Errorf("ToM3UFormat() = %s, want %s", m3u, want)
+	}
+	if strings.Count(m3u, "catchup-source=") != 2 {
+		t.Errorf("ToM3UFormat() = %s, want catchup for CCTV1 and CCTV4", m3u)
+	}
+}
@@ -2,6 +2,7 @@ package iptv
 
 import (
 	"encoding/hex"
+	"fmt"
 	"strings"
 
 	"github.com/forgoer/openssl"
@@ -49,3 +50,37 @@ func (c *TripleDESCrypto) ECBDecrypt(cipherText string) (string, error) {
 
 	return string(decrypted), nil
 }
+
+const (
+	selfTestKey        = "12345678"
+	selfTestPlainText  = "99999$1234567890$iptv-tool$self-test$CTC"
+	selfTestCipherText = "67edd048e79c4fab6e9b2972935b73c8bfa3142b9b914dc790d862e6618720b39c03146849a0f2f7feb959b7d4642fcb"
+)
+
+// SelfTestCrypto 使用已知的明文和密文校验3DES的加解密结果，用于尽早发现运行环境或构建导致的问题
+func SelfTestCrypto() error {
+	return selfTestCrypto(selfTestKey, selfTestPlainText, selfTestCipherText)
+}
+
+func selfTestCrypto(key, plainText, cipherText string) error {
+	crypto := NewTripleDESCrypto(key)
+
+	// 校验加密结果
+	encrypted, err := crypto.ECBEncrypt(plainText)
+	if err != nil {
+		return fmt.Errorf("crypto self-test failed to encrypt: %w", err)
+	}
+	if encrypted != cipherText {
+		return fmt.Errorf("crypto self-test failed: unexpected cipher text %s", encrypted)
+	}
+
+	// 校验解密结果
+	decrypted, err := crypto.ECBDecrypt(encrypted)
+	if err != nil {
+		return fmt.Errorf("crypto self-test failed to decrypt: %w", err)
+	}
+	if decrypted != plainText {
+		return fmt.Errorf("crypto self-test failed: round-trip mismatch %q", decrypted)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package iptv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfTestCrypto(t *testing.T) {
+	if err := SelfTestCrypto(); err != nil {
+		t.Fatalf("SelfTestCrypto() error = %v", err)
+	}
+}
+
+func TestSelfTestCryptoMismatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		cipherText string
+	}{
+		{name: "wrong_key", key: "87654321", cipherText: selfTestCipherText},
+		{name: "wrong_cipher_text", key: selfTestKey, cipherText: "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := selfTestCrypto(tt.key, selfTestPlainText, tt.cipherText); err == nil {
+				t.Error("selfTestCrypto() error = nil, want mismatch error")
+			}
+		})
+	}
+}
+
+func TestTripleDESCryptoRoundTrip(t *testing.T) {
+	plainText := "99999$token$user$stb$10.0.0.2$00:11:22:33:44:55$$CTC"
+	crypto := NewTripleDESCrypto("12345678")
+
+	cipherText, err := crypto.ECBEncrypt(plainText)
+	if err != nil {
+		t.Fatalf("ECBEncrypt() error = %v", err)
+	}
+	decodedText, err := crypto.ECBDecrypt(cipherText)
+	if err != nil {
+		t.Fatalf("ECBDecrypt() error = %v", err)
+	}
+	if decodedText != plainText {
+		t.Errorf("ECBDecrypt() = %q, want %q", decodedText, plainText)
+	}
+
+	// Authenticator的明文按$分隔为8个字段
+	if infos := strings.Split(decodedText, "$"); len(infos) != 8 || infos[2] != "user" || infos[7] != "CTC" {
+		t.Errorf("fields = %q", infos)
+	}
+
+	if text, err := NewTripleDESCrypto("87654321").ECBDecrypt(cipherText); err == nil && text == plainText {
+		t.Error("ECBDecrypt() with a wrong key returned the plain text")
+	}
+}
@@ -0,0 +1,22 @@
+package iptv
+
+// ChannelDRM 频道的DRM信息
+type ChannelDRM struct {
+	LicenseType string `json:"licenseType"` // 授权类型，例如：clearkey、com.widevine.alpha
+	LicenseKey  string `json:"licenseKey"`  // 授权密钥或授权服务器地址
+}
+
+// SetChannelDRM 根据频道名称或频道ID，设置频道的DRM信息
+func SetChannelDRM(channels []Channel, chDRMMap map[string]ChannelDRM) {
+	if len(chDRMMap) == 0 {
+		return
+	}
+
+	for i := range channels {
+		if drm, ok := chDRMMap[channels[i].ChannelName]; ok {
+			channels[i].DRM = &drm
+		} else if drm, ok = chDRMMap[channels[i].ChannelID]; ok {
+			channels[i].DRM = &drm
+		}
+	}
+}
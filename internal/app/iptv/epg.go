@@ -1,6 +1,9 @@
 package iptv
 
 import (
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -9,6 +12,16 @@ type ChannelProgramList struct {
 	ChannelId       string        `json:"channelId"`             // 频道Id
 	ChannelName     string        `json:"channelName,omitempty"` // 频道名称
 	DateProgramList []DateProgram `json:"dateProgramList"`       // 不同日期的频道列表
+	TvgID           string        `json:"tvgId,omitempty"`       // 输出的tvg-id，为空时使用频道Id
+	LogoName        string        `json:"logoName,omitempty"`    // 频道的台标名称，用于输出xmltv的icon
+}
+
+// GetTvgID 获取频道的tvg-id，未设置时使用频道Id
+func (c *ChannelProgramList) GetTvgID() string {
+	if c.TvgID != "" {
+		return c.TvgID
+	}
+	return c.ChannelId
 }
 
 // DateProgram 一天的节目单列表
@@ -19,9 +32,195 @@ type DateProgram struct {
 
 // Program 节目单
 type Program struct {
-	ProgramName     string `json:"programName"`     // 节目名称
-	BeginTimeFormat string `json:"beginTimeFormat"` // 格式化的开始时间，例如：20241122205700
-	EndTimeFormat   string `json:"endTimeFormat"`   // 格式化的结束时间，例如：20241122210100
-	StartTime       string `json:"startTime"`       // 开始时间，例如：20:57
-	EndTime         string `json:"endTime"`         // 结束时间，例如：21:01
+	ProgramName     string `json:"programName"`        // 节目名称
+	BeginTimeFormat string `json:"beginTimeFormat"`    // 格式化的开始时间，例如：20241122205700
+	EndTimeFormat   string `json:"endTimeFormat"`      // 格式化的结束时间，例如：20241122210100
+	StartTime       string `json:"startTime"`          // 开始时间，例如：20:57
+	EndTime         string `json:"endTime"`            // 结束时间，例如：21:01
+	SubTitle        string `json:"subTitle,omitempty"` // 节目副标题，例如剧集的集数，部分接口不提供
+}
+
+// ProgramTitleRule 节目名称的清理规则
+type ProgramTitleRule struct {
+	Rule    *regexp.Regexp // 匹配规则
+	Replace string         // 替换内容，缺省为空即删除匹配的内容
+}
+
+// CleanProgramTitle 按清理规则依次处理节目名称
+func CleanProgramTitle(progTitleRules []ProgramTitleRule, title string) string {
+	for _, progTitleRule := range progTitleRules {
+		title = progTitleRule.Rule.ReplaceAllString(title, progTitleRule.Replace)
+	}
+	return title
+}
+
+// compareProgramBeginTime 按开始时间比较节目，时间格式为yyyyMMddHHmmss，可直接按字符串比较
+func compareProgramBeginTime(a, b Program) int {
+	return strings.Compare(a.BeginTimeFormat, b.BeginTimeFormat)
+}
+
+// SortPrograms 按开始时间对节目列表进行升序排序，开始时间相同的节目保持原有顺序
+func SortPrograms(programs []Program) {
+	slices.SortStableFunc(programs, compareProgramBeginTime)
+}
+
+// FindOverlappingPrograms 检查已排序的节目列表，返回开始时间早于上一个节目结束时间的节目
+func FindOverlappingPrograms(programs []Program) []Program {
+	var result []Program
+	for i := 1; i < len(programs); i++ {
+		if programs[i].BeginTimeFormat < programs[i-1].EndTimeFormat {
+			result = append(result, programs[i])
+		}
+	}
+	return result
+}
+
+// SnapProgramTimes 相邻节目之间的间隔或重叠不超过tolerance时，将节目的结束时间对齐到下一个节目的开始时间
+// 节目列表需按开始时间排序，tolerance小于等于0时不做处理；loc为节目时间所在的时区，为空时使用DefaultXmltvLocation
+func SnapProgramTimes(programs []Program, tolerance time.Duration, loc *time.Location) {
+	if tolerance <= 0 {
+		return
+	}
+	if loc == nil {
+		loc = DefaultXmltvLocation
+	}
+
+	for i := 0; i < len(programs)-1; i++ {
+		endTime, err := time.ParseInLocation("20060102150405", programs[i].EndTimeFormat, loc)
+		if err != nil {
+			continue
+		}
+		nextBeginTime, err := time.ParseInLocation("20060102150405", programs[i+1].BeginTimeFormat, loc)
+		if err != nil {
+			continue
+		}
+
+		diff := nextBeginTime.Sub(endTime)
+		if diff != 0 && diff.Abs() <= tolerance {
+			programs[i].EndTimeFormat = programs[i+1].BeginTimeFormat
+			programs[i].EndTime = programs[i+1].StartTime
+		}
+	}
+}
+
+// GetNowNextPrograms 获取各频道当前正在播放及下一个节目，返回频道ID与节目列表的映射
+// loc为节目时间所在的时区，为空时使用DefaultXmltvLocation
+func GetNowNextPrograms(chProgLists []ChannelProgramList, now time.Time, loc *time.Location) map[string][]Program {
+	if loc == nil {
+		loc = DefaultXmltvLocation
+	}
+	result := make(map[string][]Program, len(chProgLists))
+	for _, chProgList := range chProgLists {
+		programs := make([]Program, 0, 2)
+		for _, dateProgList := range chProgList.DateProgramList {
+			for _, program := range dateProgList.ProgramList {
+				endTime, err := time.ParseInLocation("20060102150405", program.EndTimeFormat, loc)
+				if err != nil || !endTime.After(now) {
+					continue
+				}
+
+				programs = append(programs, program)
+				if len(programs) == 2 {
+					break
+				}
+			}
+			if len(programs) == 2 {
+				break
+			}
+		}
+
+		// 第一个节目必须已经开始，否则视为没有正在播放的节目
+		if len(programs) > 0 {
+			beginTime, err := time.ParseInLocation("20060102150405", programs[0].BeginTimeFormat, loc)
+			if err != nil || beginTime.After(now) {
+				continue
+			}
+			result[chProgList.ChannelId] = programs
+		}
+	}
+	return result
+}
+
+// GetEPGBackDays 获取各频道节目单实际覆盖的回看天数，返回频道ID与天数的映射
+// 天数为节目单中最早的节目日期与now所在日期相差的天数，没有节目的频道不包含在映射中
+// loc为节目时间所在的时区，为空时使用DefaultXmltvLocation
+func GetEPGBackDays(chProgLists []ChannelProgramList, now time.Time, loc *time.Location) map[string]int {
+	if loc == nil {
+		loc = DefaultXmltvLocation
+	}
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	result := make(map[string]int, len(chProgLists))
+	for _, chProgList := range chProgLists {
+		var earliest time.Time
+		for _, dateProgList := range chProgList.DateProgramList {
+			for _, program := range dateProgList.ProgramList {
+				beginTime, err := time.ParseInLocation("20060102150405", program.BeginTimeFormat, loc)
+				if err != nil {
+					continue
+				}
+				if earliest.IsZero() || beginTime.Before(earliest) {
+					earliest = beginTime
+				}
+			}
+		}
+		if earliest.IsZero() {
+			continue
+		}
+
+		beginDate := time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, loc)
+		// 按日期计算相差的天数，避免夏令时等导致的误差
+		backDays := int(today.Sub(beginDate).Round(24*time.Hour) / (24 * time.Hour))
+		result[chProgList.ChannelId] = max(backDays, 0)
+	}
+	return result
+}
+
+// FilterProgramsByBackDays 返回仅保留过去backDays天及之后的节目的节目单副本，不修改原有的节目单
+// 截止时间为backDays天前的0点，结束时间晚于截止时间的节目（包括跨越截止时间的节目）均会保留
+// backDays小于等于0时保留所有节目，过滤后没有节目的日期不再保留；loc为节目时间所在的时区，为空时使用DefaultXmltvLocation
+func FilterProgramsByBackDays(lists []ChannelProgramList, backDays int, loc *time.Location) []ChannelProgramList {
+	return filterProgramsByBackDays(lists, backDays, time.Now(), loc)
+}
+
+// filterProgramsByBackDays 以now为当前时间，按回看天数过滤节目单
+func filterProgramsByBackDays(lists []ChannelProgramList, backDays int, now time.Time, loc *time.Location) []ChannelProgramList {
+	if backDays <= 0 {
+		return slices.Clone(lists)
+	}
+	if loc == nil {
+		loc = DefaultXmltvLocation
+	}
+	now = now.In(loc)
+	cutoff := time.Date(now.Year(), now.Month(), now.Day()-backDays, 0, 0, 0, 0, loc)
+
+	result := make([]ChannelProgramList, 0, len(lists))
+	for _, chProgList := range lists {
+		dateProgLists := make([]DateProgram, 0, len(chProgList.DateProgramList))
+		for _, dateProgList := range chProgList.DateProgramList {
+			programList := make([]Program, 0, len(dateProgList.ProgramList))
+			for _, program := range dateProgList.ProgramList {
+				if isProgramAfterCutoff(&program, dateProgList.Date, cutoff, loc) {
+					programList = append(programList, program)
+				}
+			}
+			if len(programList) == 0 {
+				continue
+			}
+			dateProgList.ProgramList = programList
+			dateProgLists = append(dateProgLists, dateProgList)
+		}
+		chProgList.DateProgramList = dateProgLists
+		result = append(result, chProgList)
+	}
+	return result
+}
+
+// isProgramAfterCutoff 判断节目的结束时间是否晚于截止时间，结束时间无法解析时按节目所在的日期判断
+func isProgramAfterCutoff(program *Program, date, cutoff time.Time, loc *time.Location) bool {
+	endTime, err := time.ParseInLocation("20060102150405", program.EndTimeFormat, loc)
+	if err != nil {
+		return !date.Before(cutoff)
+	}
+	return endTime.After(cutoff)
 }
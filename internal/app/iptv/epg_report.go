@@ -0,0 +1,84 @@
+package iptv
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+type epgErrorReportKey struct{}
+
+// EPGErrorReport 汇总获取节目单失败的频道，相同的错误信息归为一组
+type EPGErrorReport struct {
+	mu     sync.Mutex
+	groups map[string][]string // 错误信息与频道名称列表的映射
+}
+
+// EPGErrorGroup 相同错误信息的失败频道
+type EPGErrorGroup struct {
+	Error    string   `json:"error"`    // 错误信息
+	Channels []string `json:"channels"` // 失败的频道名称
+}
+
+func NewEPGErrorReport() *EPGErrorReport {
+	return &EPGErrorReport{
+		groups: make(map[string][]string),
+	}
+}
+
+// WithEPGErrorReport 在context中携带错误汇总，获取节目单失败的频道会记录到其中
+func WithEPGErrorReport(ctx context.Context, report *EPGErrorReport) context.Context {
+	return context.WithValue(ctx, epgErrorReportKey{}, report)
+}
+
+// RecordEPGError 记录获取节目单失败的频道，context中未携带错误汇总时忽略
+func RecordEPGError(ctx context.Context, channel *Channel, err error) {
+	report, ok := ctx.Value(epgErrorReportKey{}).(*EPGErrorReport)
+	if !ok || report == nil || err == nil {
+		return
+	}
+	report.Add(channel.ChannelName, err)
+}
+
+// Add 记录获取节目单失败的频道
+func (r *EPGErrorReport) Add(channelName string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg := err.Error()
+	r.groups[msg] = append(r.groups[msg], channelName)
+}
+
+// Len 获取失败的频道数量
+func (r *EPGErrorReport) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int
+	for _, channelNames := range r.groups {
+		count += len(channelNames)
+	}
+	return count
+}
+
+// Groups 按失败的频道数量从多到少，返回各错误信息的分组
+func (r *EPGErrorReport) Groups() []EPGErrorGroup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups := make([]EPGErrorGroup, 0, len(r.groups))
+	for msg, channelNames := range r.groups {
+		groups = append(groups, EPGErrorGroup{
+			Error:    msg,
+			Channels: slices.Clone(channelNames),
+		})
+	}
+	slices.SortFunc(groups, func(a, b EPGErrorGroup) int {
+		if n := cmp.Compare(len(b.Channels), len(a.Channels)); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.Error, b.Error)
+	})
+	return groups
+}
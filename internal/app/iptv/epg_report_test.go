@@ -0,0 +1,44 @@
+package iptv
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEPGErrorReport(t *testing.T) {
+	report := NewEPGErrorReport()
+	ctx := WithEPGErrorReport(context.Background(), report)
+
+	errTimeout := errors.New("context deadline exceeded")
+	for _, channel := range []Channel{
+		{ChannelID: "1", ChannelName: "CCTV1"},
+		{ChannelID: "2", ChannelName: "CCTV2"},
+		{ChannelID: "3", ChannelName: "CCTV3"},
+	} {
+		RecordEPGError(ctx, &channel, errTimeout)
+	}
+	RecordEPGError(ctx, &Channel{ChannelID: "4", ChannelName: "CCTV4"}, errors.New("http status code: 500"))
+	RecordEPGError(ctx, &Channel{ChannelID: "5", ChannelName: "CCTV5"}, fmtError("context deadline exceeded"))
+	// 未携带错误汇总的context不记录
+	RecordEPGError(context.Background(), &Channel{ChannelID: "6", ChannelName: "CCTV6"}, errTimeout)
+
+	if report.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", report.Len())
+	}
+	want := []EPGErrorGroup{
+		{Error: "context deadline exceeded", Channels: []string{"CCTV1", "CCTV2", "CCTV3", "CCTV5"}},
+		{Error: "http status code: 500", Channels: []string{"CCTV4"}},
+	}
+	if got := report.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %+v, want %+v", got, want)
+	}
+}
+
+// fmtError 与其他错误信息相同但不是同一个实例的错误
+type fmtError string
+
+func (e fmtError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,160 @@
+package iptv
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetEPGBackDays(t *testing.T) {
+	now := time.Date(2024, 11, 22, 10, 30, 0, 0, time.Local)
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId: "1",
+			DateProgramList: []DateProgram{
+				{ProgramList: []Program{{BeginTimeFormat: "20241122080000"}}},
+				{ProgramList: []Program{{BeginTimeFormat: "20241120233000"}, {BeginTimeFormat: "20241121000000"}}},
+			},
+		},
+		{
+			ChannelId:       "2",
+			DateProgramList: []DateProgram{{ProgramList: []Program{{BeginTimeFormat: "20241122000000"}}}},
+		},
+		{
+			ChannelId:       "3",
+			DateProgramList: []DateProgram{{ProgramList: []Program{{BeginTimeFormat: "20241123000000"}}}},
+		},
+		{
+			ChannelId:       "4",
+			DateProgramList: []DateProgram{{ProgramList: []Program{{BeginTimeFormat: "invalid"}}}},
+		},
+		{ChannelId: "5"},
+	}
+
+	got := GetEPGBackDays(chProgLists, now, time.Local)
+	want := map[string]int{"1": 2, "2": 0, "3": 0}
+	if len(got) != len(want) {
+		t.Fatalf("GetEPGBackDays() = %v, want %v", got, want)
+	}
+	for id, days := range want {
+		if got[id] != days {
+			t.Errorf("GetEPGBackDays()[%s] = %d, want %d", id, got[id], days)
+		}
+	}
+}
+
+func TestFilterProgramsByBackDays(t *testing.T) {
+	now := time.Date(2024, 11, 22, 10, 30, 0, 0, time.Local)
+	newChProgLists := func() []ChannelProgramList {
+		return []ChannelProgramList{
+			{
+				ChannelId: "1",
+				DateProgramList: []DateProgram{
+					{
+						Date: time.Date(2024, 11, 20, 0, 0, 0, 0, time.Local),
+						ProgramList: []Program{
+							{ProgramName: "过期", BeginTimeFormat: "20241120220000", EndTimeFormat: "20241120233000"},
+							// 结束时间恰好为截止时间
+							{ProgramName: "截止", BeginTimeFormat: "20241120233000", EndTimeFormat: "20241121000000"},
+						},
+					},
+					{
+						Date: time.Date(2024, 11, 21, 0, 0, 0, 0, time.Local),
+						ProgramList: []Program{
+							// 开始时间恰好为截止时间
+							{ProgramName: "零点", BeginTimeFormat: "20241121000000", EndTimeFormat: "20241121010000"},
+						},
+					},
+				},
+			},
+			{
+				ChannelId: "2",
+				DateProgramList: []DateProgram{
+					{
+						Date: time.Date(2024, 11, 20, 0, 0, 0, 0, time.Local),
+						ProgramList: []Program{
+							// 跨越截止时间的节目
+							{ProgramName: "跨天", BeginTimeFormat: "20241120233000", EndTimeFormat: "20241121003000"},
+						},
+					},
+					{
+						Date:        time.Date(2024, 11, 19, 0, 0, 0, 0, time.Local),
+						ProgramList: []Program{{ProgramName: "无效", BeginTimeFormat: "invalid", EndTimeFormat: "invalid"}},
+					},
+				},
+			},
+		}
+	}
+	programNames := func(lists []ChannelProgramList) []string {
+		var names []string
+		for _, chProgList := range lists {
+			for _, dateProgList := range chProgList.DateProgramList {
+				for _, program := range dateProgList.ProgramList {
+					names = append(names, chProgList.ChannelId+":"+program.ProgramName)
+				}
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		backDays int
+		want     []string
+	}{
+		{name: "keep_all", backDays: 0, want: []string{"1:过期", "1:截止", "1:零点", "2:跨天", "2:无效"}},
+		{name: "negative", backDays: -1, want: []string{"1:过期", "1:截止", "1:零点", "2:跨天", "2:无效"}},
+		{name: "one_day", backDays: 1, want: []string{"1:零点", "2:跨天"}},
+		{name: "three_days", backDays: 3, want: []string{"1:过期", "1:截止", "1:零点", "2:跨天", "2:无效"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chProgLists := newChProgLists()
+			got := filterProgramsByBackDays(chProgLists, tt.backDays, now, time.Local)
+			if names := programNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("filterProgramsByBackDays() = %v, want %v", names, tt.want)
+			}
+			// 不修改原有的节目单
+			if names := programNames(chProgLists); len(names) != 5 {
+				t.Errorf("original programmes = %v, want 5 programmes", names)
+			}
+		})
+	}
+
+	// 过滤后没有节目的日期不再保留
+	got := filterProgramsByBackDays(newChProgLists(), 1, now, time.Local)
+	if len(got) != 2 || len(got[0].DateProgramList) != 1 || len(got[1].DateProgramList) != 1 {
+		t.Errorf("filterProgramsByBackDays() = %+v, want one date per channel", got)
+	}
+}
+
+func TestGetNowNextProgramsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId: "1",
+			DateProgramList: []DateProgram{
+				{
+					Date: time.Date(2024, 11, 22, 0, 0, 0, 0, loc),
+					ProgramList: []Program{
+						{ProgramName: "朝闻天下", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122083000"},
+						{ProgramName: "新闻30分", BeginTimeFormat: "20241122083000", EndTimeFormat: "20241122090000"},
+					},
+				},
+			},
+		},
+	}
+
+	// 节目时间为门户所在时区的时间，与当前时间所在的时区无关
+	now := time.Date(2024, 11, 22, 0, 0, 0, 0, time.UTC) // UTC+8的08:00
+	got := GetNowNextPrograms(chProgLists, now, loc)
+	if programs := got["1"]; len(programs) != 2 || programs[0].ProgramName != "朝闻天下" {
+		t.Errorf("GetNowNextPrograms() = %+v, want 朝闻天下 and 新闻30分", got)
+	}
+
+	// 按门户所在时区计算日期，UTC的22日20点已是UTC+8的23日
+	backDays := GetEPGBackDays(chProgLists, time.Date(2024, 11, 22, 20, 0, 0, 0, time.UTC), loc)
+	if backDays["1"] != 1 {
+		t.Errorf("GetEPGBackDays() = %v, want map[1:1]", backDays)
+	}
+}
@@ -0,0 +1,59 @@
+package iptv
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReadFavorites 读取收藏的频道列表，每行一个频道ID或频道名称，忽略空行和#开头的注释行
+func ReadFavorites(r io.Reader) ([]string, error) {
+	favorites := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		favorites = append(favorites, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
+
+// FilterChannelsByFavorites 按收藏列表的顺序过滤频道，优先匹配频道ID，其次匹配频道名称
+// 返回过滤后的频道列表，以及未找到对应频道的收藏项
+func FilterChannelsByFavorites(channels []Channel, favorites []string) ([]Channel, []string) {
+	chIDMap := make(map[string]int, len(channels))
+	chNameMap := make(map[string]int, len(channels))
+	for i, channel := range channels {
+		chIDMap[channel.ChannelID] = i
+		if _, ok := chNameMap[channel.ChannelName]; !ok {
+			chNameMap[channel.ChannelName] = i
+		}
+	}
+
+	result := make([]Channel, 0, len(favorites))
+	unknown := make([]string, 0)
+	added := make(map[int]struct{}, len(favorites))
+	for _, favorite := range favorites {
+		i, ok := chIDMap[favorite]
+		if !ok {
+			i, ok = chNameMap[favorite]
+		}
+		if !ok {
+			unknown = append(unknown, favorite)
+			continue
+		}
+
+		// 跳过重复的收藏项
+		if _, ok = added[i]; ok {
+			continue
+		}
+		added[i] = struct{}{}
+		result = append(result, channels[i])
+	}
+	return result, unknown
+}
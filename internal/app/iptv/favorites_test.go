@@ -0,0 +1,44 @@
+package iptv
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterChannelsByFavorites(t *testing.T) {
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+		newTestChannel(t, "3", "湖南卫视", "http://10.0.0.1/live/3"),
+		newTestChannel(t, "4", "浙江卫视", "http://10.0.0.1/live/4"),
+	}
+
+	file := `# 我的收藏
+浙江卫视
+  1
+
+CCTV9
+3
+CCTV1
+`
+	favorites, err := ReadFavorites(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ReadFavorites() error = %v", err)
+	}
+	if want := []string{"浙江卫视", "1", "CCTV9", "3", "CCTV1"}; !slices.Equal(favorites, want) {
+		t.Fatalf("ReadFavorites() = %v, want %v", favorites, want)
+	}
+
+	result, unknown := FilterChannelsByFavorites(channels, favorites)
+	got := make([]string, 0, len(result))
+	for _, channel := range result {
+		got = append(got, channel.ChannelName)
+	}
+	if want := []string{"浙江卫视", "CCTV1", "湖南卫视"}; !slices.Equal(got, want) {
+		t.Errorf("channels = %v, want %v", got, want)
+	}
+	if want := []string{"CCTV9"}; !slices.Equal(unknown, want) {
+		t.Errorf("unknown = %v, want %v", unknown, want)
+	}
+}
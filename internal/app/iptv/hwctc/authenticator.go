@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"iptv/internal/app/iptv"
 	"math/rand"
 	"net"
@@ -21,6 +20,36 @@ type Token struct {
 	JSESSIONID string `json:"jsessionid"`
 }
 
+// getToken 获取认证的Token，缓存的Token未过期时直接使用，避免获取频道列表及节目单时每次都重新认证
+// 并发获取时，后续的调用等待正在进行的认证完成后使用其结果
+func (c *Client) getToken(ctx context.Context) (*Token, error) {
+	if c.config.TokenTTL < 0 {
+		return c.requestToken(ctx)
+	}
+
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token != nil && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	token, err := c.requestToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	c.tokenExpiry = time.Now().Add(time.Duration(c.config.TokenTTL) * time.Minute)
+	return token, nil
+}
+
+// InvalidateToken 清除缓存的Token，上游返回401/403等认证失败的响应时调用，下次请求时重新认证
+func (c *Client) InvalidateToken() {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token = nil
+	c.tokenExpiry = time.Time{}
+}
+
 // requestToken 请求认证的Token
 func (c *Client) requestToken(ctx context.Context) (*Token, error) {
 	// 访问登录页面
@@ -113,7 +142,7 @@ func (c *Client) authLoginHWCTC(ctx context.Context, referer string) (string, er
 	}
 
 	// 解析响应内容
-	result, err := io.ReadAll(resp.Body)
+	result, err := c.readResponseBody(resp)
 	if err != nil {
 		return "", err
 	}
@@ -193,8 +222,8 @@ func (c *Client) validAuthenticationHWCTC(ctx context.Context, encryptToken stri
 
 	// 设置请求头
 	c.setCommonHeaders(req)
-	referer := fmt.Sprintf("http://%s/EPG/jsp/authLoginHW%s.jsp", c.host, c.config.ProviderSuffix)
-	req.Header.Set("Referer", referer)
+	c.setReferer(req, c.getReferers().Token,
+		fmt.Sprintf("http://%s/EPG/jsp/authLoginHW%s.jsp", c.host, c.config.ProviderSuffix))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// 执行请求
@@ -221,7 +250,7 @@ func (c *Client) validAuthenticationHWCTC(ctx context.Context, encryptToken stri
 	}
 
 	// 解析响应内容
-	result, err := io.ReadAll(resp.Body)
+	result, err := c.readResponseBody(resp)
 	if err != nil {
 		return nil, err
 	}
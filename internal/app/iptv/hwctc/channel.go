@@ -5,7 +5,6 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"iptv/internal/app/iptv"
 	"net/http"
 	"net/url"
@@ -18,9 +17,10 @@ import (
 )
 
 // GetAllChannelList 获取所有频道列表
+// getchannellistHW接口在一次响应中返回全部频道，不存在按分类或分页的多次请求，因此无需并发获取
 func (c *Client) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error) {
 	// 请求认证的Token
-	token, err := c.requestToken(ctx)
+	token, err := c.getToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +54,8 @@ func (c *Client) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error)
 
 	// 设置请求头
 	c.setCommonHeaders(req)
-	req.Header.Set("Referer", fmt.Sprintf("http://%s/EPG/jsp/ValidAuthenticationHW%s.jsp", c.host, c.config.ProviderSuffix))
+	c.setReferer(req, c.getReferers().Channel,
+		fmt.Sprintf("http://%s/EPG/jsp/ValidAuthenticationHW%s.jsp", c.host, c.config.ProviderSuffix))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	// 设置Cookie
@@ -70,12 +71,17 @@ func (c *Client) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error)
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
-	result, err := io.ReadAll(resp.Body)
+	result, err := c.readResponseBody(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -99,16 +105,9 @@ func (c *Client) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error)
 		}
 
 		// channelURL类型转换
-		// channelURL可能同时返回组播和单播多个地址（通过|分割）
-		channelURLStrList := strings.Split(string(matches[4]), "|")
-		channelURLs := make([]url.URL, 0, len(channelURLStrList))
-		for _, channelURLStr := range channelURLStrList {
-			channelURL, err := url.Parse(channelURLStr)
-			if err != nil {
-				continue
-			}
-
-			channelURLs = append(channelURLs, *channelURL)
+		channelURLs, err := c.parseChannelURLs(channelName, string(matches[4]))
+		if err != nil {
+			return nil, err
 		}
 
 		if len(channelURLs) == 0 {
@@ -154,3 +153,32 @@ func (c *Client) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error)
 	}
 	return channels, nil
 }
+
+// parseChannelURLs 解析频道的URL地址，并校验组播地址的合法性
+func (c *Client) parseChannelURLs(channelName, channelURLsStr string) ([]url.URL, error) {
+	// channelURL可能同时返回组播和单播多个地址（通过|分割）
+	channelURLStrList := strings.Split(channelURLsStr, "|")
+	channelURLs := make([]url.URL, 0, len(channelURLStrList))
+	for _, channelURLStr := range channelURLStrList {
+		channelURL, err := url.Parse(channelURLStr)
+		if err != nil {
+			continue
+		}
+
+		// 校验并规范化组播地址
+		if channelURL.Scheme == iptv.SCHEME_IGMP {
+			host, err := iptv.NormalizeMulticastHost(channelURL.Host)
+			if err != nil {
+				if c.config.StrictMulticast {
+					return nil, fmt.Errorf("channel %s: %w", channelName, err)
+				}
+				c.logger.Warn("The multicast address of this channel is illegal, skip it.", zap.String("channelName", channelName), zap.String("channelURL", channelURLStr), zap.Error(err))
+				continue
+			}
+			channelURL.Host = host
+		}
+
+		channelURLs = append(channelURLs, *channelURL)
+	}
+	return channelURLs, nil
+}
@@ -0,0 +1,74 @@
+package hwctc
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseChannelURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		urls    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			urls: "igmp://239.1.1.1:5000|http://10.0.0.1/live/1",
+			want: []string{"igmp://239.1.1.1:5000", "http://10.0.0.1/live/1"},
+		},
+		{
+			name: "normalize_port",
+			urls: "igmp://239.1.1.1:05000",
+			want: []string{"igmp://239.1.1.1:5000"},
+		},
+		{
+			name: "skip_missing_port",
+			urls: "igmp://239.1.1.1|http://10.0.0.1/live/1",
+			want: []string{"http://10.0.0.1/live/1"},
+		},
+		{
+			name: "skip_invalid_ip",
+			urls: "igmp://239.1.300.1:5000",
+			want: []string{},
+		},
+		{
+			name:    "strict_invalid_ip",
+			strict:  true,
+			urls:    "igmp://239.1.300.1:5000|http://10.0.0.1/live/1",
+			wantErr: true,
+		},
+		{
+			name:   "strict_valid",
+			strict: true,
+			urls:   "igmp://239.1.1.1:5000",
+			want:   []string{"igmp://239.1.1.1:5000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				config: &Config{StrictMulticast: tt.strict},
+				logger: zap.NewNop(),
+			}
+			channelURLs, err := c.parseChannelURLs("CCTV1", tt.urls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChannelURLs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(channelURLs) != len(tt.want) {
+				t.Fatalf("parseChannelURLs() = %v, want %v", channelURLs, tt.want)
+			}
+			for i, channelURL := range channelURLs {
+				if channelURL.String() != tt.want[i] {
+					t.Errorf("channelURLs[%d] = %s, want %s", i, channelURL.String(), tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -3,8 +3,12 @@ package hwctc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"iptv/internal/app/iptv"
+	"math/rand"
 	"slices"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -13,6 +17,7 @@ var (
 	ErrParseChProgList   = errors.New("failed to parse channel program list")
 	ErrChProgListIsEmpty = errors.New("the list of programs is empty")
 	ErrEPGApiNotFound    = errors.New("epg api not found")
+	ErrEPGChannelTimeout = errors.New("timed out getting the channel program list")
 )
 
 const (
@@ -23,61 +28,97 @@ const (
 	chProgAPIVsp             = "vsp"
 	chProgAPIStbEpg2023Group = "StbEpg2023Group"
 	chProgAPIDefaulttrans2   = "defaulttrans2"
+	chProgAPIPlaybill        = "playbill"
 )
 
+// IsValidChannelProgramAPI 判断是否为支持的节目单API接口，空字符串表示自动选择
+func IsValidChannelProgramAPI(api string) bool {
+	switch api {
+	case "", chProgAPILiveplay, chProgAPIGdhdpublic, chProgAPIVsp, chProgAPIStbEpg2023Group, chProgAPIDefaulttrans2, chProgAPIPlaybill:
+		return true
+	default:
+		return false
+	}
+}
+
 type getChannelProgramListFunc func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error)
 
 // GetAllChannelProgramList 获取所有频道的节目单列表
 func (c *Client) GetAllChannelProgramList(ctx context.Context, channels []iptv.Channel) ([]iptv.ChannelProgramList, error) {
 	// 请求认证的Token
-	token, err := c.requestToken(ctx)
+	token, err := c.getToken(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// 本次刷新中所有频道共享的重试预算
+	budget := newRetryBudget(c.config.EPGRetryBudget)
+
+	// 读取上次中断的刷新进度
+	checkpoint, err := c.loadEPGCheckpoint(time.Now())
+	if err != nil {
+		c.logger.Warn("Failed to load the EPG checkpoint, refresh all channels.", zap.Error(err))
+		checkpoint = nil
+	} else if checkpoint.len() > 0 {
+		c.logger.Info("Resume the EPG refresh from the checkpoint.", zap.Int("channels", checkpoint.len()))
+	}
+
 	var result []iptv.ChannelProgramList
 	switch c.config.ChannelProgramAPI {
 	case chProgAPILiveplay:
-		result, err = c.getAllChannelProgramList(ctx, channels, token, c.getLiveplayChannelProgramList)
+		result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getLiveplayChannelProgramList)
 	case chProgAPIGdhdpublic:
-		result, err = c.getAllChannelProgramList(ctx, channels, token, c.getGdhdpublicChannelProgramList)
+		result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getGdhdpublicChannelProgramList)
 	case chProgAPIVsp:
-		result, err = c.getAllChannelProgramList(ctx, channels, token, c.getVspChannelProgramList)
+		result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getVspChannelProgramList)
 	case chProgAPIStbEpg2023Group:
-		result, err = c.getStbEpg2023GroupAllChannelProgramList(ctx, channels, token)
+		result, err = c.getStbEpg2023GroupAllChannelProgramList(ctx, channels, token, budget, checkpoint)
 	case chProgAPIDefaulttrans2:
-		result, err = c.getAllChannelProgramList(ctx, channels, token, c.getDefaulttrans2ChannelProgramList)
+		result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getDefaulttrans2ChannelProgramList)
+	case chProgAPIPlaybill:
+		result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getPlaybillChannelProgramList)
 	default:
 		// 自动选择调用EPG的API接口
-		result, err = c.getAllChannelProgramListByAuto(ctx, channels, token)
+		result, err = c.getAllChannelProgramListByAuto(ctx, channels, token, budget, checkpoint)
 	}
 
+	// 本轮刷新完成后，清除刷新进度
+	if err == nil {
+		if clearErr := checkpoint.clear(); clearErr != nil {
+			c.logger.Warn("Failed to clear the EPG checkpoint.", zap.Error(clearErr))
+		}
+	}
 	return result, err
 }
 
 // getAllChannelProgramList 获取所有频道的节目单列表
-func (c *Client) getAllChannelProgramList(ctx context.Context, channels []iptv.Channel, token *Token, getChProgFunc getChannelProgramListFunc) ([]iptv.ChannelProgramList, error) {
+func (c *Client) getAllChannelProgramList(ctx context.Context, channels []iptv.Channel, token *Token, budget *retryBudget, checkpoint *epgCheckpoint,
+	getChProgFunc getChannelProgramListFunc) ([]iptv.ChannelProgramList, error) {
 	epg := make([]iptv.ChannelProgramList, 0, len(channels))
+	var timedOut []string
+	defer func() { c.logTimedOutChannels(timedOut) }()
 	for _, channel := range channels {
 		// 跳过不支持回看的频道
 		if channel.TimeShift != "1" || channel.TimeShiftLength <= 0 {
 			continue
 		}
 
-		progList, err := getChProgFunc(ctx, token, &channel)
+		progList, err := c.getChannelProgramListWithRetry(ctx, token, &channel, budget, checkpoint, getChProgFunc)
 		if err != nil {
 			if errors.Is(err, ErrEPGApiNotFound) {
 				return nil, err
 			}
+			if errors.Is(err, ErrEPGChannelTimeout) {
+				timedOut = append(timedOut, channel.ChannelName)
+			}
 			c.logger.Sugar().Warnf("Failed to get the program list for channel %s. Error: %v", channel.ChannelName, err)
+			iptv.RecordEPGError(ctx, &channel, err)
 			continue
 		}
 
 		if progList != nil && len(progList.DateProgramList) > 0 {
-			// 对频道的节目单按日期升序排序
-			slices.SortFunc(progList.DateProgramList, func(a, b iptv.DateProgram) int {
-				return a.Date.Compare(b.Date)
-			})
+			// 对频道的节目单排序，并检查重叠的节目
+			c.sortChannelProgramList(progList)
 
 			epg = append(epg, *progList)
 		}
@@ -86,42 +127,173 @@ func (c *Client) getAllChannelProgramList(ctx context.Context, channels []iptv.C
 }
 
 // getAllChannelProgramListByAuto 自动选择调用EPG的API接口
-func (c *Client) getAllChannelProgramListByAuto(ctx context.Context, channels []iptv.Channel, token *Token) ([]iptv.ChannelProgramList, error) {
-	result, err := c.getAllChannelProgramList(ctx, channels, token, c.getLiveplayChannelProgramList)
+func (c *Client) getAllChannelProgramListByAuto(ctx context.Context, channels []iptv.Channel, token *Token, budget *retryBudget, checkpoint *epgCheckpoint) ([]iptv.ChannelProgramList, error) {
+	result, err := c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getLiveplayChannelProgramList)
 	if !errors.Is(err, ErrEPGApiNotFound) {
 		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPILiveplay))
 		c.config.ChannelProgramAPI = chProgAPILiveplay
 		return result, err
 	}
 
-	result, err = c.getAllChannelProgramList(ctx, channels, token, c.getGdhdpublicChannelProgramList)
+	result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getGdhdpublicChannelProgramList)
 	if !errors.Is(err, ErrEPGApiNotFound) {
 		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPIGdhdpublic))
 		c.config.ChannelProgramAPI = chProgAPIGdhdpublic
 		return result, err
 	}
 
-	result, err = c.getAllChannelProgramList(ctx, channels, token, c.getVspChannelProgramList)
+	result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getVspChannelProgramList)
 	if !errors.Is(err, ErrEPGApiNotFound) {
 		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPIVsp))
 		c.config.ChannelProgramAPI = chProgAPIVsp
 		return result, err
 	}
 
-	result, err = c.getStbEpg2023GroupAllChannelProgramList(ctx, channels, token)
+	result, err = c.getStbEpg2023GroupAllChannelProgramList(ctx, channels, token, budget, checkpoint)
 	if !errors.Is(err, ErrEPGApiNotFound) {
 		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPIStbEpg2023Group))
 		c.config.ChannelProgramAPI = chProgAPIStbEpg2023Group
 		return result, err
 	}
 
-	result, err = c.getAllChannelProgramList(ctx, channels, token, c.getDefaulttrans2ChannelProgramList)
+	result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getDefaulttrans2ChannelProgramList)
 	if !errors.Is(err, ErrEPGApiNotFound) {
 		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPIDefaulttrans2))
 		c.config.ChannelProgramAPI = chProgAPIDefaulttrans2
 		return result, err
 	}
 
+	// 以上地区的接口均不存在时，使用通用的getProgramInfo.jsp接口
+	result, err = c.getAllChannelProgramList(ctx, channels, token, budget, checkpoint, c.getPlaybillChannelProgramList)
+	if !errors.Is(err, ErrEPGApiNotFound) {
+		c.logger.Info("An available EPG API was found.", zap.String("channelProgramAPI", chProgAPIPlaybill))
+		c.config.ChannelProgramAPI = chProgAPIPlaybill
+		return result, err
+	}
+
 	c.logger.Warn("No suitable EPG API found.")
 	return nil, err
 }
+
+// getChannelProgramListWithRetry 获取指定频道的节目单列表（失败重试）
+func (c *Client) getChannelProgramListWithRetry(ctx context.Context, token *Token, channel *iptv.Channel, budget *retryBudget, checkpoint *epgCheckpoint,
+	getChProgFunc getChannelProgramListFunc) (*iptv.ChannelProgramList, error) {
+	// 本轮刷新中已获取过节目单的频道，直接使用已保存的结果
+	if progList, ok := checkpoint.get(channel.ChannelID); ok {
+		return progList, nil
+	}
+
+	// 请求前随机延迟一段时间，避免请求过于密集
+	if delay := c.epgDelay(); delay > 0 {
+		if err := waitRetryAfter(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	// 限制单个频道（含重试）的总耗时，避免个别频道的上游连接挂起时阻塞整个刷新
+	parentCtx := ctx
+	if c.config.EPGChannelTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.config.EPGChannelTimeout)*time.Second)
+		defer cancel()
+	}
+
+	progList, err := getChProgFunc(ctx, token, channel)
+	for i := 0; i < c.config.EPGRetries && err != nil; i++ {
+		// 接口不存在或请求已取消时，无需重试
+		if errors.Is(err, ErrEPGApiNotFound) || ctx.Err() != nil {
+			break
+		}
+
+		// 重试预算耗尽后，剩余频道直接失败
+		if !budget.take() {
+			if budget.markExhausted() {
+				c.logger.Warn("The EPG retry budget has been exhausted, the remaining channels will not be retried.",
+					zap.Int("epgRetryBudget", c.config.EPGRetryBudget))
+			}
+			break
+		}
+
+		// 被上游限流时，按照要求的时间等待后再重试
+		var rateLimitErr *iptv.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.logger.Warn("The upstream is rate limited, wait before retrying.", zap.String("channelName", channel.ChannelName), zap.Duration("retryAfter", rateLimitErr.RetryAfter))
+			if waitErr := waitRetryAfter(ctx, rateLimitErr.RetryAfter); waitErr != nil {
+				break
+			}
+		}
+
+		c.logger.Sugar().Debugf("Retry to get the program list for channel %s (%d/%d). Error: %v", channel.ChannelName, i+1, c.config.EPGRetries, err)
+		progList, err = getChProgFunc(ctx, token, channel)
+	}
+
+	// 超过单个频道的超时时间时，放弃该频道
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+		c.logger.Warn("Timed out getting the program list, skip the channel.", zap.String("channelName", channel.ChannelName),
+			zap.Int("epgChannelTimeout", c.config.EPGChannelTimeout))
+		return nil, fmt.Errorf("%w (%ds): %w", ErrEPGChannelTimeout, c.config.EPGChannelTimeout, err)
+	}
+
+	// 保存频道的刷新进度
+	if err == nil {
+		if saveErr := checkpoint.save(channel.ChannelID, progList, time.Now()); saveErr != nil {
+			c.logger.Warn("Failed to save the EPG checkpoint.", zap.String("channelName", channel.ChannelName), zap.Error(saveErr))
+		}
+	}
+	return progList, err
+}
+
+// logTimedOutChannels 汇总输出因超时被跳过的频道
+func (c *Client) logTimedOutChannels(channelNames []string) {
+	if len(channelNames) == 0 {
+		return
+	}
+	c.logger.Warn("Skipped channels whose program list timed out.", zap.Int("count", len(channelNames)), zap.Strings("channels", channelNames))
+}
+
+// epgDelay 获取请求单个频道节目单前的随机延迟，范围为[EPGDelayMin, EPGDelayMax]
+func (c *Client) epgDelay() time.Duration {
+	minDelay := time.Duration(c.config.EPGDelayMin) * time.Millisecond
+	maxDelay := time.Duration(c.config.EPGDelayMax) * time.Millisecond
+	if maxDelay <= minDelay {
+		return minDelay
+	}
+	return minDelay + time.Duration(rand.Int63n(int64(maxDelay-minDelay)+1))
+}
+
+// retryBudget 单次刷新节目单时，所有频道共享的重试预算
+type retryBudget struct {
+	remaining atomic.Int64
+	exhausted atomic.Bool
+}
+
+func newRetryBudget(size int) *retryBudget {
+	b := &retryBudget{}
+	b.remaining.Store(int64(size))
+	return b
+}
+
+// take 消耗一次重试机会，预算耗尽时返回false
+func (b *retryBudget) take() bool {
+	return b.remaining.Add(-1) >= 0
+}
+
+// markExhausted 标记预算已耗尽，仅首次标记时返回true
+func (b *retryBudget) markExhausted() bool {
+	return b.exhausted.CompareAndSwap(false, true)
+}
+
+// sortChannelProgramList 对频道的节目单按日期及节目的开始时间升序排序，并记录时间重叠的节目
+func (c *Client) sortChannelProgramList(progList *iptv.ChannelProgramList) {
+	slices.SortFunc(progList.DateProgramList, func(a, b iptv.DateProgram) int {
+		return a.Date.Compare(b.Date)
+	})
+
+	for _, dateProgList := range progList.DateProgramList {
+		iptv.SortPrograms(dateProgList.ProgramList)
+		for _, program := range iptv.FindOverlappingPrograms(dateProgList.ProgramList) {
+			c.logger.Warn("The program overlaps with the previous one.", zap.String("channelName", progList.ChannelName),
+				zap.String("programName", program.ProgramName), zap.String("beginTime", program.BeginTimeFormat))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package hwctc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"iptv/internal/app/iptv"
+	"iptv/internal/pkg/util"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultEPGResumeMaxAge = 60               // 缺省的刷新进度有效期，单位为分钟
+	maxCheckpointLineSize  = 64 * 1024 * 1024 // 进度文件中单个频道的最大大小
+)
+
+// epgCheckpoint 节目单的刷新进度，刷新中断后再次刷新时，跳过本轮已获取过节目单的频道
+type epgCheckpoint struct {
+	filePath string
+	entries  map[string]epgCheckpointEntry
+}
+
+// epgCheckpointEntry 单个频道的节目单获取结果，在进度文件中每行保存一个频道（JSON Lines）
+type epgCheckpointEntry struct {
+	ChannelID   string                  `json:"channelID"`   // 频道ID
+	FetchedAt   time.Time               `json:"fetchedAt"`   // 获取节目单的时间
+	ProgramList iptv.ChannelProgramList `json:"programList"` // 频道的节目单列表
+}
+
+// loadEPGCheckpoint 开启断点续传时，读取节目单的刷新进度；未开启时返回nil
+func (c *Client) loadEPGCheckpoint(now time.Time) (*epgCheckpoint, error) {
+	if c.config.EPGResumeFile == "" {
+		return nil, nil
+	}
+
+	// 相对路径时，在程序所在的目录中保存进度文件
+	filePath := c.config.EPGResumeFile
+	if !filepath.IsAbs(filePath) {
+		currDir, err := util.GetCurrentAbPathByExecutable()
+		if err != nil {
+			return nil, err
+		}
+		filePath = filepath.Join(currDir, filePath)
+	}
+
+	return loadEPGCheckpointFile(filePath, time.Duration(c.config.EPGResumeMaxAge)*time.Minute, now)
+}
+
+// loadEPGCheckpointFile 读取进度文件，丢弃超过有效期的频道，并压缩重复及过期的记录
+func loadEPGCheckpointFile(filePath string, maxAge time.Duration, now time.Time) (*epgCheckpoint, error) {
+	cp := &epgCheckpoint{
+		filePath: filePath,
+		entries:  make(map[string]epgCheckpointEntry),
+	}
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// 同一频道以最后一行为准；进程中断时最后一行可能不完整，跳过无法解析的行
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxCheckpointLineSize)
+	for scanner.Scan() {
+		lines++
+		var entry epgCheckpointEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ChannelID == "" {
+			continue
+		}
+		if now.Sub(entry.FetchedAt) <= maxAge {
+			cp.entries[entry.ChannelID] = entry
+		} else {
+			delete(cp.entries, entry.ChannelID)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// 存在重复、过期或不完整的记录时，重写进度文件
+	if lines != len(cp.entries) {
+		if err = cp.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+// compact 按当前保存的频道重写进度文件
+func (cp *epgCheckpoint) compact() error {
+	var buf bytes.Buffer
+	for _, channelID := range util.SortedMapKeys(cp.entries) {
+		line, err := json.Marshal(cp.entries[channelID])
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	// 先写入临时文件再重命名，避免进程中断时进度文件不完整
+	tmpFilePath := cp.filePath + ".tmp"
+	if err := os.WriteFile(tmpFilePath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilePath, cp.filePath)
+}
+
+// len 获取已完成的频道数量
+func (cp *epgCheckpoint) len() int {
+	if cp == nil {
+		return 0
+	}
+	return len(cp.entries)
+}
+
+// get 获取频道在本轮刷新中已获取的节目单
+func (cp *epgCheckpoint) get(channelID string) (*iptv.ChannelProgramList, bool) {
+	if cp == nil {
+		return nil, false
+	}
+	entry, ok := cp.entries[channelID]
+	if !ok {
+		return nil, false
+	}
+	progList := entry.ProgramList
+	return &progList, true
+}
+
+// save 记录频道的节目单，并立即追加到进度文件，不重写已保存的频道
+func (cp *epgCheckpoint) save(channelID string, progList *iptv.ChannelProgramList, now time.Time) error {
+	if cp == nil || progList == nil {
+		return nil
+	}
+	entry := epgCheckpointEntry{
+		ChannelID:   channelID,
+		FetchedAt:   now,
+		ProgramList: *progList,
+	}
+	cp.entries[channelID] = entry
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(cp.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// clear 本轮刷新完成后，删除进度文件
+func (cp *epgCheckpoint) clear() error {
+	if cp == nil {
+		return nil
+	}
+	cp.entries = make(map[string]epgCheckpointEntry)
+	if err := os.Remove(cp.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -18,6 +18,15 @@ type defaulttrans2Respone struct {
 	Title []string                   `json:"title"`
 }
 
+// defaulttrans2DataKeys 节目单列表可能使用的字段名称，部分地区的接口与标准格式存在差异
+var defaulttrans2DataKeys = []string{"data", "progList", "list"}
+
+// epgIndexRetryBackoff 按日期请求节目单失败后，首次重试前的等待时间，之后每次翻倍
+const epgIndexRetryBackoff = 500 * time.Millisecond
+
+// defaulttrans2WrapperKeys 外层带有状态信息时，节目单内容可能所在的字段名称
+var defaulttrans2WrapperKeys = []string{"data", "result"}
+
 type defaulttrans2ChannelProg struct {
 	ProgName    string `json:"progName"`
 	ScrollFlag  int    `json:"scrollFlag"`
@@ -30,7 +39,7 @@ type defaulttrans2ChannelProg struct {
 
 // getDefaulttrans2ChannelProgramList 获取指定频道的节目单列表（sd）
 func (c *Client) getDefaulttrans2ChannelProgramList(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
-	now := time.Now()
+	now := c.now()
 	now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 
 	// 从当天开始往前，倒查多个日期的节目单
@@ -42,7 +51,9 @@ func (c *Client) getDefaulttrans2ChannelProgramList(ctx context.Context, token *
 		// 获取指定日期的节目单列表
 		programList, chDateSize, err := c.getDefaulttrans2ChannelDateProgram(ctx, token, channel, date, -i)
 		if err != nil {
-			if errors.Is(err, ErrEPGApiNotFound) {
+			// 接口不存在或被上游限流时，不再请求剩余日期的节目单
+			var rateLimitErr *iptv.RateLimitError
+			if errors.Is(err, ErrEPGApiNotFound) || errors.As(err, &rateLimitErr) {
 				return nil, err
 			}
 			c.logger.Sugar().Warnf("Failed to get the program list for channel %s on %s (index: %d). Error: %v", channel.ChannelName, date.Format("20060102"), -i, err)
@@ -82,7 +93,8 @@ func (c *Client) getDefaulttrans2ChannelDateProgram(ctx context.Context, token *
 
 	// 设置请求头
 	c.setCommonHeaders(req)
-	req.Header.Set("Referer", fmt.Sprintf("http://%s/EPG/jsp/defaulttrans2/en/chanMiniList.html", c.host))
+	c.setReferer(req, c.getReferers().EPG,
+		fmt.Sprintf("http://%s/EPG/jsp/defaulttrans2/en/chanMiniList.html", c.host))
 
 	// 设置Cookie
 	cookies := []*http.Cookie{
@@ -99,31 +111,111 @@ func (c *Client) getDefaulttrans2ChannelDateProgram(ctx context.Context, token *
 		req.AddCookie(cookie)
 	}
 
-	// 执行请求
-	resp, err := c.httpClient.Do(req)
+	// 执行请求，遇到网络错误或5xx时重试
+	resp, err := c.doDefaulttrans2Request(ctx, req, channel, index)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, 0, err
+	}
+
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
 		return nil, 0, ErrEPGApiNotFound
 	} else if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, 0, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
-	var response defaulttrans2Respone
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	body, err := c.readResponseBody(resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	response, envelope, err := decodeDefaulttrans2Response(body)
+	if err != nil {
 		return nil, 0, fmt.Errorf("parse response failed: %w", err)
 	}
+	// 非标准格式时，记录匹配的响应格式
+	if envelope != "" && envelope != "data" {
+		c.logger.Sugar().Debugf("The program list of channel %s matched the response envelope: %s.", channel.ChannelName, envelope)
+	}
 
 	// 解析节目单信息
-	return parseDefaulttrans2ChannelDateProgram(response, date, index)
+	return parseDefaulttrans2ChannelDateProgram(response, date, index, c.progTitleRules,
+		time.Duration(c.config.ProgSnapSeconds)*time.Second, c.config.TimeLocation)
+}
+
+// doDefaulttrans2Request 执行节目单请求，遇到网络错误或5xx时按指数退避重试，其他响应直接返回
+func (c *Client) doDefaulttrans2Request(ctx context.Context, req *http.Request, channel *iptv.Channel, index int) (*http.Response, error) {
+	backoff := epgIndexRetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if attempt > c.config.EPGIndexRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if err == nil {
+			resp.Body.Close()
+			err = c.statusCodeError(resp.StatusCode)
+		}
+		c.logger.Sugar().Debugf("Failed to get the program list for channel %s (index: %d), will try again after waiting %s. Attempt: %d, error: %v",
+			channel.ChannelName, index, backoff, attempt, err)
+		if err = waitRetryAfter(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// decodeDefaulttrans2Response 解析节目单的响应内容，兼容几种已知的响应格式，并返回匹配的格式
+// 依次尝试顶层的节目单字段，以及外层状态包装内的节目单字段，均不匹配时返回空的节目单
+func decodeDefaulttrans2Response(body []byte) (defaulttrans2Respone, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return defaulttrans2Respone{}, "", err
+	}
+
+	if response, key, ok := matchDefaulttrans2Fields(fields); ok {
+		return response, key, nil
+	}
+	for _, wrapperKey := range defaulttrans2WrapperKeys {
+		var innerFields map[string]json.RawMessage
+		if err := json.Unmarshal(fields[wrapperKey], &innerFields); err != nil {
+			continue
+		}
+		if response, key, ok := matchDefaulttrans2Fields(innerFields); ok {
+			// 日期列表不在包装内时，使用外层的日期列表
+			if len(response.Title) == 0 {
+				_ = json.Unmarshal(fields["title"], &response.Title)
+			}
+			return response, wrapperKey + "." + key, nil
+		}
+	}
+	return defaulttrans2Respone{}, "", nil
+}
+
+// matchDefaulttrans2Fields 按照已知的字段名称查找非空的节目单列表
+func matchDefaulttrans2Fields(fields map[string]json.RawMessage) (defaulttrans2Respone, string, bool) {
+	var response defaulttrans2Respone
+	for _, key := range defaulttrans2DataKeys {
+		if err := json.Unmarshal(fields[key], &response.Data); err == nil && len(response.Data) > 0 {
+			_ = json.Unmarshal(fields["title"], &response.Title)
+			return response, key, true
+		}
+	}
+	return defaulttrans2Respone{}, "", false
 }
 
 // parseDefaulttrans2ChannelDateProgram 解析频道节目单列表
-func parseDefaulttrans2ChannelDateProgram(response defaulttrans2Respone, date time.Time, index int) ([]iptv.Program, int, error) {
+// snapTolerance大于0时，对齐相邻节目之间的微小间隔或重叠，loc为节目时间所在的时区
+func parseDefaulttrans2ChannelDateProgram(response defaulttrans2Respone, date time.Time, index int,
+	progTitleRules []iptv.ProgramTitleRule, snapTolerance time.Duration, loc *time.Location) ([]iptv.Program, int, error) {
 	if len(response.Data) == 0 {
 		return nil, 0, ErrChProgListIsEmpty
 	} else if len(response.Title) == 0 {
@@ -172,16 +264,21 @@ func parseDefaulttrans2ChannelDateProgram(response defaulttrans2Respone, date ti
 
 		// 组装节目单对象
 		programList = append(programList, iptv.Program{
-			ProgramName:     prog.ProgName,
+			ProgramName:     iptv.CleanProgramTitle(progTitleRules, prog.ProgName),
 			BeginTimeFormat: bTime.Format("20060102150405"),
 			EndTimeFormat:   eTime.Format("20060102150405"),
 			StartTime:       startTimeStr,
 			EndTime:         endTimeStr,
+			SubTitle:        strings.TrimSpace(prog.SubProgName),
 		})
 		// 丢弃后续第二天的节目单数据，如果存在的话
 		if endTimeStr == "23:59" {
 			break
 		}
 	}
+
+	// 按开始时间排序后，对齐相邻节目的时间
+	iptv.SortPrograms(programList)
+	iptv.SnapProgramTimes(programList, snapTolerance, loc)
 	return programList, len(response.Title), nil
 }
@@ -0,0 +1,305 @@
+package hwctc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseDefaulttrans2ChannelDateProgramTitleRules(t *testing.T) {
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	response := defaulttrans2Respone{
+		Title: []string{"21日", "22日"},
+		Data: []defaulttrans2ChannelProg{
+			{ProgName: "[直播]新闻联播 ", StartTime: "19:00", EndTime: "19:30", SubProgName: " 第1集 "},
+			{ProgName: "天气预报(重播)", StartTime: "19:30", EndTime: "20:00"},
+			{ProgName: "焦点访谈", StartTime: "20:00", EndTime: "20:30"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		progTitleRules []iptv.ProgramTitleRule
+		want           []string
+	}{
+		{
+			name: "unconfigured",
+			want: []string{"[直播]新闻联播 ", "天气预报(重播)", "焦点访谈"},
+		},
+		{
+			name: "cleanup",
+			progTitleRules: []iptv.ProgramTitleRule{
+				{Rule: regexp.MustCompile(`^\[直播\]`)},
+				{Rule: regexp.MustCompile(`\s+$`)},
+				{Rule: regexp.MustCompile(`\((重播)\)$`), Replace: "[$1]"},
+			},
+			want: []string{"新闻联播", "天气预报[重播]", "焦点访谈"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			programList, dateSize, err := parseDefaulttrans2ChannelDateProgram(response, date, 0, tt.progTitleRules, 0, nil)
+			if err != nil {
+				t.Fatalf("parseDefaulttrans2ChannelDateProgram() error = %v", err)
+			}
+			if dateSize != 2 {
+				t.Errorf("dateSize = %d, want 2", dateSize)
+			}
+			if len(programList) != len(tt.want) {
+				t.Fatalf("len(programList) = %d, want %d", len(programList), len(tt.want))
+			}
+			for i, program := range programList {
+				if program.ProgramName != tt.want[i] {
+					t.Errorf("programList[%d].ProgramName = %q, want %q", i, program.ProgramName, tt.want[i])
+				}
+			}
+			// 副标题去除首尾空白，没有副标题的节目为空
+			if programList[0].SubTitle != "第1集" || programList[1].SubTitle != "" {
+				t.Errorf("SubTitle = %q, %q, want %q, %q", programList[0].SubTitle, programList[1].SubTitle, "第1集", "")
+			}
+		})
+	}
+}
+
+func TestParseDefaulttrans2ChannelDateProgramSnap(t *testing.T) {
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	response := defaulttrans2Respone{
+		Title: []string{"21日", "22日"},
+		Data: []defaulttrans2ChannelProg{
+			{ProgName: "早间新闻", StartTime: "06:00", EndTime: "19:00"},
+			{ProgName: "新闻联播", StartTime: "19:00", EndTime: "19:29"},
+			{ProgName: "天气预报", StartTime: "19:30", EndTime: "20:01"},
+			{ProgName: "焦点访谈", StartTime: "20:00", EndTime: "20:30"},
+			{ProgName: "电视剧", StartTime: "20:40", EndTime: "22:00"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		snapTolerance time.Duration
+		wantEnds      []string
+	}{
+		{
+			name:     "disabled",
+			wantEnds: []string{"20241122190000", "20241122192900", "20241122200100", "20241122203000", "20241122220000"},
+		},
+		{
+			name:          "snap_within_one_minute",
+			snapTolerance: time.Minute,
+			wantEnds:      []string{"20241122190000", "20241122193000", "20241122200000", "20241122203000", "20241122220000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			programList, _, err := parseDefaulttrans2ChannelDateProgram(response, date, 0, nil, tt.snapTolerance, time.Local)
+			if err != nil {
+				t.Fatalf("parseDefaulttrans2ChannelDateProgram() error = %v", err)
+			}
+			if len(programList) != len(tt.wantEnds) {
+				t.Fatalf("len(programList) = %d, want %d", len(programList), len(tt.wantEnds))
+			}
+			for i, program := range programList {
+				if program.EndTimeFormat != tt.wantEnds[i] {
+					t.Errorf("programList[%d].EndTimeFormat = %s, want %s", i, program.EndTimeFormat, tt.wantEnds[i])
+				}
+				// 结束时间与下一个节目的开始时间保持一致
+				if i < len(programList)-1 && program.EndTimeFormat == programList[i+1].BeginTimeFormat &&
+					program.EndTime != programList[i+1].StartTime {
+					t.Errorf("programList[%d].EndTime = %s, want %s", i, program.EndTime, programList[i+1].StartTime)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDefaulttrans2Response(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantEnvelope string
+		wantProgs    int
+		wantTitles   int
+	}{
+		{
+			name:         "standard",
+			body:         `{"data":[{"progName":"新闻联播","startTime":"19:00","endTime":"19:30"}],"title":["21日","22日"]}`,
+			wantEnvelope: "data",
+			wantProgs:    1,
+			wantTitles:   2,
+		},
+		{
+			name:         "alternate key",
+			body:         `{"progList":[{"progName":"新闻联播","startTime":"19:00","endTime":"19:30"},{"progName":"焦点访谈","startTime":"19:30","endTime":"20:00"}],"title":["22日"]}`,
+			wantEnvelope: "progList",
+			wantProgs:    2,
+			wantTitles:   1,
+		},
+		{
+			name:         "status wrapper",
+			body:         `{"status":"0","result":{"data":[{"progName":"新闻联播","startTime":"19:00","endTime":"19:30"}],"title":["21日","22日"]}}`,
+			wantEnvelope: "result.data",
+			wantProgs:    1,
+			wantTitles:   2,
+		},
+		{
+			name:         "status wrapper with outer title",
+			body:         `{"code":0,"data":{"list":[{"progName":"新闻联播","startTime":"19:00","endTime":"19:30"}]},"title":["22日"]}`,
+			wantEnvelope: "data.list",
+			wantProgs:    1,
+			wantTitles:   1,
+		},
+		{
+			name: "unknown",
+			body: `{"status":"0","programs":[{"progName":"新闻联播"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, envelope, err := decodeDefaulttrans2Response([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("decodeDefaulttrans2Response() error = %v", err)
+			}
+			if envelope != tt.wantEnvelope {
+				t.Errorf("envelope = %q, want %q", envelope, tt.wantEnvelope)
+			}
+			if len(response.Data) != tt.wantProgs || len(response.Title) != tt.wantTitles {
+				t.Errorf("len(Data) = %d, len(Title) = %d, want %d, %d", len(response.Data), len(response.Title), tt.wantProgs, tt.wantTitles)
+			}
+		})
+	}
+
+	if _, _, err := decodeDefaulttrans2Response([]byte("<html>")); err == nil {
+		t.Error("decodeDefaulttrans2Response() error = nil, want error")
+	}
+}
+
+func TestGetDefaulttrans2ChannelProgramListDates(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+	}{
+		{name: "same_month", now: time.Date(2024, 11, 22, 10, 30, 0, 0, time.Local)},
+		{name: "cross_month", now: time.Date(2024, 12, 2, 0, 10, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 日期列表以当天结尾，与机顶盒接口的返回保持一致
+			titles := make([]string, 0, 7)
+			for i := 6; i >= 0; i-- {
+				titles = append(titles, tt.now.AddDate(0, 0, -i).Format("02")+"日")
+			}
+
+			var indexes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				indexes = append(indexes, r.URL.Query().Get("index"))
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"title": titles,
+					"data":  []defaulttrans2ChannelProg{{ProgName: "新闻联播", StartTime: "19:00", EndTime: "19:30"}},
+				})
+			}))
+			defer server.Close()
+
+			c := &Client{
+				httpClient: server.Client(),
+				config:     &Config{},
+				host:       strings.TrimPrefix(server.URL, "http://"),
+				nowFunc:    func() time.Time { return tt.now },
+				logger:     zap.NewNop(),
+			}
+			progList, err := c.getDefaulttrans2ChannelProgramList(context.Background(), &Token{}, &iptv.Channel{ChannelID: "1", ChannelName: "CCTV1"})
+			if err != nil {
+				t.Fatalf("getDefaulttrans2ChannelProgramList() error = %v", err)
+			}
+
+			wantIndexes := []string{"0", "-1", "-2", "-3", "-4", "-5", "-6"}
+			if strings.Join(indexes, ",") != strings.Join(wantIndexes, ",") {
+				t.Errorf("indexes = %v, want %v", indexes, wantIndexes)
+			}
+			if len(progList.DateProgramList) != len(wantIndexes) {
+				t.Fatalf("len(DateProgramList) = %d, want %d", len(progList.DateProgramList), len(wantIndexes))
+			}
+			for i, dateProgram := range progList.DateProgramList {
+				want := tt.now.AddDate(0, 0, -i).Format("20060102")
+				if got := dateProgram.Date.Format("20060102"); got != want {
+					t.Errorf("DateProgramList[%d].Date = %s, want %s", i, got, want)
+				}
+				if got := dateProgram.ProgramList[0].BeginTimeFormat[:8]; got != want {
+					t.Errorf("DateProgramList[%d] begin date = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDefaulttrans2ChannelDateProgramRetry(t *testing.T) {
+	var waits []time.Duration
+	defaultWait := waitRetryAfter
+	waitRetryAfter = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { waitRetryAfter = defaultWait })
+
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantWaits []time.Duration
+		wantErr   error
+	}{
+		{name: "recovered", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, wantCalls: 3,
+			wantWaits: []time.Duration{epgIndexRetryBackoff, 2 * epgIndexRetryBackoff}},
+		{name: "exhausted", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, wantCalls: 3,
+			wantWaits: []time.Duration{epgIndexRetryBackoff, 2 * epgIndexRetryBackoff}, wantErr: ErrEPGApiNotFound},
+		{name: "not_found", statuses: []int{http.StatusNotFound}, wantCalls: 1, wantErr: ErrEPGApiNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits = nil
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(calls, len(tt.statuses)-1)]
+				calls++
+				w.WriteHeader(status)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"title": []string{"21日", "22日"},
+					"data":  []defaulttrans2ChannelProg{{ProgName: "新闻联播", StartTime: "19:00", EndTime: "19:30"}},
+				})
+			}))
+			defer server.Close()
+
+			c := &Client{
+				httpClient: server.Client(),
+				config:     &Config{EPGIndexRetries: 2},
+				host:       strings.TrimPrefix(server.URL, "http://"),
+				logger:     zap.NewNop(),
+			}
+			_, _, err := c.getDefaulttrans2ChannelDateProgram(context.Background(), &Token{}, &iptv.Channel{ChannelID: "1", ChannelName: "CCTV1"}, date, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getDefaulttrans2ChannelDateProgram() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if !slices.Equal(waits, tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
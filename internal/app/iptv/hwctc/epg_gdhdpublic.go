@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"iptv/internal/app/iptv"
 	"net/http"
 	"time"
@@ -28,7 +27,7 @@ type gdhdpublicChannelProgramList struct {
 // getGdhdpublicChannelProgramList 获取指定频道的节目单列表（zj）
 func (c *Client) getGdhdpublicChannelProgramList(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
 	// 获取未来一天的日期
-	tomorrow := time.Now().AddDate(0, 0, 1)
+	tomorrow := c.now().AddDate(0, 0, 1)
 	tomorrow = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, tomorrow.Location())
 
 	// 根据当前频道的时移范围，预估EPG的查询时间范围（加上未来一天）
@@ -85,6 +84,7 @@ func (c *Client) getGdhdpublicChannelDateProgram(ctx context.Context, token *Tok
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 
 	// 设置Cookie
 	req.AddCookie(&http.Cookie{
@@ -103,14 +103,19 @@ func (c *Client) getGdhdpublicChannelDateProgram(ctx context.Context, token *Tok
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
 		return nil, ErrEPGApiNotFound
 	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
-	result, err := io.ReadAll(resp.Body)
+	result, err := c.readResponseBody(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"iptv/internal/app/iptv"
 	"net/http"
 	"regexp"
@@ -27,6 +26,7 @@ func (c *Client) getLiveplayChannelProgramList(ctx context.Context, token *Token
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 
 	// 设置Cookie
 	req.AddCookie(&http.Cookie{
@@ -41,14 +41,19 @@ func (c *Client) getLiveplayChannelProgramList(ctx context.Context, token *Token
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
 		return nil, ErrEPGApiNotFound
 	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
-	result, err := io.ReadAll(resp.Body)
+	result, err := c.readResponseBody(resp)
 	if err != nil {
 		return nil, err
 	}
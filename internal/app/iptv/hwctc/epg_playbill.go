@@ -0,0 +1,182 @@
+package hwctc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type playbillResponse struct {
+	PlaybillList []playbill `json:"playbillList"`
+}
+
+type playbill struct {
+	Name      string `json:"name"`
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	SubName   string `json:"subName"`
+}
+
+// playbillTimeLayouts 节目开始和结束时间可能使用的格式，只有时分时使用查询的日期
+var playbillTimeLayouts = []string{"20060102150405", time.DateTime, "2006-01-02 15:04", "15:04:05", "15:04"}
+
+// getPlaybillChannelProgramList 获取指定频道的节目单列表（通用getProgramInfo.jsp接口）
+func (c *Client) getPlaybillChannelProgramList(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+	now := c.now()
+	now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// 根据当前频道的时移范围，预估EPG的查询时间范围
+	epgBackDay := int(channel.TimeShiftLength.Hours() / 24)
+	// 限制EPG查询的最大时间范围
+	if epgBackDay > maxBackDay {
+		epgBackDay = maxBackDay
+	}
+
+	// 从当天开始往前，倒查多个日期的节目单
+	dateProgramList := make([]iptv.DateProgram, 0, epgBackDay+1)
+	for i := 0; i <= epgBackDay; i++ {
+		date := now.AddDate(0, 0, -i)
+
+		// 获取指定日期的节目单列表
+		programList, err := c.getPlaybillChannelDateProgram(ctx, token, channel.ChannelID, date)
+		if err != nil {
+			// 接口不存在或被上游限流时，不再请求剩余日期的节目单
+			var rateLimitErr *iptv.RateLimitError
+			if errors.Is(err, ErrEPGApiNotFound) || errors.As(err, &rateLimitErr) {
+				return nil, err
+			}
+			c.logger.Sugar().Warnf("Failed to get the program list for channel %s on %s. Error: %v", channel.ChannelName, date.Format("20060102"), err)
+			continue
+		}
+
+		dateProgramList = append(dateProgramList, iptv.DateProgram{
+			Date:        date,
+			ProgramList: programList,
+		})
+	}
+
+	return &iptv.ChannelProgramList{
+		ChannelId:       channel.ChannelID,
+		ChannelName:     channel.ChannelName,
+		DateProgramList: dateProgramList,
+	}, nil
+}
+
+// getPlaybillChannelDateProgram 获取指定频道的某日期的节目单列表
+func (c *Client) getPlaybillChannelDateProgram(ctx context.Context, token *Token, channelId string, date time.Time) ([]iptv.Program, error) {
+	// 创建请求
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("http://%s/EPG/jsp/getProgramInfo.jsp", c.host), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 增加请求参数
+	params := req.URL.Query()
+	params.Add("channelId", channelId)
+	params.Add("date", date.Format("20060102"))
+	req.URL.RawQuery = params.Encode()
+
+	// 设置请求头
+	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
+
+	// 设置Cookie
+	req.AddCookie(&http.Cookie{
+		Name:  "JSESSIONID",
+		Value: token.JSESSIONID,
+	})
+
+	// 执行请求
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
+		return nil, ErrEPGApiNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, c.statusCodeError(resp.StatusCode)
+	}
+
+	// 解析响应内容
+	result, err := c.readResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePlaybillChannelDateProgram(result, date, c.progTitleRules)
+}
+
+// parsePlaybillChannelDateProgram 解析频道节目单列表
+func parsePlaybillChannelDateProgram(rawData []byte, date time.Time, progTitleRules []iptv.ProgramTitleRule) ([]iptv.Program, error) {
+	// 解析json
+	var resp playbillResponse
+	if err := json.Unmarshal(rawData, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.PlaybillList) == 0 {
+		return nil, ErrChProgListIsEmpty
+	}
+
+	// 遍历单个日期中的节目单
+	programList := make([]iptv.Program, 0, len(resp.PlaybillList))
+	for _, rawProg := range resp.PlaybillList {
+		bTime, err := parsePlaybillTime(date, rawProg.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		eTime, err := parsePlaybillTime(date, rawProg.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		// 只有时分的跨天节目，结束时间为第二天
+		if !eTime.After(bTime) {
+			eTime = eTime.AddDate(0, 0, 1)
+		}
+
+		programList = append(programList, iptv.Program{
+			ProgramName:     iptv.CleanProgramTitle(progTitleRules, rawProg.Name),
+			BeginTimeFormat: bTime.Format("20060102150405"),
+			EndTimeFormat:   eTime.Format("20060102150405"),
+			StartTime:       bTime.Format("15:04"),
+			EndTime:         eTime.Format("15:04"),
+			SubTitle:        strings.TrimSpace(rawProg.SubName),
+		})
+	}
+
+	iptv.SortPrograms(programList)
+	return programList, nil
+}
+
+// parsePlaybillTime 按已知的几种格式解析节目的时间，只有时分时使用查询的日期
+func parsePlaybillTime(date time.Time, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range playbillTimeLayouts {
+		if len(value) != len(layout) {
+			continue
+		}
+		if !strings.HasPrefix(layout, "15") {
+			if t, err := time.ParseInLocation(layout, value, date.Location()); err == nil {
+				return t, nil
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation("20060102 "+layout, date.Format("20060102")+" "+value, date.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid program time: %q", value)
+}
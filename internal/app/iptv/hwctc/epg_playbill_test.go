@@ -0,0 +1,88 @@
+package hwctc
+
+import (
+	"context"
+	"errors"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParsePlaybillChannelDateProgram(t *testing.T) {
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	rawData := []byte(`{"playbillList":[
+		{"name":"焦点访谈","startTime":"2024-11-22 19:30:00","endTime":"2024-11-22 20:00:00"},
+		{"name":"新闻联播","startTime":"20241122190000","endTime":"20241122193000","subName":" 第1集 "},
+		{"name":"晚间新闻","startTime":"23:30","endTime":"00:30"}
+	]}`)
+
+	programList, err := parsePlaybillChannelDateProgram(rawData, date, nil)
+	if err != nil {
+		t.Fatalf("parsePlaybillChannelDateProgram() error = %v", err)
+	}
+
+	want := []struct {
+		name, begin, end string
+	}{
+		{name: "新闻联播", begin: "20241122190000", end: "20241122193000"},
+		{name: "焦点访谈", begin: "20241122193000", end: "20241122200000"},
+		{name: "晚间新闻", begin: "20241122233000", end: "20241123003000"},
+	}
+	if len(programList) != len(want) {
+		t.Fatalf("len(programList) = %d, want %d", len(programList), len(want))
+	}
+	for i, program := range programList {
+		if program.ProgramName != want[i].name || program.BeginTimeFormat != want[i].begin || program.EndTimeFormat != want[i].end {
+			t.Errorf("programList[%d] = %s %s-%s, want %s %s-%s", i, program.ProgramName, program.BeginTimeFormat, program.EndTimeFormat,
+				want[i].name, want[i].begin, want[i].end)
+		}
+	}
+	if programList[0].SubTitle != "第1集" {
+		t.Errorf("SubTitle = %q, want %q", programList[0].SubTitle, "第1集")
+	}
+
+	if _, err = parsePlaybillChannelDateProgram([]byte(`{"playbillList":[]}`), date, nil); !errors.Is(err, ErrChProgListIsEmpty) {
+		t.Errorf("parsePlaybillChannelDateProgram() error = %v, want %v", err, ErrChProgListIsEmpty)
+	}
+	if _, err = parsePlaybillChannelDateProgram([]byte(`{"playbillList":[{"name":"新闻联播","startTime":"19点","endTime":"19:30"}]}`), date, nil); err == nil {
+		t.Error("parsePlaybillChannelDateProgram() error = nil, want error")
+	}
+}
+
+func TestGetAllChannelProgramListByAutoPlaybill(t *testing.T) {
+	now := time.Date(2024, 11, 22, 10, 30, 0, 0, time.Local)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 只有通用的getProgramInfo.jsp接口存在
+		if r.URL.Path != "/EPG/jsp/getProgramInfo.jsp" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		date := r.URL.Query().Get("date")
+		_, _ = w.Write([]byte(`{"playbillList":[{"name":"新闻联播","startTime":"` + date + `190000","endTime":"` + date + `193000"}]}`))
+	}))
+	defer server.Close()
+
+	c := &Client{
+		httpClient: server.Client(),
+		config:     &Config{},
+		host:       strings.TrimPrefix(server.URL, "http://"),
+		nowFunc:    func() time.Time { return now },
+		logger:     zap.NewNop(),
+	}
+	channels := []iptv.Channel{{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: 48 * time.Hour}}
+	result, err := c.getAllChannelProgramListByAuto(context.Background(), channels, &Token{}, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("getAllChannelProgramListByAuto() error = %v", err)
+	}
+	if c.config.ChannelProgramAPI != chProgAPIPlaybill {
+		t.Errorf("ChannelProgramAPI = %q, want %q", c.config.ChannelProgramAPI, chProgAPIPlaybill)
+	}
+	if len(result) != 1 || len(result[0].DateProgramList) != 3 {
+		t.Fatalf("result = %+v, want 1 channel with 3 dates", result)
+	}
+}
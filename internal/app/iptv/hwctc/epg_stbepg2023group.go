@@ -2,13 +2,12 @@ package hwctc
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"iptv/internal/app/iptv"
 	"iptv/internal/pkg/util"
 	"net/http"
 	"net/url"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -46,7 +45,7 @@ type stbEpg2023GroupChannelProg struct {
 }
 
 // getStbEpg2023GroupAllChannelProgramList 获取全部频道的节目单列表（fj）
-func (c *Client) getStbEpg2023GroupAllChannelProgramList(ctx context.Context, channels []iptv.Channel, token *Token) ([]iptv.ChannelProgramList, error) {
+func (c *Client) getStbEpg2023GroupAllChannelProgramList(ctx context.Context, channels []iptv.Channel, token *Token, budget *retryBudget, checkpoint *epgCheckpoint) ([]iptv.ChannelProgramList, error) {
 	// 获取“全部”类别的ID
 	categoryID, err := c.getStbEpg2023GroupChannelCategoryID(ctx, "全部", token)
 	if err != nil {
@@ -65,6 +64,8 @@ func (c *Client) getStbEpg2023GroupAllChannelProgramList(ctx context.Context, ch
 	}
 
 	epg := make([]iptv.ChannelProgramList, 0, len(channels))
+	var timedOut []string
+	defer func() { c.logTimedOutChannels(timedOut) }()
 	for _, channel := range channels {
 		// 跳过不支持回看的频道
 		if channel.TimeShift != "1" || channel.TimeShiftLength <= 0 {
@@ -78,17 +79,22 @@ func (c *Client) getStbEpg2023GroupAllChannelProgramList(ctx context.Context, ch
 		}
 
 		// 获取单个频道的全部节目单列表
-		progList, err := c.getStbEpg2023GroupChannelProgramList(ctx, token, &channel, chCode)
+		progList, err := c.getChannelProgramListWithRetry(ctx, token, &channel, budget, checkpoint,
+			func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+				return c.getStbEpg2023GroupChannelProgramList(ctx, token, channel, chCode)
+			})
 		if err != nil {
+			if errors.Is(err, ErrEPGChannelTimeout) {
+				timedOut = append(timedOut, channel.ChannelName)
+			}
 			c.logger.Sugar().Warnf("Failed to get the program list for channel %s. Error: %v", channel.ChannelName, err)
+			iptv.RecordEPGError(ctx, &channel, err)
 			continue
 		}
 
 		if progList != nil && len(progList.DateProgramList) > 0 {
-			// 对频道的节目单按日期升序排序
-			slices.SortFunc(progList.DateProgramList, func(a, b iptv.DateProgram) int {
-				return a.Date.Compare(b.Date)
-			})
+			// 对频道的节目单排序，并检查重叠的节目
+			c.sortChannelProgramList(progList)
 
 			epg = append(epg, *progList)
 		}
@@ -116,6 +122,7 @@ func (c *Client) getStbEpg2023GroupChannelCategoryID(ctx context.Context, catego
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 	req.Header.Set("VIS-AJAX", "AjaxHttpRequest")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -132,15 +139,20 @@ func (c *Client) getStbEpg2023GroupChannelCategoryID(ctx context.Context, catego
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return "", err
+	}
+
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
 		return "", ErrEPGApiNotFound
 	} else if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("http status code: %d", resp.StatusCode)
+		return "", c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
 	var response stbEpg2023GroupResponse[[]stbEpg2023GroupCategory]
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err = c.decodeJSONResponse(resp, &response); err != nil {
 		return "", fmt.Errorf("parse response failed: %w", err)
 	} else if response.Status != "1" {
 		// 调用失败
@@ -185,6 +197,7 @@ func (c *Client) getStbEpg2023GroupChannelList(ctx context.Context, categoryID s
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 	req.Header.Set("VIS-AJAX", "AjaxHttpRequest")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -201,13 +214,18 @@ func (c *Client) getStbEpg2023GroupChannelList(ctx context.Context, categoryID s
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
 	var response stbEpg2023GroupResponse[[]stbEpg2023GroupChannel]
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err = c.decodeJSONResponse(resp, &response); err != nil {
 		return nil, fmt.Errorf("parse response failed: %w", err)
 	} else if response.Status != "1" {
 		// 调用失败
@@ -230,7 +248,7 @@ func (c *Client) getStbEpg2023GroupChannelProgramList(ctx context.Context, token
 	}
 
 	// 计算开始、结束时间
-	tomorrow := time.Now().AddDate(0, 0, 1)
+	tomorrow := c.now().AddDate(0, 0, 1)
 	old := tomorrow.AddDate(0, 0, -epgBackDay)
 	startTime := time.Date(old.Year(), old.Month(), old.Day(), 0, 0, 1, 534, tomorrow.Location()).UnixMilli()
 	endTime := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 23, 59, 59, 534, tomorrow.Location()).UnixMilli()
@@ -259,6 +277,7 @@ func (c *Client) getStbEpg2023GroupChannelProgramList(ctx context.Context, token
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 	req.Header.Set("VIS-AJAX", "AjaxHttpRequest")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -275,13 +294,18 @@ func (c *Client) getStbEpg2023GroupChannelProgramList(ctx context.Context, token
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
 	var response stbEpg2023GroupResponse[[]stbEpg2023GroupChannelProg]
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err = c.decodeJSONResponse(resp, &response); err != nil {
 		return nil, fmt.Errorf("parse response failed: %w", err)
 	} else if response.Status != "1" {
 		// 调用失败
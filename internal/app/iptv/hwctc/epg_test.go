@@ -0,0 +1,382 @@
+package hwctc
+
+import (
+	"context"
+	"errors"
+	"iptv/internal/app/iptv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestGetAllChannelProgramListRetryBudget(t *testing.T) {
+	c := &Client{
+		config: &Config{EPGRetries: 3, EPGRetryBudget: 4},
+		logger: zap.NewNop(),
+	}
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "2", ChannelName: "CCTV2", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "3", ChannelName: "CCTV3", TimeShift: "1", TimeShiftLength: time.Hour},
+	}
+
+	calls := make(map[string]int)
+	failing := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		calls[channel.ChannelID]++
+		return nil, errors.New("upstream unavailable")
+	}
+
+	budget := newRetryBudget(c.config.EPGRetryBudget)
+	epg, err := c.getAllChannelProgramList(context.Background(), channels, &Token{}, budget, nil, failing)
+	if err != nil {
+		t.Fatalf("getAllChannelProgramList() error = %v", err)
+	}
+	if len(epg) != 0 {
+		t.Errorf("len(epg) = %d, want 0", len(epg))
+	}
+
+	// 频道1：1次请求+3次重试；频道2：1次请求+1次重试后预算耗尽；频道3：预算耗尽，不再重试
+	want := map[string]int{"1": 4, "2": 2, "3": 1}
+	for id, n := range want {
+		if calls[id] != n {
+			t.Errorf("calls[%s] = %d, want %d", id, calls[id], n)
+		}
+	}
+	if !budget.exhausted.Load() {
+		t.Error("budget should be marked as exhausted")
+	}
+}
+
+func TestGetChannelProgramListWithRetrySuccess(t *testing.T) {
+	c := &Client{
+		config: &Config{EPGRetries: 3, EPGRetryBudget: 10},
+		logger: zap.NewNop(),
+	}
+	channel := iptv.Channel{ChannelID: "1", ChannelName: "CCTV1"}
+
+	calls := 0
+	flaky := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		calls++
+		if calls < 2 {
+			return nil, errors.New("timeout")
+		}
+		return &iptv.ChannelProgramList{ChannelId: channel.ChannelID}, nil
+	}
+
+	budget := newRetryBudget(c.config.EPGRetryBudget)
+	progList, err := c.getChannelProgramListWithRetry(context.Background(), &Token{}, &channel, budget, nil, flaky)
+	if err != nil {
+		t.Fatalf("getChannelProgramListWithRetry() error = %v", err)
+	}
+	if progList == nil || progList.ChannelId != "1" {
+		t.Errorf("unexpected program list: %+v", progList)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+	if remaining := budget.remaining.Load(); remaining != 9 {
+		t.Errorf("remaining budget = %d, want 9", remaining)
+	}
+}
+
+func TestGetAllChannelProgramListChannelTimeout(t *testing.T) {
+	c := &Client{
+		config: &Config{EPGRetries: 3, EPGRetryBudget: 10, EPGChannelTimeout: 1},
+		logger: zap.NewNop(),
+	}
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "2", ChannelName: "CCTV2", TimeShift: "1", TimeShiftLength: time.Hour},
+	}
+
+	calls := make(map[string]int)
+	hanging := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		calls[channel.ChannelID]++
+		// 频道1的上游连接一直挂起，直到超时
+		if channel.ChannelID == "1" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &iptv.ChannelProgramList{
+			ChannelId:       channel.ChannelID,
+			DateProgramList: []iptv.DateProgram{{Date: time.Now()}},
+		}, nil
+	}
+
+	report := iptv.NewEPGErrorReport()
+	ctx := iptv.WithEPGErrorReport(context.Background(), report)
+	budget := newRetryBudget(c.config.EPGRetryBudget)
+	epg, err := c.getAllChannelProgramList(ctx, channels, &Token{}, budget, nil, hanging)
+	if err != nil {
+		t.Fatalf("getAllChannelProgramList() error = %v", err)
+	}
+
+	// 超时的频道被跳过且不再重试，其他频道正常获取
+	if len(epg) != 1 || epg[0].ChannelId != "2" {
+		t.Errorf("epg = %+v, want only channel 2", epg)
+	}
+	if calls["1"] != 1 {
+		t.Errorf("calls[1] = %d, want 1", calls["1"])
+	}
+
+	_, err = c.getChannelProgramListWithRetry(context.Background(), &Token{}, &channels[0], budget, nil, hanging)
+	if !errors.Is(err, ErrEPGChannelTimeout) {
+		t.Errorf("getChannelProgramListWithRetry() error = %v, want %v", err, ErrEPGChannelTimeout)
+	}
+}
+
+func TestEPGDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		delayMin int
+		delayMax int
+		wantMin  time.Duration
+		wantMax  time.Duration
+	}{
+		{name: "disabled", wantMin: 0, wantMax: 0},
+		{name: "range", delayMin: 100, delayMax: 300, wantMin: 100 * time.Millisecond, wantMax: 300 * time.Millisecond},
+		{name: "fixed", delayMin: 200, delayMax: 200, wantMin: 200 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "max_less_than_min", delayMin: 200, delayMax: 50, wantMin: 200 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "negative", delayMin: -100, delayMax: 50, wantMin: 0, wantMax: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{IP: "127.0.0.1", UserID: "user", STBType: "type", STBVersion: "version", STBID: "id", MAC: "mac",
+				EPGDelayMin: tt.delayMin, EPGDelayMax: tt.delayMax}
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			c := &Client{config: config}
+			for i := 0; i < 100; i++ {
+				if delay := c.epgDelay(); delay < tt.wantMin || delay > tt.wantMax {
+					t.Fatalf("epgDelay() = %v, want within [%v, %v]", delay, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestEPGIndexRetries(t *testing.T) {
+	zero, negative, five := 0, -1, 5
+	tests := []struct {
+		name    string
+		retries *int
+		want    int
+	}{
+		{name: "default", want: defaultEPGIndexRetries},
+		{name: "disabled", retries: &zero, want: 0},
+		{name: "negative", retries: &negative, want: 0},
+		{name: "custom", retries: &five, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{IP: "127.0.0.1", UserID: "user", STBType: "type", STBVersion: "version", STBID: "id", MAC: "mac",
+				OptionEPGIndexRetries: tt.retries}
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if config.EPGIndexRetries != tt.want {
+				t.Errorf("EPGIndexRetries = %d, want %d", config.EPGIndexRetries, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllChannelProgramListDelay(t *testing.T) {
+	var waits []time.Duration
+	defaultWait := waitRetryAfter
+	waitRetryAfter = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { waitRetryAfter = defaultWait })
+
+	c := &Client{
+		config: &Config{EPGDelayMin: 100, EPGDelayMax: 300},
+		logger: zap.NewNop(),
+	}
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "2", ChannelName: "CCTV2", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "3", ChannelName: "CCTV3", TimeShift: "0"},
+	}
+	getChProgFunc := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		return &iptv.ChannelProgramList{ChannelId: channel.ChannelID}, nil
+	}
+
+	if _, err := c.getAllChannelProgramList(context.Background(), channels, &Token{}, newRetryBudget(0), nil, getChProgFunc); err != nil {
+		t.Fatalf("getAllChannelProgramList() error = %v", err)
+	}
+	// 仅请求节目单的频道才会延迟
+	if len(waits) != 2 {
+		t.Fatalf("waits = %v, want 2 delays", waits)
+	}
+	for _, wait := range waits {
+		if wait < 100*time.Millisecond || wait > 300*time.Millisecond {
+			t.Errorf("delay = %v, want within [100ms, 300ms]", wait)
+		}
+	}
+}
+
+func TestGetAllChannelProgramListResume(t *testing.T) {
+	c := &Client{
+		config: &Config{},
+		logger: zap.NewNop(),
+	}
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "2", ChannelName: "CCTV2", TimeShift: "1", TimeShiftLength: time.Hour},
+		{ChannelID: "3", ChannelName: "CCTV3", TimeShift: "1", TimeShiftLength: time.Hour},
+	}
+	filePath := filepath.Join(t.TempDir(), "epg_resume.json")
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+
+	calls := make(map[string]int)
+	ctx, cancel := context.WithCancel(context.Background())
+	getChProgFunc := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		calls[channel.ChannelID]++
+		// 获取频道2的节目单后模拟进程中断
+		if channel.ChannelID == "2" {
+			cancel()
+		}
+		return &iptv.ChannelProgramList{
+			ChannelId:   channel.ChannelID,
+			ChannelName: channel.ChannelName,
+			DateProgramList: []iptv.DateProgram{
+				{Date: date, ProgramList: []iptv.Program{{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"}}},
+			},
+		}, nil
+	}
+
+	// 第一次刷新：频道3未完成
+	checkpoint, err := loadEPGCheckpointFile(filePath, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	epg, err := c.getAllChannelProgramList(ctx, channels, &Token{}, newRetryBudget(0), checkpoint, getChProgFunc)
+	if err != nil {
+		t.Fatalf("getAllChannelProgramList() error = %v", err)
+	}
+	if len(epg) != 2 {
+		t.Fatalf("len(epg) = %d, want 2", len(epg))
+	}
+
+	// 重启后再次刷新：只获取剩余的频道
+	checkpoint, err = loadEPGCheckpointFile(filePath, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	if checkpoint.len() != 2 {
+		t.Fatalf("checkpoint.len() = %d, want 2", checkpoint.len())
+	}
+	epg, err = c.getAllChannelProgramList(context.Background(), channels, &Token{}, newRetryBudget(0), checkpoint, getChProgFunc)
+	if err != nil {
+		t.Fatalf("getAllChannelProgramList() error = %v", err)
+	}
+	if len(epg) != 3 {
+		t.Fatalf("len(epg) = %d, want 3", len(epg))
+	}
+	if epg[0].ChannelName != "CCTV1" || len(epg[0].DateProgramList) != 1 || !epg[0].DateProgramList[0].Date.Equal(date) {
+		t.Errorf("unexpected resumed program list: %+v", epg[0])
+	}
+	want := map[string]int{"1": 1, "2": 1, "3": 1}
+	for id, n := range want {
+		if calls[id] != n {
+			t.Errorf("calls[%s] = %d, want %d", id, calls[id], n)
+		}
+	}
+
+	// 刷新完成后清除进度文件
+	if err = checkpoint.clear(); err != nil {
+		t.Fatalf("clear() error = %v", err)
+	}
+	if _, err = os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint file should be removed, stat error = %v", err)
+	}
+}
+
+func TestLoadEPGCheckpointFileExpired(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "epg_resume.json")
+	now := time.Now()
+
+	checkpoint, err := loadEPGCheckpointFile(filePath, time.Hour, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	if err = checkpoint.save("1", &iptv.ChannelProgramList{ChannelId: "1"}, now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	if err = checkpoint.save("2", &iptv.ChannelProgramList{ChannelId: "2"}, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	checkpoint, err = loadEPGCheckpointFile(filePath, time.Hour, now)
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	if _, ok := checkpoint.get("1"); ok {
+		t.Error("expired channel 1 should not be resumed")
+	}
+	if _, ok := checkpoint.get("2"); !ok {
+		t.Error("channel 2 should be resumed")
+	}
+}
+
+func TestEPGCheckpointAppendAndCompact(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "epg_resume.json")
+	now := time.Now()
+
+	checkpoint, err := loadEPGCheckpointFile(filePath, time.Hour, now)
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	for _, channelID := range []string{"1", "2", "1"} {
+		if err = checkpoint.save(channelID, &iptv.ChannelProgramList{ChannelId: channelID, ChannelName: "CCTV" + channelID}, now); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+	}
+
+	// 每次保存仅追加一行，不重写已保存的频道
+	countLines := func() int {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+	if lines := countLines(); lines != 3 {
+		t.Errorf("lines = %d, want 3", lines)
+	}
+
+	// 模拟进程中断时写入了不完整的一行
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	_, _ = file.WriteString(`{"channelID":"3","fetchedAt":`)
+	file.Close()
+
+	// 读取时跳过不完整的行，并压缩重复的记录
+	checkpoint, err = loadEPGCheckpointFile(filePath, time.Hour, now)
+	if err != nil {
+		t.Fatalf("loadEPGCheckpointFile() error = %v", err)
+	}
+	if checkpoint.len() != 2 {
+		t.Errorf("checkpoint.len() = %d, want 2", checkpoint.len())
+	}
+	if _, ok := checkpoint.get("3"); ok {
+		t.Error("the incomplete channel 3 should not be resumed")
+	}
+	if lines := countLines(); lines != 2 {
+		t.Errorf("lines after compaction = %d, want 2", lines)
+	}
+}
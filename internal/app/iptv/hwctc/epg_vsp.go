@@ -74,7 +74,7 @@ type vspResponse struct {
 // getVspChannelProgramList 获取指定频道的节目单列表（hb）
 func (c *Client) getVspChannelProgramList(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
 	// 获取未来一天的日期
-	tomorrow := time.Now().AddDate(0, 0, 1)
+	tomorrow := c.now().AddDate(0, 0, 1)
 	tomorrow = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, tomorrow.Location())
 
 	// 根据当前频道的时移范围，预估EPG的查询时间范围（加上未来一天）
@@ -152,6 +152,7 @@ func (c *Client) getVspChannelDateProgram(ctx context.Context, token *Token, cha
 
 	// 设置请求头
 	c.setCommonHeaders(req)
+	c.setReferer(req, c.getReferers().EPG, "")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
 
@@ -168,15 +169,20 @@ func (c *Client) getVspChannelDateProgram(ctx context.Context, token *Token, cha
 	}
 	defer resp.Body.Close()
 
+	// 被上游限流时，返回需要等待的时间
+	if err = checkRateLimited(resp); err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode >= http.StatusInternalServerError {
 		return nil, ErrEPGApiNotFound
 	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		return nil, c.statusCodeError(resp.StatusCode)
 	}
 
 	// 解析响应内容
 	var response vspResponse
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err = c.decodeJSONResponse(resp, &response); err != nil {
 		return nil, fmt.Errorf("parse response failed: %w", err)
 	} else if response.Result == nil || response.Result.RetCode != "000000000" || len(response.ChannelPlaybills) == 0 {
 		// 调用失败
@@ -1,14 +1,26 @@
 package hwctc
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"iptv/internal/app/iptv"
 	"net/http"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// refererHostPlaceholder 自定义Referer中代表服务器地址和端口的占位符
+const refererHostPlaceholder = "{host}"
+
+// ErrResponseTooLarge 上游的响应内容超过配置的最大大小
+var ErrResponseTooLarge = errors.New("response body too large")
+
 type Client struct {
 	httpClient       *http.Client             // HTTP客户端
 	config           *Config                  // hwctc相关配置
@@ -18,16 +30,24 @@ type Client struct {
 	chExcludeRule    *regexp.Regexp           // 频道的过滤规则
 	chGroupRulesList []iptv.ChannelGroupRules // 频道分组的规则
 	chLogoRuleList   []iptv.ChannelLogoRule   // 频道台标的匹配规则
+	progTitleRules   []iptv.ProgramTitleRule  // 节目名称的清理规则
 
 	host string // 缓存最新重定向的服务器地址和端口
 
+	tokenMu     sync.Mutex // 保护缓存的Token，获取频道列表及节目单可能并发执行
+	token       *Token     // 缓存的认证Token
+	tokenExpiry time.Time  // 缓存的Token的过期时间
+
+	nowFunc func() time.Time // 获取当前时间，缺省为time.Now，用于测试或模拟指定的日期
+
 	logger *zap.Logger // 日志
 }
 
 var _ iptv.Client = (*Client)(nil)
 
 func NewClient(httpClient *http.Client, config *Config, key, serverHost string, headers map[string]string,
-	chExcludeRule *regexp.Regexp, chGroupRulesList []iptv.ChannelGroupRules, chLogoRuleList []iptv.ChannelLogoRule) (iptv.Client, error) {
+	chExcludeRule *regexp.Regexp, chGroupRulesList []iptv.ChannelGroupRules, chLogoRuleList []iptv.ChannelLogoRule,
+	progTitleRules []iptv.ProgramTitleRule) (iptv.Client, error) {
 	// config不能为空
 	if config == nil {
 		return nil, fmt.Errorf("client config is nil")
@@ -51,7 +71,9 @@ func NewClient(httpClient *http.Client, config *Config, key, serverHost string,
 		chExcludeRule:    chExcludeRule,
 		chGroupRulesList: chGroupRulesList,
 		chLogoRuleList:   chLogoRuleList,
+		progTitleRules:   progTitleRules,
 		host:             serverHost,
+		nowFunc:          config.Now,
 		logger:           zap.L(),
 	}
 	if i.httpClient == nil {
@@ -69,3 +91,66 @@ func (c *Client) setCommonHeaders(req *http.Request) {
 		}
 	}
 }
+
+// setReferer 设置请求的Referer，优先使用自定义的Referer，否则使用缺省值
+func (c *Client) setReferer(req *http.Request, referer, defaultReferer string) {
+	if referer != "" {
+		referer = strings.ReplaceAll(referer, refererHostPlaceholder, c.host)
+	} else {
+		referer = defaultReferer
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+}
+
+// getReferers 获取自定义的Referer配置
+func (c *Client) getReferers() Referers {
+	if c.config.Referers == nil {
+		return Referers{}
+	}
+	return *c.config.Referers
+}
+
+// now 获取当前时间，用于计算节目单的查询日期
+func (c *Client) now() time.Time {
+	if c.nowFunc != nil {
+		return c.nowFunc()
+	}
+	return time.Now()
+}
+
+// statusCodeError 返回上游响应状态码异常的错误，401/403时清除缓存的Token，下次请求时重新认证
+func (c *Client) statusCodeError(statusCode int) error {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		c.InvalidateToken()
+	}
+	return fmt.Errorf("http status code: %d", statusCode)
+}
+
+// readResponseBody 读取响应内容，超过配置的最大大小时返回错误，避免异常的上游耗尽内存
+func (c *Client) readResponseBody(resp *http.Response) ([]byte, error) {
+	maxBodySize := c.config.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	limit := int64(maxBodySize) << 20
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d MB", ErrResponseTooLarge, maxBodySize)
+	}
+	return body, nil
+}
+
+// decodeJSONResponse 读取并解析JSON格式的响应内容
+func (c *Client) decodeJSONResponse(resp *http.Response, v any) error {
+	body, err := c.readResponseBody(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
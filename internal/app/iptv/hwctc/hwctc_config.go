@@ -2,19 +2,44 @@ package hwctc
 
 import (
 	"errors"
+	"time"
 )
 
 const (
 	providerSuffixCTC = "CTC"
 	providerSuffixCU  = "CU"
+
+	defaultEPGRetryBudget = 50
+	defaultMaxBodySize    = 32
+	defaultTokenTTL       = 10
+
+	defaultEPGChannelTimeout = 30
+	defaultEPGIndexRetries   = 2
 )
 
 type Config struct {
 	ProviderSuffix string `json:"providerSuffix" yaml:"providerSuffix"` // 配置IPTV的供应商后缀
 	InterfaceName  string `json:"interfaceName" yaml:"interfaceName"`   // 网络接口的名称。若配置则生成Authenticator时，优先使用该接口对应的IPv4地址，而不使用`ip`字段的值。
 	// 以下信息均可通过抓包获取
-	IP                string `json:"ip" yaml:"ip"`                                                   // 生成Authenticator所需的IP地址。可随便一个地址，或者通过配置`interfaceName`动态获取
-	ChannelProgramAPI string `json:"channelProgramAPI,omitempty" yaml:"channelProgramAPI,omitempty"` // 请求频道节目信息（EPG）的API接口，目前只支持两种：liveplay_30或者gdhdpublic。
+	IP                    string    `json:"ip" yaml:"ip"`                                                   // 生成Authenticator所需的IP地址。可随便一个地址，或者通过配置`interfaceName`动态获取
+	ChannelProgramAPI     string    `json:"channelProgramAPI,omitempty" yaml:"channelProgramAPI,omitempty"` // 请求频道节目信息（EPG）的API接口，目前只支持两种：liveplay_30或者gdhdpublic。
+	EPGRetries            int       `json:"epgRetries,omitempty" yaml:"epgRetries,omitempty"`               // 获取单个频道节目单失败时的重试次数，缺省为0不重试
+	EPGRetryBudget        int       `json:"epgRetryBudget,omitempty" yaml:"epgRetryBudget,omitempty"`       // 单次刷新节目单时，所有频道共享的最大重试总次数
+	OptionEPGIndexRetries *int      `json:"epgIndexRetries,omitempty" yaml:"epgIndexRetries,omitempty"`     // 按日期请求节目单遇到网络错误或5xx时的重试次数，缺省为2，配置为0时不重试（目前仅对defaulttrans2接口生效）
+	EPGIndexRetries       int       `json:"-" yaml:"-"`                                                     // Validate()时进行填充
+	EPGDelayMin           int       `json:"epgDelayMin,omitempty" yaml:"epgDelayMin,omitempty"`             // 请求单个频道节目单前的最小随机延迟，单位为毫秒，缺省为0
+	EPGDelayMax           int       `json:"epgDelayMax,omitempty" yaml:"epgDelayMax,omitempty"`             // 请求单个频道节目单前的最大随机延迟，单位为毫秒，缺省为0不延迟
+	EPGChannelTimeout     int       `json:"epgChannelTimeout,omitempty" yaml:"epgChannelTimeout,omitempty"` // 获取单个频道节目单（含重试）的超时时间，单位为秒，缺省为30，小于0时不限制
+	EPGResumeFile         string    `json:"epgResumeFile,omitempty" yaml:"epgResumeFile,omitempty"`         // 节目单刷新进度的保存文件，配置后刷新中断时可从中断处继续，缺省不开启
+	EPGResumeMaxAge       int       `json:"epgResumeMaxAge,omitempty" yaml:"epgResumeMaxAge,omitempty"`     // 刷新进度的有效期，单位为分钟，缺省为60
+	StrictMulticast       bool      `json:"strictMulticast,omitempty" yaml:"strictMulticast,omitempty"`     // 频道的组播地址不合法时，是否直接返回错误。缺省为false，跳过该地址
+	ProgSnapSeconds       int       `json:"progSnapSeconds,omitempty" yaml:"progSnapSeconds,omitempty"`     // 相邻节目的间隔或重叠不超过该秒数时，将结束时间对齐到下一个节目的开始时间，缺省为0不处理
+	MaxBodySize           int       `json:"maxBodySize,omitempty" yaml:"maxBodySize,omitempty"`             // 上游单个响应内容的最大大小，单位为MB，缺省为32
+	Referers              *Referers `json:"referers,omitempty" yaml:"referers,omitempty"`                   // 自定义各类请求的Referer，未配置时使用缺省值
+	TokenTTL              int       `json:"tokenTTL,omitempty" yaml:"tokenTTL,omitempty"`                   // 认证Token的缓存有效期，单位为分钟，缺省为10，小于0时不缓存
+
+	Now          func() time.Time `json:"-" yaml:"-"` // 获取当前时间的函数，仅用于调试时模拟指定的日期，缺省为time.Now
+	TimeLocation *time.Location   `json:"-" yaml:"-"` // 节目时间所在的时区，由上层配置填充，为空时使用iptv.DefaultXmltvLocation
 	// 以下信息均可通过抓包请求ValidAuthenticationHWCTC.jsp的参数拿到
 	UserID           string `json:"userID" yaml:"userID"`
 	Lang             string `json:"lang,omitempty" yaml:"lang,omitempty"`           // 如果没有可以不填
@@ -34,6 +59,13 @@ type Config struct {
 	Vip              string `json:"vip,omitempty" yaml:"vip,omitempty"`
 }
 
+// Referers 各类请求的Referer，支持使用{host}占位符代替当前的服务器地址和端口
+type Referers struct {
+	Token   string `json:"token,omitempty" yaml:"token,omitempty"`     // 获取Token（ValidAuthenticationHWCTC.jsp）的Referer
+	Channel string `json:"channel,omitempty" yaml:"channel,omitempty"` // 获取频道列表的Referer
+	EPG     string `json:"epg,omitempty" yaml:"epg,omitempty"`         // 获取节目单的Referer
+}
+
 func (c *Config) Validate() error {
 	// 校验config配置
 	if (c.IP == "" && c.InterfaceName == "") ||
@@ -50,5 +82,50 @@ func (c *Config) Validate() error {
 		c.ProviderSuffix = providerSuffixCTC
 	}
 
+	// 设置节目单的重试次数及重试预算
+	if c.EPGRetries < 0 {
+		c.EPGRetries = 0
+	}
+	if c.EPGRetryBudget <= 0 {
+		c.EPGRetryBudget = defaultEPGRetryBudget
+	}
+	c.EPGIndexRetries = defaultEPGIndexRetries
+	if c.OptionEPGIndexRetries != nil {
+		c.EPGIndexRetries = max(*c.OptionEPGIndexRetries, 0)
+	}
+
+	// 设置节目单请求的随机延迟范围
+	if c.EPGDelayMin < 0 {
+		c.EPGDelayMin = 0
+	}
+	if c.EPGDelayMax < c.EPGDelayMin {
+		c.EPGDelayMax = c.EPGDelayMin
+	}
+
+	// 设置获取单个频道节目单的超时时间
+	if c.EPGChannelTimeout == 0 {
+		c.EPGChannelTimeout = defaultEPGChannelTimeout
+	}
+
+	// 设置节目单刷新进度的有效期
+	if c.EPGResumeMaxAge <= 0 {
+		c.EPGResumeMaxAge = defaultEPGResumeMaxAge
+	}
+
+	// 设置响应内容的最大大小
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaultMaxBodySize
+	}
+
+	// 设置认证Token的缓存有效期
+	if c.TokenTTL == 0 {
+		c.TokenTTL = defaultTokenTTL
+	}
+
+	// 设置节目时间的对齐范围
+	if c.ProgSnapSeconds < 0 {
+		c.ProgSnapSeconds = 0
+	}
+
 	return nil
 }
@@ -0,0 +1,196 @@
+package hwctc
+
+import (
+	"context"
+	"errors"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSetReferer(t *testing.T) {
+	tests := []struct {
+		name           string
+		referer        string
+		defaultReferer string
+		want           string
+	}{
+		{name: "default", defaultReferer: "http://1.2.3.4:8080/EPG/jsp/authLoginHWCTC.jsp", want: "http://1.2.3.4:8080/EPG/jsp/authLoginHWCTC.jsp"},
+		{name: "custom", referer: "http://example.com/index.html", defaultReferer: "http://1.2.3.4:8080/a.jsp", want: "http://example.com/index.html"},
+		{name: "placeholder", referer: "http://{host}/EPG/jsp/custom.jsp", want: "http://1.2.3.4:8080/EPG/jsp/custom.jsp"},
+		{name: "none", want: ""},
+	}
+
+	c := &Client{host: "1.2.3.4:8080"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://1.2.3.4:8080/", nil)
+			c.setReferer(req, tt.referer, tt.defaultReferer)
+			if got := req.Header.Get("Referer"); got != tt.want {
+				t.Errorf("Referer = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefererPerPath(t *testing.T) {
+	referers := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		referers[r.URL.Path] = r.Header.Get("Referer")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name     string
+		referers *Referers
+		want     map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{
+				"/EPG/jsp/ValidAuthenticationHWCTC.jsp":                        "http://" + host + "/EPG/jsp/authLoginHWCTC.jsp",
+				"/EPG/jsp/defaulttrans2/en/datajsp/getTvodProgListByIndex.jsp": "http://" + host + "/EPG/jsp/defaulttrans2/en/chanMiniList.html",
+				"/EPG/jsp/liveplay_30/en/getTvodData.jsp":                      "",
+			},
+		},
+		{
+			name: "custom",
+			referers: &Referers{
+				Token: "http://{host}/token.html",
+				EPG:   "http://epg.example.com/epg.html",
+			},
+			want: map[string]string{
+				"/EPG/jsp/ValidAuthenticationHWCTC.jsp":                        "http://" + host + "/token.html",
+				"/EPG/jsp/defaulttrans2/en/datajsp/getTvodProgListByIndex.jsp": "http://epg.example.com/epg.html",
+				"/EPG/jsp/liveplay_30/en/getTvodData.jsp":                      "http://epg.example.com/epg.html",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clear(referers)
+			c := &Client{
+				httpClient: server.Client(),
+				config:     &Config{ProviderSuffix: providerSuffixCTC, IP: "127.0.0.1", Referers: tt.referers},
+				key:        "12345678",
+				host:       host,
+				logger:     zap.NewNop(),
+			}
+			ctx := context.Background()
+			token := &Token{JSESSIONID: "session"}
+			channel := &iptv.Channel{ChannelID: "1", ChannelName: "CCTV1"}
+
+			// 只关注请求的Referer，忽略响应解析的错误
+			_, _ = c.validAuthenticationHWCTC(ctx, "")
+			_, _, _ = c.getDefaulttrans2ChannelDateProgram(ctx, token, channel, time.Now(), 0)
+			_, _ = c.getLiveplayChannelProgramList(ctx, token, channel)
+
+			for path, want := range tt.want {
+				got, ok := referers[path]
+				if !ok {
+					t.Errorf("no request to %s", path)
+					continue
+				}
+				if got != want {
+					t.Errorf("Referer of %s = %q, want %q", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadResponseBodyTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 1<<20+1)))
+	}))
+	defer server.Close()
+
+	c := &Client{
+		httpClient: server.Client(),
+		config:     &Config{MaxBodySize: 1},
+		logger:     zap.NewNop(),
+	}
+	resp, err := c.httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err = c.readResponseBody(resp); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("readResponseBody() error = %v, want %v", err, ErrResponseTooLarge)
+	}
+}
+
+func TestGetTokenCache(t *testing.T) {
+	var validCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/EPG/jsp/authLoginHWCTC.jsp":
+			_, _ = w.Write([]byte(`var EncryptToken = "encrypt";`))
+		case "/EPG/jsp/ValidAuthenticationHWCTC.jsp":
+			validCalls++
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "session"})
+			_, _ = w.Write([]byte(`"UserToken" value="token` + strconv.Itoa(validCalls) + `" "stbid" value="stb"`))
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	newClient := func(tokenTTL int) *Client {
+		return &Client{
+			httpClient: server.Client(),
+			config:     &Config{ProviderSuffix: providerSuffixCTC, IP: "127.0.0.1", TokenTTL: tokenTTL},
+			key:        "12345678",
+			originHost: host,
+			host:       host,
+			logger:     zap.NewNop(),
+		}
+	}
+	getUserToken := func(c *Client) string {
+		t.Helper()
+		token, err := c.getToken(context.Background())
+		if err != nil {
+			t.Fatalf("getToken() error = %v", err)
+		}
+		return token.UserToken
+	}
+
+	c := newClient(defaultTokenTTL)
+	if got := getUserToken(c); got != "token1" {
+		t.Errorf("getToken() = %q, want token1", got)
+	}
+	// 有效期内使用缓存的Token
+	if got := getUserToken(c); got != "token1" || validCalls != 1 {
+		t.Errorf("getToken() = %q with %d authentications, want cached token1", got, validCalls)
+	}
+
+	// 上游返回403时清除缓存的Token
+	if err := c.statusCodeError(http.StatusForbidden); err == nil {
+		t.Error("statusCodeError() = nil, want error")
+	}
+	if got := getUserToken(c); got != "token2" {
+		t.Errorf("getToken() = %q, want token2 after invalidation", got)
+	}
+
+	// 缓存过期后重新认证
+	c.tokenExpiry = time.Now().Add(-time.Second)
+	if got := getUserToken(c); got != "token3" {
+		t.Errorf("getToken() = %q, want token3 after expiry", got)
+	}
+
+	// 有效期小于0时不缓存
+	c = newClient(-1)
+	getUserToken(c)
+	if got := getUserToken(c); got != "token5" {
+		t.Errorf("getToken() = %q, want token5 without cache", got)
+	}
+}
@@ -0,0 +1,56 @@
+package hwctc
+
+import (
+	"context"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryAfter = 30 * time.Second // 上游未返回Retry-After时的等待时间
+	maxRetryAfter     = 5 * time.Minute  // 遵循Retry-After等待的最长时间
+)
+
+// waitRetryAfter 等待指定的时间，测试时可替换
+var waitRetryAfter = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// checkRateLimited 检查响应是否被上游限流，若是则返回包含等待时间的错误
+func checkRateLimited(resp *http.Response) error {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	return &iptv.RateLimitError{
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter 解析Retry-After响应头，支持秒数和HTTP日期两种格式，并限制最长的等待时间
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		retryAfter = date.Sub(now)
+	} else {
+		return defaultRetryAfter
+	}
+
+	return min(max(retryAfter, 0), maxRetryAfter)
+}
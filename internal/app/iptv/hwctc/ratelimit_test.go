@@ -0,0 +1,114 @@
+package hwctc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 22, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "http_date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{name: "past_date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "capped", value: "86400", want: maxRetryAfter},
+		{name: "missing", value: "", want: defaultRetryAfter},
+		{name: "invalid", value: "soon", want: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChannelProgramListWithRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	defaultWait := waitRetryAfter
+	waitRetryAfter = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { waitRetryAfter = defaultWait })
+
+	c := &Client{
+		httpClient: server.Client(),
+		config:     &Config{EPGRetries: 2, EPGRetryBudget: 10},
+		logger:     zap.NewNop(),
+	}
+	getChProgFunc := func(ctx context.Context, token *Token, channel *iptv.Channel) (*iptv.ChannelProgramList, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if err = checkRateLimited(resp); err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("http status code: %d", resp.StatusCode)
+		}
+		return &iptv.ChannelProgramList{ChannelId: channel.ChannelID}, nil
+	}
+
+	channel := iptv.Channel{ChannelID: "1", ChannelName: "CCTV1"}
+	progList, err := c.getChannelProgramListWithRetry(context.Background(), &Token{}, &channel,
+		newRetryBudget(c.config.EPGRetryBudget), nil, getChProgFunc)
+	if err != nil {
+		t.Fatalf("getChannelProgramListWithRetry() error = %v", err)
+	}
+	if progList == nil || progList.ChannelId != "1" {
+		t.Errorf("unexpected program list: %+v", progList)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+	if len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("waits = %v, want [7s]", waits)
+	}
+}
+
+func TestCheckRateLimited(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"3"}}}
+	var rateLimitErr *iptv.RateLimitError
+	if err := checkRateLimited(resp); !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != 3*time.Second {
+		t.Errorf("checkRateLimited() = %v, want retry after 3s", err)
+	}
+
+	resp = &http.Response{StatusCode: http.StatusOK}
+	if err := checkRateLimited(resp); err != nil {
+		t.Errorf("checkRateLimited() = %v, want nil", err)
+	}
+}
@@ -2,6 +2,9 @@ package iptv
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"time"
 )
 
 type Client interface {
@@ -11,3 +14,12 @@ type Client interface {
 	// GetAllChannelProgramList 获取所有频道的节目单列表
 	GetAllChannelProgramList(ctx context.Context, channels []Channel) ([]ChannelProgramList, error)
 }
+
+// RateLimitError 上游服务器返回429（请求过多）时的错误
+type RateLimitError struct {
+	RetryAfter time.Duration // 上游要求等待的时间
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("http status code: %d, retry after %s", http.StatusTooManyRequests, e.RetryAfter)
+}
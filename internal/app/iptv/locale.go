@@ -0,0 +1,28 @@
+package iptv
+
+// ChannelLocale 频道的国家和语言信息
+type ChannelLocale struct {
+	Country  string `json:"country,omitempty"`  // 国家代码，例如：CN
+	Language string `json:"language,omitempty"` // 语言代码，例如：zh
+}
+
+// SetChannelLocale 设置频道的国家和语言信息，频道分组的配置优先于全局配置
+func SetChannelLocale(channels []Channel, defaultLocale ChannelLocale, groupLocaleMap map[string]ChannelLocale) {
+	for i := range channels {
+		locale := defaultLocale
+		if groupLocale, ok := groupLocaleMap[channels[i].GroupName]; ok {
+			if groupLocale.Country != "" {
+				locale.Country = groupLocale.Country
+			}
+			if groupLocale.Language != "" {
+				locale.Language = groupLocale.Language
+			}
+		}
+
+		if locale.Country == "" && locale.Language == "" {
+			channels[i].Locale = nil
+			continue
+		}
+		channels[i].Locale = &locale
+	}
+}
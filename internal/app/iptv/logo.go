@@ -1,13 +1,28 @@
 package iptv
 
 import (
+	"iptv/internal/pkg/util"
+	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// logoDirName 缺省的台标目录，位于程序所在目录下
 const logoDirName = "logos"
 
+// logoFileExt 台标文件的扩展名
+const logoFileExt = ".png"
+
+const (
+	LogoFieldLogoName    = "logoName"    // 按台标规则识别的台标名称
+	LogoFieldChannelID   = "channelID"   // 频道ID
+	LogoFieldChannelName = "channelName" // 频道名称
+)
+
 type ChannelLogoRule struct {
 	Name string
 	Rule *regexp.Regexp
@@ -23,6 +38,9 @@ func (l *ChannelLogoRule) ResolveName(matches []string) string {
 	return s
 }
 
+// logoUnsafeChars 台标名称中会导致URL异常的字符
+const logoUnsafeChars = `"#%&'/<>?\\`
+
 // GetChannelLogoName 根据频道名称识别频道台标logo
 func GetChannelLogoName(chLogoRuleList []ChannelLogoRule, channelName string) string {
 	for _, chLogoRule := range chLogoRuleList {
@@ -33,3 +51,125 @@ func GetChannelLogoName(chLogoRuleList []ChannelLogoRule, channelName string) st
 	}
 	return channelName
 }
+
+// SanitizeLogoName 将台标名称转换为URL安全的形式，空白字符及特殊字符均替换为下划线
+func SanitizeLogoName(logoName string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(logoUnsafeChars, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(logoName))
+}
+
+// SanitizeChannelLogoNames 将所有频道的台标名称转换为URL安全的形式
+func SanitizeChannelLogoNames(channels []Channel) {
+	for i := range channels {
+		channels[i].LogoName = SanitizeLogoName(channels[i].LogoName)
+	}
+}
+
+// IsAbsoluteLogoBaseURL 判断台标的Base URL是否为完整的http(s)地址
+func IsAbsoluteLogoBaseURL(logoBaseUrl string) bool {
+	return isAbsoluteHTTPURL(logoBaseUrl)
+}
+
+// getChannelLogoURL 获取频道台标的URL地址
+func getChannelLogoURL(logoBaseUrl, logoName string) (string, error) {
+	return url.JoinPath(logoBaseUrl, logoName+logoFileExt)
+}
+
+// getExistingChannelLogoURL 获取台标的访问地址，台标文件不存在或无法生成URL时返回空字符串
+// logoPlaceholder为true时，台标文件不存在也返回访问地址，由服务端生成占位台标
+func getExistingChannelLogoURL(logoName, logoBaseUrl, logoDir string, logoPlaceholder bool) string {
+	if logoBaseUrl == "" || logoName == "" {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(logoDir, logoName+logoFileExt)); os.IsNotExist(err) && !logoPlaceholder {
+		return ""
+	}
+	logoUrl, err := getChannelLogoURL(logoBaseUrl, logoName)
+	if err != nil {
+		return ""
+	}
+	return logoUrl
+}
+
+// CheckChannelLogos 检查频道的台标名称能否生成正常的URL地址，返回有问题的频道名称与台标名称的映射
+func CheckChannelLogos(channels []Channel, logoBaseUrl string) map[string]string {
+	invalidLogos := make(map[string]string)
+	for _, channel := range channels {
+		if channel.LogoName == "" {
+			continue
+		}
+		if _, err := getChannelLogoURL(logoBaseUrl, channel.LogoName); err != nil ||
+			SanitizeLogoName(channel.LogoName) != channel.LogoName {
+			invalidLogos[channel.ChannelName] = channel.LogoName
+		}
+	}
+	return invalidLogos
+}
+
+// ResolveLogoDir 获取台标目录的绝对路径
+// logoDir为空时使用程序所在目录下的logos目录，为相对路径时相对于程序所在目录
+func ResolveLogoDir(logoDir string) (string, error) {
+	if logoDir == "" {
+		logoDir = logoDirName
+	}
+	if filepath.IsAbs(logoDir) {
+		return filepath.Clean(logoDir), nil
+	}
+
+	currDir, err := util.GetCurrentAbPathByExecutable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(currDir, logoDir), nil
+}
+
+// SetChannelLogoByFields 按字段的顺序在台标目录中查找台标文件，使用第一个存在的作为频道的台标名称
+// 均不存在时，保持原有的台标名称不变
+func SetChannelLogoByFields(channels []Channel, logoDir string, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	for i := range channels {
+		for _, field := range fields {
+			logoName := getChannelLogoCandidate(&channels[i], field)
+			if logoName == "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(logoDir, logoName+logoFileExt)); err == nil {
+				channels[i].LogoName = logoName
+				break
+			}
+		}
+	}
+}
+
+// getChannelLogoCandidate 获取频道指定字段的值，作为候选的台标名称
+func getChannelLogoCandidate(channel *Channel, field string) string {
+	switch field {
+	case LogoFieldLogoName:
+		return channel.LogoName
+	case LogoFieldChannelID:
+		return channel.ChannelID
+	case LogoFieldChannelName:
+		return channel.ChannelName
+	default:
+		return ""
+	}
+}
+
+// SetProgramListLogoName 将频道的台标名称同步到节目单，保证m3u与xmltv中的台标一致
+func SetProgramListLogoName(chProgLists []ChannelProgramList, channels []Channel) {
+	logoNameMap := make(map[string]string, len(channels))
+	for _, channel := range channels {
+		logoNameMap[channel.ChannelID] = channel.LogoName
+	}
+
+	for i := range chProgLists {
+		chProgLists[i].LogoName = logoNameMap[chProgLists[i].ChannelId]
+	}
+}
@@ -0,0 +1,155 @@
+package iptv
+
+import (
+	"bytes"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"unicode"
+)
+
+const (
+	logoPlaceholderWidth    = 160 // 占位台标的宽度
+	logoPlaceholderHeight   = 90  // 占位台标的高度
+	logoPlaceholderPadding  = 10  // 文字与边缘的最小间距
+	logoPlaceholderMaxChars = 8   // 最多绘制的字符数量
+	glyphWidth              = 5   // 点阵字形的宽度
+	glyphHeight             = 7   // 点阵字形的高度
+)
+
+// logoPlaceholderGlyphs 绘制占位台标文字使用的5x7点阵字形，仅包含数字及大写字母
+var logoPlaceholderGlyphs = map[rune][glyphHeight]string{
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'+': {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+}
+
+// GenerateLogoPlaceholder 生成频道的占位台标PNG图片，背景颜色由频道名称决定，保证多次生成时保持一致
+// 内置的点阵字形仅支持数字及英文字母，频道名称中的其他字符（如中文）不会绘制
+// 频道名称中没有可绘制的字符时（如纯中文名称），依次使用频道号、频道ID作为台标文字
+func GenerateLogoPlaceholder(channel *Channel) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, logoPlaceholderWidth, logoPlaceholderHeight))
+	bg := getLogoPlaceholderColor(channel.ChannelName)
+	for y := 0; y < logoPlaceholderHeight; y++ {
+		for x := 0; x < logoPlaceholderWidth; x++ {
+			img.SetRGBA(x, y, bg)
+		}
+	}
+
+	var text []rune
+	for _, candidate := range []string{channel.ChannelName, channel.UserChannelID, channel.ChannelID} {
+		if text = getLogoPlaceholderText(candidate); len(text) > 0 {
+			break
+		}
+	}
+	drawLogoPlaceholderText(img, text)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// getLogoPlaceholderColor 根据频道名称的哈希值获取背景颜色，颜色偏暗以保证白色文字清晰可见
+func getLogoPlaceholderColor(channelName string) color.RGBA {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(channelName))
+	sum := h.Sum32()
+	return color.RGBA{
+		R: uint8(40 + sum&0x7f),
+		G: uint8(40 + (sum>>8)&0x7f),
+		B: uint8(40 + (sum>>16)&0x7f),
+		A: 0xff,
+	}
+}
+
+// getLogoPlaceholderText 获取文字中可以绘制的字符，小写字母转换为大写
+func getLogoPlaceholderText(s string) []rune {
+	text := make([]rune, 0, logoPlaceholderMaxChars)
+	for _, r := range strings.ToUpper(s) {
+		if r > unicode.MaxASCII {
+			continue
+		}
+		if _, ok := logoPlaceholderGlyphs[r]; ok {
+			text = append(text, r)
+			if len(text) == logoPlaceholderMaxChars {
+				break
+			}
+		}
+	}
+	return text
+}
+
+// drawLogoPlaceholderText 将文字按最大的整数倍缩放后居中绘制
+func drawLogoPlaceholderText(img *image.RGBA, text []rune) {
+	if len(text) == 0 {
+		return
+	}
+
+	// 字符之间间隔一列
+	cols := len(text)*(glyphWidth+1) - 1
+	scale := min((logoPlaceholderWidth-2*logoPlaceholderPadding)/cols,
+		(logoPlaceholderHeight-2*logoPlaceholderPadding)/glyphHeight)
+	if scale < 1 {
+		return
+	}
+
+	left := (logoPlaceholderWidth - cols*scale) / 2
+	top := (logoPlaceholderHeight - glyphHeight*scale) / 2
+	fg := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	for i, r := range text {
+		glyph := logoPlaceholderGlyphs[r]
+		for row, line := range glyph {
+			for col, dot := range line {
+				if dot != '#' {
+					continue
+				}
+				x0 := left + (i*(glyphWidth+1)+col)*scale
+				y0 := top + row*scale
+				for y := y0; y < y0+scale; y++ {
+					for x := x0; x < x0+scale; x++ {
+						img.SetRGBA(x, y, fg)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package iptv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeLogoName(t *testing.T) {
+	tests := []struct {
+		name     string
+		logoName string
+		want     string
+	}{
+		{name: "unchanged", logoName: "CCTV1", want: "CCTV1"},
+		{name: "chinese", logoName: "湖南卫视", want: "湖南卫视"},
+		{name: "spaces", logoName: " CCTV 5+ ", want: "CCTV_5+"},
+		{name: "special_chars", logoName: `A/B?C#D%E"F`, want: "A_B_C_D_E_F"},
+		{name: "tab", logoName: "CCTV\t1", want: "CCTV_1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeLogoName(tt.logoName); got != tt.want {
+				t.Errorf("SanitizeLogoName(%q) = %q, want %q", tt.logoName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckChannelLogos(t *testing.T) {
+	channels := []Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", LogoName: "CCTV1"},
+		{ChannelID: "2", ChannelName: "CCTV 5+", LogoName: "CCTV 5+"},
+		{ChannelID: "3", ChannelName: "凤凰卫视", LogoName: "凤凰卫视?HD"},
+		{ChannelID: "4", ChannelName: "无台标"},
+	}
+
+	want := map[string]string{
+		"CCTV 5+": "CCTV 5+",
+		"凤凰卫视":    "凤凰卫视?HD",
+	}
+	if got := CheckChannelLogos(channels, "/logo"); !maps.Equal(got, want) {
+		t.Errorf("CheckChannelLogos() = %v, want %v", got, want)
+	}
+
+	// 转换后不再有问题
+	SanitizeChannelLogoNames(channels)
+	if channels[1].LogoName != "CCTV_5+" || channels[2].LogoName != "凤凰卫视_HD" {
+		t.Errorf("sanitized logo names = %q, %q", channels[1].LogoName, channels[2].LogoName)
+	}
+	if got := CheckChannelLogos(channels, "/logo"); len(got) != 0 {
+		t.Errorf("CheckChannelLogos() after sanitizing = %v, want empty", got)
+	}
+
+	// 台标的Base URL不合法时，所有台标均无法生成URL
+	if got := CheckChannelLogos(channels, "http://[::1"); len(got) != 3 {
+		t.Errorf("CheckChannelLogos() with invalid base url = %v, want 3 channels", got)
+	}
+}
+
+func TestToM3UFormatLogoDir(t *testing.T) {
+	logoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logoDir, "CCTV1.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ResolveLogoDir(logoDir); err != nil || got != logoDir {
+		t.Fatalf("ResolveLogoDir() = %q, %v, want %q", got, err, logoDir)
+	}
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.2:5000"),
+	}
+	channels[0].LogoName = "CCTV1"
+	channels[1].LogoName = "CCTV2"
+
+	m3u, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{LogoBaseURL: "http://iptv.example.com/logo", ExtInfDuration: -1, Target: M3UTargetDefault, LogoDir: logoDir})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if !strings.Contains(m3u, `tvg-logo="http://iptv.example.com/logo/CCTV1.png"`) {
+		t.Errorf("ToM3UFormat() = %s, want logo of CCTV1", m3u)
+	}
+	// 台标目录中不存在的台标不输出
+	if strings.Contains(m3u, "CCTV2.png") {
+		t.Errorf("ToM3UFormat() = %s, want no logo of CCTV2", m3u)
+	}
+
+	// 开启占位台标时，台标文件不存在也输出
+	m3u, _, err = ToM3UFormat(channels, "", "", false, M3UOptions{LogoBaseURL: "http://iptv.example.com/logo", ExtInfDuration: -1, Target: M3UTargetDefault, LogoDir: logoDir, LogoPlaceholder: true})
+	if err != nil {
+		t.Fatalf("ToM3UFormat() error = %v", err)
+	}
+	if !strings.Contains(m3u, `tvg-logo="http://iptv.example.com/logo/CCTV2.png"`) {
+		t.Errorf("ToM3UFormat() = %s, want placeholder logo of CCTV2", m3u)
+	}
+}
+
+func TestGenerateLogoPlaceholder(t *testing.T) {
+	channel := &Channel{ChannelName: "CCTV-1 综合"}
+	content, err := GenerateLogoPlaceholder(channel)
+	if err != nil {
+		t.Fatalf("GenerateLogoPlaceholder() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != logoPlaceholderWidth || size.Y != logoPlaceholderHeight {
+		t.Errorf("size = %v, want %dx%d", size, logoPlaceholderWidth, logoPlaceholderHeight)
+	}
+	// 角落为背景色，中心区域绘制了白色文字
+	if got, want := color.RGBAModel.Convert(img.At(0, 0)), getLogoPlaceholderColor("CCTV-1 综合"); got != want {
+		t.Errorf("background = %v, want %v", got, want)
+	}
+	if !hasLogoPlaceholderText(img) {
+		t.Error("placeholder text not drawn")
+	}
+
+	// 相同的频道名称生成相同的内容
+	again, err := GenerateLogoPlaceholder(channel)
+	if err != nil || !bytes.Equal(content, again) {
+		t.Errorf("GenerateLogoPlaceholder() is not deterministic, err = %v", err)
+	}
+
+	if got := string(getLogoPlaceholderText("cctv-1 综合")); got != "CCTV-1" {
+		t.Errorf("getLogoPlaceholderText() = %q, want %q", got, "CCTV-1")
+	}
+	if got := getLogoPlaceholderText("湖南卫视"); len(got) != 0 {
+		t.Errorf("getLogoPlaceholderText() = %q, want empty", string(got))
+	}
+}
+
+func TestGenerateLogoPlaceholderFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  *Channel
+		wantText bool
+	}{
+		{name: "user_channel_id", channel: &Channel{ChannelName: "湖南卫视", UserChannelID: "12", ChannelID: "ch00000000000000001"}, wantText: true},
+		{name: "channel_id", channel: &Channel{ChannelName: "湖南卫视", ChannelID: "ch00000000000000001"}, wantText: true},
+		{name: "nothing_drawable", channel: &Channel{ChannelName: "湖南卫视"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := GenerateLogoPlaceholder(tt.channel)
+			if err != nil {
+				t.Fatalf("GenerateLogoPlaceholder() error = %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("png.Decode() error = %v", err)
+			}
+			if got := hasLogoPlaceholderText(img); got != tt.wantText {
+				t.Errorf("placeholder text drawn = %v, want %v", got, tt.wantText)
+			}
+		})
+	}
+}
+
+// hasLogoPlaceholderText 占位台标的中间一行是否绘制了白色文字
+func hasLogoPlaceholderText(img image.Image) bool {
+	for x := 0; x < logoPlaceholderWidth; x++ {
+		if color.RGBAModel.Convert(img.At(x, logoPlaceholderHeight/2)) == (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetChannelLogoByFields(t *testing.T) {
+	logoDir := t.TempDir()
+	for _, name := range []string{"CCTV1", "2", "CCTV3", "4"} {
+		if err := os.WriteFile(filepath.Join(logoDir, name+".png"), []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newChannels := func() []Channel {
+		channels := []Channel{
+			newTestChannel(t, "1", "CCTV-1", "igmp://239.1.1.1:5000"),
+			newTestChannel(t, "2", "CCTV-2", "igmp://239.1.1.2:5000"),
+			newTestChannel(t, "3", "CCTV3", "igmp://239.1.1.3:5000"),
+			newTestChannel(t, "5", "CCTV5", "igmp://239.1.1.5:5000"),
+		}
+		channels[0].LogoName = "CCTV1"
+		channels[1].LogoName = "CCTV2"
+		channels[2].LogoName = "CCTV3高清"
+		channels[3].LogoName = "CCTV5"
+		return channels
+	}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   []string
+	}{
+		{
+			name: "unconfigured",
+			want: []string{"CCTV1", "CCTV2", "CCTV3高清", "CCTV5"},
+		},
+		{
+			name:   "fallback",
+			fields: []string{LogoFieldLogoName, LogoFieldChannelID, LogoFieldChannelName},
+			want:   []string{"CCTV1", "2", "CCTV3", "CCTV5"},
+		},
+		{
+			name:   "channel id first",
+			fields: []string{LogoFieldChannelID, LogoFieldLogoName},
+			want:   []string{"CCTV1", "2", "CCTV3高清", "CCTV5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := newChannels()
+			SetChannelLogoByFields(channels, logoDir, tt.fields)
+			for i, channel := range channels {
+				if channel.LogoName != tt.want[i] {
+					t.Errorf("channels[%d].LogoName = %q, want %q", i, channel.LogoName, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package iptv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultPrecheckTimeout 连通性检查的缺省超时时间
+const DefaultPrecheckTimeout = 5 * time.Second
+
+// ErrPortalUnreachable IPTV服务器无法连接
+var ErrPortalUnreachable = errors.New("portal unreachable")
+
+// CheckPortalReachable 通过TCP连接检查IPTV服务器是否可达，未指定端口时使用80端口
+func CheckPortalReachable(ctx context.Context, host string, timeout time.Duration) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrPortalUnreachable, host, err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,48 @@
+package iptv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCheckPortalReachable(t *testing.T) {
+	// 可连接的服务器
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	reachableHost := listener.Addr().String()
+
+	// 不可连接的服务器：监听后立即关闭，端口不再可用
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	unreachableHost := closedListener.Addr().String()
+	closedListener.Close()
+
+	tests := []struct {
+		name    string
+		host    string
+		wantErr bool
+	}{
+		{name: "reachable", host: reachableHost, wantErr: false},
+		{name: "unreachable", host: unreachableHost, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPortalReachable(context.Background(), tt.host, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckPortalReachable(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrPortalUnreachable) {
+				t.Errorf("CheckPortalReachable(%q) error = %v, want ErrPortalUnreachable", tt.host, err)
+			}
+		})
+	}
+}
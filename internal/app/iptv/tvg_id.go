@@ -0,0 +1,55 @@
+package iptv
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+const (
+	TvgIDFieldChannelID     = "channelID"     // 使用频道ID作为tvg-id
+	TvgIDFieldUserChannelID = "userChannelID" // 使用频道号作为tvg-id
+	TvgIDFieldChannelName   = "channelName"   // 使用频道名称作为tvg-id
+	TvgIDFieldHash          = "hash"          // 使用频道分组及名称的哈希值作为tvg-id，适用于频道ID不稳定的情况
+)
+
+// SetChannelTvgID 根据指定的字段设置频道的tvg-id
+func SetChannelTvgID(channels []Channel, field string) {
+	for i := range channels {
+		switch field {
+		case TvgIDFieldUserChannelID:
+			channels[i].TvgID = channels[i].UserChannelID
+		case TvgIDFieldChannelName:
+			channels[i].TvgID = channels[i].ChannelName
+		case TvgIDFieldHash:
+			channels[i].TvgID = getChannelHashID(&channels[i])
+		default:
+			channels[i].TvgID = ""
+		}
+	}
+}
+
+// getChannelHashID 根据频道分组及名称生成稳定的ID，与上游的频道ID无关
+func getChannelHashID(channel *Channel) string {
+	sum := sha1.Sum([]byte(channel.GroupName + "/" + channel.ChannelName))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetTvgID 获取频道的tvg-id，未设置时使用频道ID
+func (c *Channel) GetTvgID() string {
+	if c.TvgID != "" {
+		return c.TvgID
+	}
+	return c.ChannelID
+}
+
+// SetProgramListTvgID 将频道的tvg-id同步到节目单，保证m3u与xmltv中的频道ID一致
+func SetProgramListTvgID(chProgLists []ChannelProgramList, channels []Channel) {
+	tvgIDMap := make(map[string]string, len(channels))
+	for _, channel := range channels {
+		tvgIDMap[channel.ChannelID] = channel.TvgID
+	}
+
+	for i := range chProgLists {
+		chProgLists[i].TvgID = tvgIDMap[chProgLists[i].ChannelId]
+	}
+}
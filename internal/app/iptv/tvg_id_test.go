@@ -0,0 +1,101 @@
+package iptv
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTvgIDField(t *testing.T) {
+	date := time.Now()
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	tests := []struct {
+		name   string
+		field  string
+		wantID string
+	}{
+		{name: "default", field: "", wantID: "1001"},
+		{name: "channel_id", field: TvgIDFieldChannelID, wantID: "1001"},
+		{name: "user_channel_id", field: TvgIDFieldUserChannelID, wantID: "1"},
+		{name: "channel_name", field: TvgIDFieldChannelName, wantID: "CCTV1"},
+		{name: "hash", field: TvgIDFieldHash, wantID: "8b493ab0a55c5b13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newTestChannel(t, "1001", "CCTV1", "http://10.0.0.1/live/1")
+			channel.UserChannelID = "1"
+			channels := []Channel{channel}
+			chProgLists := []ChannelProgramList{
+				{
+					ChannelId:   "1001",
+					ChannelName: "CCTV1",
+					DateProgramList: []DateProgram{
+						{
+							Date: date,
+							ProgramList: []Program{
+								{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+							},
+						},
+					},
+				},
+			}
+
+			SetChannelTvgID(channels, tt.field)
+			SetProgramListTvgID(chProgLists, channels)
+
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			if want := `tvg-id="` + tt.wantID + `" tvg-chno="1"`; !strings.Contains(content, want) {
+				t.Errorf("m3u content missing %q\n%s", want, content)
+			}
+
+			xmlEPG := GetXmlEPGData(chProgLists, 0, XmlEPGOptions{})
+			if len(xmlEPG.Channels) != 1 || xmlEPG.Channels[0].Id != tt.wantID {
+				t.Errorf("xmltv channels = %+v, want id %s", xmlEPG.Channels, tt.wantID)
+			}
+			if len(xmlEPG.Programmes) != 1 || xmlEPG.Programmes[0].Channel != tt.wantID {
+				t.Errorf("xmltv programmes = %+v, want channel %s", xmlEPG.Programmes, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestTvgIDFieldHashStable(t *testing.T) {
+	// 模拟两次刷新，上游的频道ID发生变化，但频道名称及分组不变
+	first := []Channel{
+		newTestChannel(t, "1001", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "1002", "CCTV2", "http://10.0.0.1/live/2"),
+	}
+	second := []Channel{
+		newTestChannel(t, "2002", "CCTV2", "http://10.0.0.1/live/2"),
+		newTestChannel(t, "2001", "CCTV1", "http://10.0.0.1/live/1"),
+	}
+	SetChannelTvgID(first, TvgIDFieldHash)
+	SetChannelTvgID(second, TvgIDFieldHash)
+
+	firstIDs := make(map[string]string, len(first))
+	for _, channel := range first {
+		firstIDs[channel.ChannelName] = channel.GetTvgID()
+	}
+	for _, channel := range second {
+		if got, want := channel.GetTvgID(), firstIDs[channel.ChannelName]; got != want {
+			t.Errorf("tvg-id of %s = %q, want %q", channel.ChannelName, got, want)
+		}
+	}
+	if firstIDs["CCTV1"] == firstIDs["CCTV2"] {
+		t.Errorf("different channels have the same tvg-id %q", firstIDs["CCTV1"])
+	}
+
+	// 分组不同时，生成不同的tvg-id
+	other := newTestChannel(t, "1001", "CCTV1", "http://10.0.0.1/live/1")
+	other.GroupName = "付费"
+	others := []Channel{other}
+	SetChannelTvgID(others, TvgIDFieldHash)
+	if others[0].GetTvgID() == firstIDs["CCTV1"] {
+		t.Errorf("channels in different groups have the same tvg-id %q", firstIDs["CCTV1"])
+	}
+}
@@ -0,0 +1,77 @@
+package iptv
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	URLSchemeHTTP  = "http"
+	URLSchemeHTTPS = "https"
+	URLSchemeRTSP  = "rtsp"
+)
+
+// rtspProxyPath rtsp转http代理的路径前缀，e.g http://192.168.1.1:5140/rtsp/10.0.0.1:554/live/1
+const rtspProxyPath = "/rtsp/"
+
+// SetChannelURLScheme 将频道的http/https单播地址统一改写为指定的协议，适用于TLS反向代理等场景
+// 仅替换协议部分，主机、路径及查询参数保持不变；组播地址等其他协议的地址不受影响
+func SetChannelURLScheme(channels []Channel, scheme string) {
+	if scheme == "" {
+		return
+	}
+
+	for i := range channels {
+		for j := range channels[i].ChannelURLs {
+			channelURL := &channels[i].ChannelURLs[j]
+			if channelURL.Scheme == URLSchemeHTTP || channelURL.Scheme == URLSchemeHTTPS {
+				channelURL.Scheme = scheme
+			}
+		}
+	}
+}
+
+// WithRTSPProxy 将频道的rtsp单播地址改写为经由rtsp转http代理访问的地址，类似于udpxy的组播转单播
+// e.g rtsp://10.0.0.1:554/live/1?a=1 -> http://192.168.1.1:5140/rtsp/10.0.0.1:554/live/1?a=1
+// 返回改写后的频道列表副本，不修改原有的频道列表；组播地址等其他协议的地址保持不变
+func WithRTSPProxy(channels []Channel, rtspProxy string) ([]Channel, error) {
+	if rtspProxy == "" {
+		return channels, nil
+	}
+	if !isAbsoluteHTTPURL(rtspProxy) {
+		return nil, fmt.Errorf("invalid rtsp proxy %q: must be a http(s) url", rtspProxy)
+	}
+	proxyBase := strings.TrimRight(rtspProxy, "/") + rtspProxyPath
+
+	result := slices.Clone(channels)
+	for i := range result {
+		if !slices.ContainsFunc(result[i].ChannelURLs, func(u url.URL) bool { return u.Scheme == URLSchemeRTSP }) {
+			continue
+		}
+
+		channelURLs := slices.Clone(result[i].ChannelURLs)
+		for j, channelURL := range channelURLs {
+			if channelURL.Scheme != URLSchemeRTSP {
+				continue
+			}
+			proxyURL, err := url.Parse(proxyBase + strings.TrimPrefix(channelURL.String(), URLSchemeRTSP+"://"))
+			if err != nil {
+				return nil, err
+			}
+			channelURLs[j] = *proxyURL
+		}
+		result[i].ChannelURLs = channelURLs
+	}
+	return result, nil
+}
+
+// isAbsoluteHTTPURL 判断是否为包含主机的完整http(s)地址
+func isAbsoluteHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,73 @@
+package iptv
+
+import (
+	"testing"
+)
+
+func TestSetChannelURLScheme(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawURL string
+		scheme string
+		want   string
+	}{
+		{"http to https", "http://10.0.0.1:8080/live/1.m3u8?token=abc&b=2", URLSchemeHTTPS, "https://10.0.0.1:8080/live/1.m3u8?token=abc&b=2"},
+		{"https to http", "https://example.com/live/1.m3u8?token=abc", URLSchemeHTTP, "http://example.com/live/1.m3u8?token=abc"},
+		{"unchanged", "http://10.0.0.1/live/1.m3u8?a=1", "", "http://10.0.0.1/live/1.m3u8?a=1"},
+		{"multicast", "igmp://239.1.1.1:5000", URLSchemeHTTPS, "igmp://239.1.1.1:5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := []Channel{newTestChannel(t, "1", "CCTV1", tt.rawURL)}
+			SetChannelURLScheme(channels, tt.scheme)
+
+			got, _, err := getChannelURLStr(channels[0].ChannelURLs, "", false)
+			if err != nil {
+				t.Fatalf("getChannelURLStr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getChannelURLStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRTSPProxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawURL    string
+		rtspProxy string
+		want      string
+	}{
+		{"rtsp", "rtsp://10.0.0.1:554/live/1.sdp?a=1", "http://192.168.1.1:5140", "http://192.168.1.1:5140/rtsp/10.0.0.1:554/live/1.sdp?a=1"},
+		{"trailing slash", "rtsp://10.0.0.1/live/1", "http://192.168.1.1:5140/", "http://192.168.1.1:5140/rtsp/10.0.0.1/live/1"},
+		{"unchanged", "rtsp://10.0.0.1/live/1", "", "rtsp://10.0.0.1/live/1"},
+		{"http", "http://10.0.0.1/live/1.m3u8", "http://192.168.1.1:5140", "http://10.0.0.1/live/1.m3u8"},
+		{"multicast", "igmp://239.1.1.1:5000", "http://192.168.1.1:5140", "http://192.168.1.1:4022/rtp/239.1.1.1:5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := []Channel{newTestChannel(t, "1", "CCTV1", tt.rawURL)}
+			proxied, err := WithRTSPProxy(channels, tt.rtspProxy)
+			if err != nil {
+				t.Fatalf("WithRTSPProxy() error = %v", err)
+			}
+
+			got, _, err := getChannelURLStr(proxied[0].ChannelURLs, "http://192.168.1.1:4022", false)
+			if err != nil {
+				t.Fatalf("getChannelURLStr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getChannelURLStr() = %q, want %q", got, tt.want)
+			}
+			// 不修改原有的频道列表
+			if channels[0].ChannelURLs[0].String() != tt.rawURL {
+				t.Errorf("original url = %q, want %q", channels[0].ChannelURLs[0].String(), tt.rawURL)
+			}
+		})
+	}
+
+	if _, err := WithRTSPProxy(nil, "192.168.1.1:5140"); err == nil {
+		t.Error("WithRTSPProxy() error = nil, want error for proxy without scheme")
+	}
+}
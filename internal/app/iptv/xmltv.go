@@ -0,0 +1,184 @@
+package iptv
+
+import (
+	"encoding/xml"
+	"slices"
+	"time"
+)
+
+const (
+	xmltvGenInfoName = "iptv-tool"
+	xmltvGenInfoUrl  = "https://github.com/super321/iptv-tool"
+
+	xmltvTimeLayout = "20060102150405 -0700"
+)
+
+// DefaultXmltvLocation xmltv中节目时间缺省使用的时区（UTC+8）
+var DefaultXmltvLocation = time.FixedZone("CST", 8*60*60)
+
+// XmlEPG XMLTV格式的EPG
+type XmlEPG struct {
+	XMLName           xml.Name          `xml:"tv"`
+	SourceInfoUrl     string            `xml:"source-info-url,attr,omitempty"`
+	SourceInfoName    string            `xml:"source-info-name,attr,omitempty"`
+	SourceDataUrl     string            `xml:"source-data-url,attr,omitempty"`
+	GeneratorInfoName string            `xml:"generator-info-name,attr,omitempty"`
+	GeneratorInfoUrl  string            `xml:"generator-info-url,attr,omitempty"`
+	Channels          []XmlEPGChannel   `xml:"channel,omitempty"`
+	Programmes        []XmlEPGProgramme `xml:"programme,omitempty"`
+}
+
+type XmlEPGChannel struct {
+	Id          string         `xml:"id,attr"`
+	DisplayName *XmlEPGDisplay `xml:"display-name"`
+	Icon        *XmlEPGIcon    `xml:"icon,omitempty"`
+}
+
+type XmlEPGIcon struct {
+	Src string `xml:"src,attr"`
+}
+
+type XmlEPGProgramme struct {
+	Id       string         `xml:"id,attr,omitempty"`
+	Start    string         `xml:"start,attr"`
+	Stop     string         `xml:"stop,attr"`
+	Channel  string         `xml:"channel,attr"`
+	Title    *XmlEPGDisplay `xml:"title"`
+	SubTitle *XmlEPGDisplay `xml:"sub-title,omitempty"`
+	Desc     *XmlEPGDisplay `xml:"desc,omitempty"`
+}
+
+type XmlEPGDisplay struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XmlEPGOptions 生成xmltv格式节目单的可选参数，零值表示不启用对应的功能
+type XmlEPGOptions struct {
+	SkipEmpty       bool           // 为true时，不输出没有任何节目的频道
+	Location        *time.Location // 节目时间所在的时区，为空时使用DefaultXmltvLocation
+	WithProgID      bool           // 为true时，为每个节目输出由频道ID和开始时间组成的唯一id，便于客户端增量更新
+	LogoBaseURL     string         // 台标的Base URL，为空时不输出频道的icon
+	LogoDir         string         // 台标文件所在的目录，含义与M3UOptions相同
+	LogoPlaceholder bool           // 为true时，台标文件不存在也输出icon，由服务端生成占位台标
+}
+
+// GetXmlEPGData 将频道节目单转为xmltv格式，backDay大于0时仅保留过去几天的节目，opts为可选参数
+func GetXmlEPGData(chProgLists []ChannelProgramList, backDay int, opts XmlEPGOptions) *XmlEPG {
+	loc := opts.Location
+	if loc == nil {
+		loc = DefaultXmltvLocation
+	}
+
+	// 仅保留过去几天的节目
+	if backDay > 0 {
+		chProgLists = FilterProgramsByBackDays(chProgLists, backDay, loc)
+	}
+
+	channels := make([]XmlEPGChannel, 0, len(chProgLists))
+	programmes := make([]XmlEPGProgramme, 0)
+	for _, chProgList := range chProgLists {
+		// 获取频道的节目信息
+		chProgrammes := make([]XmlEPGProgramme, 0)
+		for _, dateProgList := range chProgList.DateProgramList {
+			if len(dateProgList.ProgramList) == 0 {
+				continue
+			}
+			// 节目乱序时按开始时间排序，避免修改缓存的节目单
+			programList := dateProgList.ProgramList
+			if !slices.IsSortedFunc(programList, compareProgramBeginTime) {
+				programList = slices.Clone(programList)
+				SortPrograms(programList)
+			}
+			for _, program := range programList {
+				var progId string
+				if opts.WithProgID {
+					progId = chProgList.GetTvgID() + "-" + program.BeginTimeFormat
+				}
+
+				// 获取节目的相关信息
+				var subTitle *XmlEPGDisplay
+				if program.SubTitle != "" {
+					subTitle = &XmlEPGDisplay{
+						Lang:  "zh",
+						Value: program.SubTitle,
+					}
+				}
+				chProgrammes = append(chProgrammes, XmlEPGProgramme{
+					Id:      progId,
+					Start:   formatXmltvTime(program.BeginTimeFormat, loc),
+					Stop:    formatXmltvTime(program.EndTimeFormat, loc),
+					Channel: chProgList.GetTvgID(),
+					Title: &XmlEPGDisplay{
+						Lang:  "zh",
+						Value: program.ProgramName,
+					},
+					SubTitle: subTitle,
+				})
+			}
+		}
+
+		// 跳过没有节目的频道
+		if opts.SkipEmpty && len(chProgrammes) == 0 {
+			continue
+		}
+
+		// 获取频道的相关信息
+		xmlChannel := XmlEPGChannel{
+			Id: chProgList.GetTvgID(),
+			DisplayName: &XmlEPGDisplay{
+				Lang:  "zh",
+				Value: chProgList.ChannelName,
+			},
+		}
+		if logoUrl := getExistingChannelLogoURL(chProgList.LogoName, opts.LogoBaseURL, opts.LogoDir, opts.LogoPlaceholder); logoUrl != "" {
+			xmlChannel.Icon = &XmlEPGIcon{Src: logoUrl}
+		}
+		channels = append(channels, xmlChannel)
+		programmes = append(programmes, chProgrammes...)
+	}
+
+	return &XmlEPG{
+		GeneratorInfoName: xmltvGenInfoName,
+		GeneratorInfoUrl:  xmltvGenInfoUrl,
+		Channels:          channels,
+		Programmes:        programmes,
+	}
+}
+
+// formatXmltvTime 为节目时间追加时区偏移，e.g 20241122205700 -> 20241122205700 +0800
+func formatXmltvTime(timeFormat string, loc *time.Location) string {
+	t, err := time.ParseInLocation("20060102150405", timeFormat, loc)
+	if err != nil {
+		// 无法解析时，使用时区当前的偏移
+		return timeFormat + " " + time.Now().In(loc).Format("-0700")
+	}
+	return t.Format(xmltvTimeLayout)
+}
+
+// SplitXmlEPG 按频道数量将xmltv拆分为多个部分，每个部分仅包含其频道对应的节目
+func SplitXmlEPG(xmlEPG *XmlEPG, chPerPart int) []*XmlEPG {
+	if chPerPart <= 0 || len(xmlEPG.Channels) <= chPerPart {
+		return []*XmlEPG{xmlEPG}
+	}
+
+	// 按频道ID对节目进行分组
+	chProgrammesMap := make(map[string][]XmlEPGProgramme, len(xmlEPG.Channels))
+	for _, programme := range xmlEPG.Programmes {
+		chProgrammesMap[programme.Channel] = append(chProgrammesMap[programme.Channel], programme)
+	}
+
+	parts := make([]*XmlEPG, 0, (len(xmlEPG.Channels)+chPerPart-1)/chPerPart)
+	for start := 0; start < len(xmlEPG.Channels); start += chPerPart {
+		end := min(start+chPerPart, len(xmlEPG.Channels))
+
+		part := *xmlEPG
+		part.Channels = xmlEPG.Channels[start:end]
+		part.Programmes = make([]XmlEPGProgramme, 0)
+		for _, channel := range part.Channels {
+			part.Programmes = append(part.Programmes, chProgrammesMap[channel.Id]...)
+		}
+		parts = append(parts, &part)
+	}
+	return parts
+}
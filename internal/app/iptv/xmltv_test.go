@@ -0,0 +1,413 @@
+package iptv
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetXmlEPGDataSkipEmpty(t *testing.T) {
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	// 节目时间与节目单日期保持一致
+	progTime := func(date time.Time, hour int) string {
+		return date.Add(time.Duration(hour) * time.Hour).Format("20060102150405")
+	}
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "http://10.0.0.1/live/1"),
+		newTestChannel(t, "2", "CCTV2", "http://10.0.0.1/live/2"),
+		newTestChannel(t, "3", "CCTV3", "http://10.0.0.1/live/3"),
+	}
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId:   "1",
+			ChannelName: "CCTV1",
+			DateProgramList: []DateProgram{
+				{
+					Date: today,
+					ProgramList: []Program{
+						{ProgramName: "新闻", BeginTimeFormat: progTime(today, 6), EndTimeFormat: progTime(today, 7)},
+					},
+				},
+			},
+		},
+		{
+			ChannelId:       "2",
+			ChannelName:     "CCTV2",
+			DateProgramList: []DateProgram{{Date: today}},
+		},
+		{
+			ChannelId:   "3",
+			ChannelName: "CCTV3",
+			DateProgramList: []DateProgram{
+				{
+					// 超出保留天数的节目单
+					Date: today.AddDate(0, 0, -3),
+					ProgramList: []Program{
+						{ProgramName: "体育", BeginTimeFormat: progTime(today.AddDate(0, 0, -3), 6), EndTimeFormat: progTime(today.AddDate(0, 0, -3), 7)},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		skipEmpty bool
+		want      []string
+	}{
+		{name: "keep_empty", skipEmpty: false, want: []string{"1", "2", "3"}},
+		{name: "skip_empty", skipEmpty: true, want: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlEPG := GetXmlEPGData(chProgLists, 1, XmlEPGOptions{SkipEmpty: tt.skipEmpty})
+			got := make([]string, 0, len(xmlEPG.Channels))
+			for _, ch := range xmlEPG.Channels {
+				got = append(got, ch.Id)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("channels = %v, want %v", got, tt.want)
+			}
+			if len(xmlEPG.Programmes) != 1 {
+				t.Errorf("programmes = %d, want 1", len(xmlEPG.Programmes))
+			}
+
+			// 跳过的频道仍需保留在直播源中
+			content, _, err := ToM3UFormat(channels, "", "", false, M3UOptions{ExtInfDuration: -1})
+			if err != nil {
+				t.Fatalf("ToM3UFormat() error = %v", err)
+			}
+			for _, ch := range channels {
+				if !strings.Contains(content, ","+ch.ChannelName+"\n") {
+					t.Errorf("m3u content missing channel %s", ch.ChannelName)
+				}
+			}
+		})
+	}
+}
+
+func TestGetXmlEPGDataEmpty(t *testing.T) {
+	xmlEPG := GetXmlEPGData(nil, 0, XmlEPGOptions{SkipEmpty: true})
+	if xmlEPG.GeneratorInfoName != xmltvGenInfoName {
+		t.Errorf("GeneratorInfoName = %q, want %q", xmlEPG.GeneratorInfoName, xmltvGenInfoName)
+	}
+	if len(xmlEPG.Channels) != 0 || len(xmlEPG.Programmes) != 0 {
+		t.Errorf("unexpected data: %+v", xmlEPG)
+	}
+}
+
+func TestSplitXmlEPG(t *testing.T) {
+	date := time.Now()
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	chProgLists := make([]ChannelProgramList, 0, 5)
+	for i := 1; i <= 5; i++ {
+		id := strconv.Itoa(i)
+		chProgLists = append(chProgLists, ChannelProgramList{
+			ChannelId:   id,
+			ChannelName: "CCTV" + id,
+			DateProgramList: []DateProgram{
+				{
+					Date: date,
+					ProgramList: []Program{
+						{ProgramName: "新闻" + id, BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+						{ProgramName: "天气" + id, BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+					},
+				},
+			},
+		})
+	}
+	xmlEPG := GetXmlEPGData(chProgLists, 0, XmlEPGOptions{})
+
+	tests := []struct {
+		name      string
+		chPerPart int
+		wantParts []int
+	}{
+		{name: "no_split", chPerPart: 0, wantParts: []int{5}},
+		{name: "larger_than_total", chPerPart: 10, wantParts: []int{5}},
+		{name: "split_by_2", chPerPart: 2, wantParts: []int{2, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitXmlEPG(xmlEPG, tt.chPerPart)
+			if len(parts) != len(tt.wantParts) {
+				t.Fatalf("len(parts) = %d, want %d", len(parts), len(tt.wantParts))
+			}
+
+			chCount, progCount := 0, 0
+			for i, part := range parts {
+				// 每个部分都必须是完整有效的xmltv文件
+				data, err := xml.Marshal(part)
+				if err != nil {
+					t.Fatalf("failed to marshal part %d: %v", i, err)
+				}
+				var parsed XmlEPG
+				if err = xml.Unmarshal(data, &parsed); err != nil {
+					t.Fatalf("failed to unmarshal part %d: %v", i, err)
+				}
+				if parsed.GeneratorInfoName != xmltvGenInfoName {
+					t.Errorf("part %d GeneratorInfoName = %q", i, parsed.GeneratorInfoName)
+				}
+				if len(parsed.Channels) != tt.wantParts[i] {
+					t.Errorf("part %d channels = %d, want %d", i, len(parsed.Channels), tt.wantParts[i])
+				}
+
+				// 节目只能引用本部分中的频道
+				chIds := make(map[string]bool, len(parsed.Channels))
+				for _, ch := range parsed.Channels {
+					chIds[ch.Id] = true
+				}
+				for _, programme := range parsed.Programmes {
+					if !chIds[programme.Channel] {
+						t.Errorf("part %d has programme for channel %s outside the part", i, programme.Channel)
+					}
+				}
+				chCount += len(parsed.Channels)
+				progCount += len(parsed.Programmes)
+			}
+			if chCount != len(xmlEPG.Channels) || progCount != len(xmlEPG.Programmes) {
+				t.Errorf("parts contain %d channels and %d programmes, want %d and %d",
+					chCount, progCount, len(xmlEPG.Channels), len(xmlEPG.Programmes))
+			}
+		})
+	}
+}
+
+func TestGetXmlEPGDataTimeOffset(t *testing.T) {
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId:   "1",
+			ChannelName: "CCTV1",
+			DateProgramList: []DateProgram{
+				{
+					Date: time.Now(),
+					ProgramList: []Program{
+						{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		loc       *time.Location
+		wantStart string
+		wantStop  string
+	}{
+		{name: "default", loc: nil, wantStart: "20241122060000 +0800", wantStop: "20241122070000 +0800"},
+		{name: "utc", loc: time.UTC, wantStart: "20241122060000 +0000", wantStop: "20241122070000 +0000"},
+		{name: "negative", loc: time.FixedZone("EST", -5*60*60), wantStart: "20241122060000 -0500", wantStop: "20241122070000 -0500"},
+		{name: "half_hour", loc: time.FixedZone("IST", 5*60*60+30*60), wantStart: "20241122060000 +0530", wantStop: "20241122070000 +0530"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := xml.Marshal(GetXmlEPGData(chProgLists, 0, XmlEPGOptions{Location: tt.loc}))
+			if err != nil {
+				t.Fatalf("failed to marshal xmltv: %v", err)
+			}
+			xmlStr := string(data)
+			if want := `start="` + tt.wantStart + `"`; !strings.Contains(xmlStr, want) {
+				t.Errorf("xmltv does not contain %s: %s", want, xmlStr)
+			}
+			if want := `stop="` + tt.wantStop + `"`; !strings.Contains(xmlStr, want) {
+				t.Errorf("xmltv does not contain %s: %s", want, xmlStr)
+			}
+		})
+	}
+}
+
+func TestGetXmlEPGDataProgId(t *testing.T) {
+	newChProgLists := func() []ChannelProgramList {
+		chProgLists := make([]ChannelProgramList, 0, 2)
+		for _, id := range []string{"1", "2"} {
+			chProgLists = append(chProgLists, ChannelProgramList{
+				ChannelId:   id,
+				ChannelName: "CCTV" + id,
+				DateProgramList: []DateProgram{
+					{
+						Date: time.Now(),
+						ProgramList: []Program{
+							{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+							{ProgramName: "天气", BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+						},
+					},
+				},
+			})
+		}
+		return chProgLists
+	}
+
+	first := GetXmlEPGData(newChProgLists(), 0, XmlEPGOptions{WithProgID: true})
+	second := GetXmlEPGData(newChProgLists(), 0, XmlEPGOptions{WithProgID: true})
+	if len(first.Programmes) != 4 || len(second.Programmes) != 4 {
+		t.Fatalf("len(Programmes) = %d, %d, want 4", len(first.Programmes), len(second.Programmes))
+	}
+
+	ids := make(map[string]bool, len(first.Programmes))
+	for i, programme := range first.Programmes {
+		if programme.Id == "" {
+			t.Errorf("programme %d has no id", i)
+		}
+		if ids[programme.Id] {
+			t.Errorf("duplicate programme id %q", programme.Id)
+		}
+		ids[programme.Id] = true
+		// 多次生成时保持不变
+		if second.Programmes[i].Id != programme.Id {
+			t.Errorf("programme %d id = %q, want %q", i, second.Programmes[i].Id, programme.Id)
+		}
+	}
+	if first.Programmes[0].Id != "1-20241122060000" {
+		t.Errorf("programme id = %q, want 1-20241122060000", first.Programmes[0].Id)
+	}
+
+	// 缺省不输出id属性
+	data, err := xml.Marshal(GetXmlEPGData(newChProgLists(), 0, XmlEPGOptions{}))
+	if err != nil {
+		t.Fatalf("failed to marshal xmltv: %v", err)
+	}
+	if strings.Contains(string(data), `<programme id="`) {
+		t.Errorf("xmltv unexpectedly contains programme id: %s", data)
+	}
+}
+
+func TestGetXmlEPGDataSortPrograms(t *testing.T) {
+	shuffled := []Program{
+		{ProgramName: "天气", BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+		{ProgramName: "电影", BeginTimeFormat: "20241122090000", EndTimeFormat: "20241122110000"},
+		{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+		{ProgramName: "综艺", BeginTimeFormat: "20241122080000", EndTimeFormat: "20241122090000"},
+	}
+	chProgLists := []ChannelProgramList{
+		{
+			ChannelId:       "1",
+			ChannelName:     "CCTV1",
+			DateProgramList: []DateProgram{{Date: time.Now(), ProgramList: shuffled}},
+		},
+	}
+
+	xmlEPG := GetXmlEPGData(chProgLists, 0, XmlEPGOptions{Location: time.UTC})
+	want := []string{"新闻", "天气", "综艺", "电影"}
+	if len(xmlEPG.Programmes) != len(want) {
+		t.Fatalf("len(Programmes) = %d, want %d", len(xmlEPG.Programmes), len(want))
+	}
+	for i, programme := range xmlEPG.Programmes {
+		if programme.Title.Value != want[i] {
+			t.Errorf("programme %d = %s, want %s", i, programme.Title.Value, want[i])
+		}
+	}
+	// 不修改原有的节目单
+	if shuffled[0].ProgramName != "天气" {
+		t.Errorf("the cached program list should not be modified, got %s", shuffled[0].ProgramName)
+	}
+}
+
+func TestFindOverlappingPrograms(t *testing.T) {
+	programs := []Program{
+		{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122073000"},
+		{ProgramName: "综艺", BeginTimeFormat: "20241122080000", EndTimeFormat: "20241122090000"},
+		{ProgramName: "天气", BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+	}
+
+	SortPrograms(programs)
+	if programs[1].ProgramName != "天气" {
+		t.Fatalf("programs[1] = %s, want 天气", programs[1].ProgramName)
+	}
+
+	overlaps := FindOverlappingPrograms(programs)
+	if len(overlaps) != 1 || overlaps[0].ProgramName != "天气" {
+		t.Errorf("FindOverlappingPrograms() = %+v, want [天气]", overlaps)
+	}
+}
+
+func TestGetXmlEPGDataIcon(t *testing.T) {
+	logoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logoDir, "CCTV1.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	channels := []Channel{
+		newTestChannel(t, "1", "CCTV1", "igmp://239.1.1.1:5000"),
+		newTestChannel(t, "2", "CCTV2", "igmp://239.1.1.2:5000"),
+	}
+	channels[0].LogoName = "CCTV1"
+	channels[1].LogoName = "CCTV2"
+	chProgLists := []ChannelProgramList{
+		{ChannelId: "1", ChannelName: "CCTV1"},
+		{ChannelId: "2", ChannelName: "CCTV2"},
+	}
+	SetProgramListLogoName(chProgLists, channels)
+
+	tests := []struct {
+		name            string
+		logoBaseUrl     string
+		logoPlaceholder bool
+		want            []string
+	}{
+		{name: "no_base_url", logoBaseUrl: "", want: []string{"", ""}},
+		{name: "existing_only", logoBaseUrl: "http://iptv.lan:8080/logo", want: []string{"http://iptv.lan:8080/logo/CCTV1.png", ""}},
+		{name: "placeholder", logoBaseUrl: "http://iptv.lan:8080/logo", logoPlaceholder: true,
+			want: []string{"http://iptv.lan:8080/logo/CCTV1.png", "http://iptv.lan:8080/logo/CCTV2.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlEPG := GetXmlEPGData(chProgLists, 0, XmlEPGOptions{LogoBaseURL: tt.logoBaseUrl, LogoDir: logoDir, LogoPlaceholder: tt.logoPlaceholder})
+			for i, want := range tt.want {
+				var got string
+				if icon := xmlEPG.Channels[i].Icon; icon != nil {
+					got = icon.Src
+				}
+				if got != want {
+					t.Errorf("channel %d icon = %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+
+	data, err := xml.Marshal(GetXmlEPGData(chProgLists, 0, XmlEPGOptions{LogoBaseURL: "http://iptv.lan:8080/logo", LogoDir: logoDir}))
+	if err != nil {
+		t.Fatalf("failed to marshal xmltv: %v", err)
+	}
+	if !strings.Contains(string(data), `<icon src="http://iptv.lan:8080/logo/CCTV1.png"></icon>`) {
+		t.Errorf("xmltv = %s, want icon of CCTV1", data)
+	}
+}
+
+func TestGetXmlEPGDataSubTitle(t *testing.T) {
+	chProgLists := []ChannelProgramList{{
+		ChannelId:   "1",
+		ChannelName: "CCTV1",
+		DateProgramList: []DateProgram{{
+			Date: time.Now(),
+			ProgramList: []Program{
+				{ProgramName: "电视剧", SubTitle: "第1集", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+				{ProgramName: "新闻", BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+			},
+		}},
+	}}
+
+	data, err := xml.Marshal(GetXmlEPGData(chProgLists, 0, XmlEPGOptions{}))
+	if err != nil {
+		t.Fatalf("failed to marshal xmltv: %v", err)
+	}
+	xmlStr := string(data)
+	if !strings.Contains(xmlStr, `<title lang="zh">电视剧</title><sub-title lang="zh">第1集</sub-title>`) {
+		t.Errorf("xmltv = %s, want sub-title of the first programme", xmlStr)
+	}
+	// 没有副标题的节目不输出sub-title
+	if n := strings.Count(xmlStr, "<sub-title"); n != 1 {
+		t.Errorf("sub-title count = %d, want 1", n)
+	}
+}
@@ -1,13 +1,18 @@
 package router
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
+	"iptv/internal/app/config"
 	"iptv/internal/app/iptv"
 	"iptv/internal/pkg/util"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -15,62 +20,173 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	formatM3U = "m3u"
+	formatTXT = "txt"
+	formatPLS = "pls"
+
+	// 预先生成m3u内容时，台标地址中请求Host的占位符
+	prerenderHostPlaceholder = "{{host}}"
+
+	// 相对路径的台标地址，由播放器基于直播源地址进行解析
+	relativeLogoBaseUrl = "/logo"
+
+	// 请求参数catchup为该值时，不输出任何回看相关的属性，适用于无法识别catchup属性的播放器
+	catchupOff = "off"
+
+	// 直播源内容小于该字节数时不进行gzip压缩
+	gzipMinSize = 1024
+)
+
+// errNoChannels 上游成功响应但频道列表为空，通常为平台维护期间的临时状态
+var errNoChannels = errors.New("no channels found")
+
 var (
 	// 缓存最新的频道列表数据
 	channelsPtr atomic.Pointer[[]iptv.Channel]
+	// 缓存IPTV客户端返回的频道列表，用于热加载频道规则时重新处理，无需请求上游
+	rawChannelsPtr atomic.Pointer[[]iptv.Channel]
+	// 热加载的频道规则，为空时仅使用IPTV客户端中的规则
+	chRulesPtr atomic.Pointer[iptv.ChannelRules]
+	// 避免刷新频道列表与热加载规则同时处理频道列表
+	channelsMu sync.Mutex
+
+	// 缓存预先生成的直播源内容（缺省请求参数）
+	prerenderedPtr atomic.Pointer[map[string]string]
+	// 需要预先生成的直播源格式
+	prerenderFormats []string
 )
 
 // GetM3UData 查询直播源m3u
 func GetM3UData(c *gin.Context) {
-	// 获取catchup-source格式
+	// 根据User-Agent获取播放器的预设参数，请求中携带的参数优先
+	preset := getUserAgentPreset(c.Request.UserAgent())
+
+	// 优先返回预先生成的内容
+	if content, ok := getPrerendered(c, formatM3U); ok && preset == nil {
+		stringWithGzip(c, http.StatusOK, strings.ReplaceAll(content, prerenderHostPlaceholder, c.Request.Host))
+		return
+	}
+
+	// 获取catchup-source格式，关闭回看时不输出回看相关的属性
 	var catchupSource string
-	csFormat := c.Query("csFormat")
-	if csFormat != "" {
-		// 如果取不到对应的catchup-source，则不生成catchup相关内容
-		catchupSource = catchupSources[csFormat]
-	} else {
-		// 若未指定，则默认随机取其中一个
-		for _, k := range util.SortedMapKeys(catchupSources) {
-			catchupSource = catchupSources[k]
-			break
-		}
+	if !strings.EqualFold(defaultQuery(c, preset, "catchup", ""), catchupOff) {
+		catchupSource = getCatchupSource(defaultQuery(c, preset, "csFormat", ""))
 	}
 
 	// 是否优先是由组播地址
-	multiFirstStr := c.DefaultQuery("multiFirst", "true")
+	multiFirstStr := defaultQuery(c, preset, "multiFirst", "true")
 	multicastFirst, err := strconv.ParseBool(multiFirstStr)
 	if err != nil {
 		multicastFirst = true
 	}
 
 	// 获取指定的udpxy
-	udpxyName := c.Query("udpxy")
+	udpxyName := defaultQuery(c, preset, "udpxy", "")
 	udpxyURL := getUdpxyURL(udpxyName)
 
-	channels := *channelsPtr.Load()
+	channels := sortChannelsByQuery(c, preset, filterChannelsByGroupQuery(c, preset, *channelsPtr.Load()))
 	if len(channels) == 0 {
 		c.Status(http.StatusNotFound)
 		return
 	}
+	channels = withRTSPProxyQuery(c, preset, channels)
 
-	// 设置台标的统一Base URL
-	logoBaseUrl := fmt.Sprintf("http://%s/logo", c.Request.Host)
+	// 设置台标的统一Base URL，可选择输出相对路径，由播放器基于直播源地址进行解析
+	logoBaseUrl := getLogoBaseUrl(c.Request.Host)
+	if relativeLogo, err := strconv.ParseBool(defaultQuery(c, preset, "relativeLogo", "false")); err == nil && relativeLogo {
+		logoBaseUrl = relativeLogoBaseUrl
+	}
+
+	// 是否在直播源中内嵌当前及下一个节目
+	var nowNextMap map[string][]iptv.Program
+	if inlineEPG, err := strconv.ParseBool(defaultQuery(c, preset, "inlineEPG", "false")); err == nil && inlineEPG {
+		if epgListPtr := epgPtr.Load(); epgListPtr != nil {
+			nowNextMap = iptv.GetNowNextPrograms(*epgListPtr, time.Now(), xmltvLocation)
+		}
+	}
+
+	// 是否为支持回看的频道额外输出回看条目
+	catchupEntry, err := strconv.ParseBool(defaultQuery(c, preset, "catchupEntry", "false"))
+	if err != nil {
+		catchupEntry = false
+	}
+
+	// 获取m3u的目标播放器或服务，e.g tvheadend
+	m3uTarget := defaultQuery(c, preset, "target", "")
+
+	// 是否标记支持时移的频道可录制（tvg-rec）
+	tvgRec, err := strconv.ParseBool(defaultQuery(c, preset, "tvgRec", "false"))
+	if err != nil {
+		tvgRec = false
+	}
+
+	// 是否在每个分组前输出分组名称及频道数量的注释行
+	groupComments, err := strconv.ParseBool(defaultQuery(c, preset, "groupComments", "false"))
+	if err != nil {
+		groupComments = false
+	}
+
+	// 节目单地址，参数值为空时不输出url-tvg属性
+	epgURL := defaultQuery(c, preset, "epgUrl", getEPGURL(c.Request.Host))
+
+	// 是否按节目单实际覆盖的回看天数限制catchup-days，尚未获取到节目单时不限制
+	var epgBackDaysMap map[string]int
+	capByEPG, err := strconv.ParseBool(defaultQuery(c, preset, "catchupDaysFromEpg", strconv.FormatBool(catchupDaysFromEPG)))
+	if err != nil {
+		capByEPG = catchupDaysFromEPG
+	}
+	if capByEPG {
+		if epgListPtr := epgPtr.Load(); epgListPtr != nil {
+			epgBackDaysMap = iptv.GetEPGBackDays(*epgListPtr, time.Now(), xmltvLocation)
+		}
+	}
+
+	// 频道无法获取URL地址时是否中止生成
+	strict, err := strconv.ParseBool(defaultQuery(c, preset, "strict", strconv.FormatBool(m3uStrict)))
+	if err != nil {
+		strict = m3uStrict
+	}
 
 	// 将获取到的频道列表转换为m3u格式
-	m3uContent, err := iptv.ToM3UFormat(channels, udpxyURL, catchupSource, multicastFirst, logoBaseUrl)
+	m3uContent, skipped, err := iptv.ToM3UFormat(channels, udpxyURL, catchupSource, multicastFirst, iptv.M3UOptions{
+		LogoBaseURL:     logoBaseUrl,
+		NowNextMap:      nowNextMap,
+		ExtInfDuration:  extInfDuration,
+		CatchupEntry:    catchupEntry,
+		Target:          m3uTarget,
+		TvgRec:          tvgRec,
+		GroupComments:   groupComments,
+		MaxCatchupDays:  maxCatchupDays,
+		LogoDir:         logoDir,
+		EPGURL:          epgURL,
+		EPGBackDaysMap:  epgBackDaysMap,
+		LogoPlaceholder: logoPlaceholder,
+		GroupRenameMap:  getGroupRenameQuery(c),
+		Strict:          strict,
+	})
 	if err != nil {
 		logger.Error("Failed to convert channel list to m3u format.", zap.Error(err))
 		// 返回响应
 		c.Status(http.StatusOK)
 		return
 	}
+	if len(skipped) > 0 {
+		logger.Warn("Channels without a valid url have been skipped.", zap.Int("skipped", len(skipped)), zap.Strings("channels", skipped))
+	}
 
 	// 返回响应
-	c.String(http.StatusOK, m3uContent)
+	stringWithGzip(c, http.StatusOK, iptv.NormalizeTrailingNewline(m3uContent, trailingNewline))
 }
 
 // GetTXTData 查询直播源txt
 func GetTXTData(c *gin.Context) {
+	// 优先返回预先生成的内容
+	if content, ok := getPrerendered(c, formatTXT); ok {
+		stringWithGzip(c, http.StatusOK, content)
+		return
+	}
+
 	// 是否优先是由组播地址
 	multiFirstStr := c.DefaultQuery("multiFirst", "true")
 	multicastFirst, err := strconv.ParseBool(multiFirstStr)
@@ -82,14 +198,15 @@ func GetTXTData(c *gin.Context) {
 	udpxyName := c.Query("udpxy")
 	udpxyURL := getUdpxyURL(udpxyName)
 
-	channels := *channelsPtr.Load()
+	channels := sortChannelsByQuery(c, nil, filterChannelsByGroupQuery(c, nil, *channelsPtr.Load()))
 	if len(channels) == 0 {
 		c.Status(http.StatusNotFound)
 		return
 	}
+	channels = withRTSPProxyQuery(c, nil, channels)
 
 	// 将获取到的频道列表转换为txt格式
-	txtContent, err := iptv.ToTxtFormat(channels, udpxyURL, multicastFirst)
+	txtContent, err := iptv.ToTxtFormat(channels, udpxyURL, multicastFirst, getGroupRenameQuery(c))
 	if err != nil {
 		logger.Error("Failed to convert channel list to txt format.", zap.Error(err))
 		// 返回响应
@@ -98,11 +215,17 @@ func GetTXTData(c *gin.Context) {
 	}
 
 	// 返回响应
-	c.String(http.StatusOK, txtContent)
+	stringWithGzip(c, http.StatusOK, iptv.NormalizeTrailingNewline(txtContent, trailingNewline))
 }
 
 // GetPLSData 查询直播源pls
 func GetPLSData(c *gin.Context) {
+	// 优先返回预先生成的内容
+	if content, ok := getPrerendered(c, formatPLS); ok {
+		c.String(http.StatusOK, content)
+		return
+	}
+
 	// 是否优先是由组播地址
 	multiFirstStr := c.DefaultQuery("multiFirst", "true")
 	multicastFirst, err := strconv.ParseBool(multiFirstStr)
@@ -119,6 +242,7 @@ func GetPLSData(c *gin.Context) {
 		c.Status(http.StatusNotFound)
 		return
 	}
+	channels = withRTSPProxyQuery(c, nil, channels)
 
 	// 将获取到的频道列表转换为pls格式
 	content, err := iptv.ToPLSFormat(channels, udpxyURL, multicastFirst)
@@ -130,15 +254,222 @@ func GetPLSData(c *gin.Context) {
 	}
 
 	// 返回响应
-	c.String(http.StatusOK, content)
+	c.String(http.StatusOK, iptv.NormalizeTrailingNewline(content, trailingNewline))
+}
+
+// GetJSONData 查询直播源json，供面板等程序直接解析
+func GetJSONData(c *gin.Context) {
+	// 获取catchup-source格式，关闭回看时不输出回看信息
+	var catchupSource string
+	if !strings.EqualFold(c.Query("catchup"), catchupOff) {
+		catchupSource = getCatchupSource(c.Query("csFormat"))
+	}
+
+	// 是否优先是由组播地址
+	multiFirstStr := c.DefaultQuery("multiFirst", "true")
+	multicastFirst, err := strconv.ParseBool(multiFirstStr)
+	if err != nil {
+		multicastFirst = true
+	}
+
+	// 获取指定的udpxy
+	udpxyName := c.Query("udpxy")
+	udpxyURL := getUdpxyURL(udpxyName)
+
+	// 是否输出频道的所有原始地址
+	verbose, err := strconv.ParseBool(c.DefaultQuery("verbose", "false"))
+	if err != nil {
+		verbose = false
+	}
+
+	channels := *channelsPtr.Load()
+	if len(channels) == 0 {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	channels = withRTSPProxyQuery(c, nil, channels)
+
+	// 将获取到的频道列表转换为json格式
+	content, err := iptv.ToJSONFormat(channels, udpxyURL, catchupSource, multicastFirst, getLogoBaseUrl(c.Request.Host), maxCatchupDays, logoDir, verbose)
+	if err != nil {
+		logger.Error("Failed to convert channel list to json format.", zap.Error(err))
+		// 返回响应
+		c.Status(http.StatusOK)
+		return
+	}
+
+	// 返回响应
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(content))
+}
+
+// filterChannelsByGroupQuery 按请求参数groups、excludeGroups中逗号分隔的分组名称过滤频道，m3u与txt保持一致
+func filterChannelsByGroupQuery(c *gin.Context, preset map[string]string, channels []iptv.Channel) []iptv.Channel {
+	include := splitQueryList(defaultQuery(c, preset, "groups", ""))
+	exclude := splitQueryList(defaultQuery(c, preset, "excludeGroups", ""))
+	return iptv.FilterChannelsByGroups(channels, include, exclude)
+}
+
+// sortChannelsByQuery 按请求参数sort对频道排序，可选值为none、chno、name，缺省为none保持原有顺序
+func sortChannelsByQuery(c *gin.Context, preset map[string]string, channels []iptv.Channel) []iptv.Channel {
+	return iptv.SortChannels(channels, strings.ToLower(defaultQuery(c, preset, "sort", iptv.ChannelSortNone)))
+}
+
+// stringWithGzip 返回直播源的文本内容，客户端支持gzip且内容不小于gzipMinSize时进行gzip压缩
+func stringWithGzip(c *gin.Context, code int, content string) {
+	c.Header("Vary", "Accept-Encoding")
+	if len(content) < gzipMinSize || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.String(code, content)
+		return
+	}
+
+	c.Header("Content-Encoding", "gzip")
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(code)
+
+	// 创建一个gzip压缩的Writer，并将内容写入其中
+	gzipWriter := gzip.NewWriter(c.Writer)
+	defer gzipWriter.Close()
+	if _, err := gzipWriter.Write([]byte(content)); err != nil {
+		logger.Error("Failed to write gzip data.", zap.Error(err))
+	}
+}
+
+// acceptsGzip 根据请求头Accept-Encoding判断客户端是否支持gzip压缩，q=0表示不接受
+func acceptsGzip(acceptEncoding string) bool {
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		if _, qValue, ok := strings.Cut(params, "q="); ok {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(qValue), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// withRTSPProxyQuery 按请求参数rtspProxy指定的rtsp转http代理地址，改写频道的rtsp单播地址
+// 代理地址不是合法的http(s)地址时，记录警告日志并保持不变
+func withRTSPProxyQuery(c *gin.Context, preset map[string]string, channels []iptv.Channel) []iptv.Channel {
+	proxied, err := iptv.WithRTSPProxy(channels, strings.TrimSpace(defaultQuery(c, preset, "rtspProxy", "")))
+	if err != nil {
+		logger.Warn("Failed to rewrite rtsp urls. Keep them unchanged.", zap.Error(err))
+		return channels
+	}
+	return proxied
+}
+
+// getGroupRenameQuery 获取请求参数rename中的分组名称映射，参数可以重复，格式为：原分组名称:新分组名称
+// 格式不正确或名称为空的参数将被忽略
+func getGroupRenameQuery(c *gin.Context) map[string]string {
+	var groupRenameMap map[string]string
+	for _, rename := range c.QueryArray("rename") {
+		oldName, newName, ok := strings.Cut(rename, ":")
+		oldName, newName = strings.TrimSpace(oldName), strings.TrimSpace(newName)
+		if !ok || oldName == "" || newName == "" {
+			continue
+		}
+		if groupRenameMap == nil {
+			groupRenameMap = make(map[string]string)
+		}
+		groupRenameMap[oldName] = newName
+	}
+	return groupRenameMap
+}
+
+// splitQueryList 拆分逗号分隔的请求参数，忽略空白的项
+func splitQueryList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getUserAgentPreset 获取与User-Agent匹配的第一个播放器预设参数，未匹配时返回nil
+func getUserAgentPreset(userAgent string) map[string]string {
+	userAgent = strings.ToLower(userAgent)
+	for _, preset := range uaPresets {
+		if strings.Contains(userAgent, strings.ToLower(preset.Match)) {
+			return preset.Params
+		}
+	}
+	return nil
+}
+
+// defaultQuery 获取请求参数，请求未携带时依次使用播放器的预设参数及缺省值
+func defaultQuery(c *gin.Context, preset map[string]string, key, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	if value, ok := preset[key]; ok {
+		return value
+	}
+	return defaultValue
+}
+
+// getLogoBaseUrl 获取台标的Base URL，优先使用配置的外部访问地址
+// 不是合法的绝对地址时（如：请求的Host异常），记录警告日志并回退为相对路径
+func getLogoBaseUrl(host string) string {
+	logoBaseUrl := logoBaseURL
+	if logoBaseUrl == "" {
+		logoBaseUrl = fmt.Sprintf("http://%s/logo", host)
+	}
+	if logoBaseUrl != relativeLogoBaseUrl && !iptv.IsAbsoluteLogoBaseURL(logoBaseUrl) {
+		logger.Warn("The logo base url is not a valid absolute url. Use the relative path instead.", zap.String("logoBaseUrl", logoBaseUrl))
+		return relativeLogoBaseUrl
+	}
+	return logoBaseUrl
+}
+
+// getEPGURL 获取m3u中url-tvg属性缺省指向的XMLTV节目单地址，使用节目单更新前不重复生成的/epg.xml
+func getEPGURL(host string) string {
+	return fmt.Sprintf("http://%s/epg.xml", host)
+}
+
+// getCatchupSource 通过catchup-source格式的名称来获取回看请求参数
+func getCatchupSource(csFormat string) string {
+	var catchupSource string
+	// 未指定时，优先使用配置的缺省回看参数
+	if csFormat == "" {
+		csFormat = catchupDefault
+	}
+	if csFormat != "" {
+		// 如果取不到对应的catchup-source，则不生成catchup相关内容
+		catchupSource = catchupSources[csFormat]
+	} else {
+		// 若未指定，则默认随机取其中一个
+		for _, k := range util.SortedMapKeys(catchupSources) {
+			catchupSource = catchupSources[k]
+			break
+		}
+	}
+	return catchupSource
 }
 
 // getUdpxyURL 通过udpxy的名称来获取指定的URL地址
 func getUdpxyURL(udpxyName string) string {
 	var udpxyURL string
+	udpxyName = strings.TrimSpace(udpxyName)
 	if udpxyName != "" {
-		// 获取指定名称的udpxy的URL
-		udpxyURL = udpxyURLs[udpxyName]
+		// 获取指定名称的udpxy的URL，名称不区分大小写
+		var ok bool
+		if udpxyURL, ok = udpxyURLs[udpxyName]; !ok {
+			for name, tmpUdpxyURL := range udpxyURLs {
+				if strings.EqualFold(name, udpxyName) {
+					udpxyURL, ok = tmpUdpxyURL, true
+					break
+				}
+			}
+		}
+		if !ok {
+			logger.Warn("The udpxy with the specified name was not found.", zap.String("udpxy", udpxyName))
+		}
 	} else {
 		// 若未指定名称，则默认随机取其中一个udpxy的URL
 		for _, k := range util.SortedMapKeys(udpxyURLs) {
@@ -146,7 +477,7 @@ func getUdpxyURL(udpxyName string) string {
 			break
 		}
 	}
-	return udpxyURL
+	return iptv.WithMulticastRelayPath(udpxyURL, multicastRelayPath)
 }
 
 // updateChannelsWithRetry 更新缓存的频道数据（失败重试）
@@ -154,8 +485,23 @@ func updateChannelsWithRetry(ctx context.Context, iptvClient iptv.Client, maxRet
 	var err error
 	for i := 0; i < maxRetries; i++ {
 		if err = updateChannels(ctx, iptvClient); err != nil {
-			logger.Sugar().Errorf("Failed to update channel list, will try again after waiting %d seconds. Error: %v, number of retries: %d.", waitSeconds, err, i)
-			time.Sleep(waitSeconds * time.Second)
+			// 未开启空列表重试时，频道列表为空直接返回
+			if errors.Is(err, errNoChannels) && !retryEmptyChannels {
+				break
+			}
+
+			// 被上游限流时，按照要求的时间进行等待
+			wait := waitSeconds * time.Second
+			var rateLimitErr *iptv.RateLimitError
+			if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > wait {
+				wait = rateLimitErr.RetryAfter
+			}
+			if errors.Is(err, errNoChannels) {
+				logger.Sugar().Warnf("The channel list is empty, will try again after waiting %s. Number of retries: %d.", wait, i)
+			} else {
+				logger.Sugar().Errorf("Failed to update channel list, will try again after waiting %s. Error: %v, number of retries: %d.", wait, err, i)
+			}
+			sleep(wait)
 		} else {
 			break
 		}
@@ -172,12 +518,196 @@ func updateChannels(ctx context.Context, iptvClient iptv.Client) error {
 	}
 
 	if len(channels) == 0 {
-		return errors.New("no channels found")
+		return errNoChannels
+	}
+
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	// 缓存规则处理前的频道列表
+	rawChannels := cloneChannels(channels)
+	rawChannelsPtr.Store(&rawChannels)
+
+	if err = applyChannels(channels); err != nil {
+		return err
+	}
+
+	// 记录成功更新的时间
+	now := time.Now()
+	channelsUpdatedAt.Store(&now)
+	return nil
+}
+
+// ReloadChannelRules 使用新的配置重新应用频道的过滤、分组及台标规则
+// 基于缓存的频道列表进行处理，不请求上游；已被原过滤规则过滤掉的频道，需要重新获取频道列表后才会出现
+func ReloadChannelRules(conf *config.Config) error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	// 自定义的频道列表来源不使用频道规则
+	if conf.NewChannelSource() != nil {
+		return errors.New("channel rules are not applied to the custom channel source")
+	}
+
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	rawChannels := rawChannelsPtr.Load()
+	if rawChannels == nil {
+		return errNoChannels
+	}
+
+	chRulesPtr.Store(&iptv.ChannelRules{
+		ExcludeRule:    conf.ChExcludeRule,
+		GroupRulesList: conf.ChGroupRulesList,
+		LogoRuleList:   conf.ChLogoRuleList,
+	})
+	logger.Info("The channel rules have been reloaded.", zap.Int("chGroupRules", len(conf.ChGroupRulesList)), zap.Int("logos", len(conf.ChLogoRuleList)))
+	return applyChannels(cloneChannels(*rawChannels))
+}
+
+// cloneChannels 复制频道列表，避免后续处理修改缓存的频道地址
+func cloneChannels(channels []iptv.Channel) []iptv.Channel {
+	result := slices.Clone(channels)
+	for i := range result {
+		result[i].ChannelURLs = slices.Clone(result[i].ChannelURLs)
+	}
+	return result
+}
+
+// applyChannels 按配置处理频道列表后，更新缓存的频道数据
+func applyChannels(channels []iptv.Channel) error {
+	// 合并频道ID相同的频道
+	if chDedup {
+		var merged int
+		if channels, merged = iptv.MergeDuplicateChannels(channels); merged > 0 {
+			logger.Info("Duplicate channels have been merged.", zap.Int("merged", merged))
+		}
+	}
+
+	// 应用热加载的频道规则
+	if chRules := chRulesPtr.Load(); chRules != nil {
+		channels = iptv.ApplyChannelRules(channels, chRules)
+		if len(channels) == 0 {
+			return errNoChannels
+		}
+	}
+
+	// 设置没有分组的频道的分组名称
+	iptv.SetChannelDefaultGroup(channels, chDefaultGroup)
+	// 按配置的分组顺序排列频道
+	channels = iptv.SortChannelsByGroupOrder(channels, chGroupOrder, chGroupUnlisted)
+	if len(channels) == 0 {
+		return errNoChannels
+	}
+	// 改写频道单播地址的协议
+	iptv.SetChannelURLScheme(channels, chURLScheme)
+	// 没有时移地址的频道使用直播地址进行回看
+	if catchupLiveFallback {
+		iptv.SetChannelLiveTimeShiftURL(channels)
+	}
+	// 设置频道的DRM信息
+	iptv.SetChannelDRM(channels, chDRMMap)
+	// 设置频道的国家和语言信息
+	iptv.SetChannelLocale(channels, chDefaultLocale, chGroupLocaleMap)
+
+	// 检查重复的频道号
+	duplicates := iptv.CheckChannelNumbers(channels, chRenumberDuplicates)
+	for _, number := range util.SortedMapKeys(duplicates) {
+		logger.Warn("Duplicate channel number found.", zap.String("userChannelID", number), zap.Strings("channelNames", duplicates[number]), zap.Bool("renumber", chRenumberDuplicates))
 	}
 
+	// 按配置的字段顺序查找存在的台标文件
+	iptv.SetChannelLogoByFields(channels, logoDir, logoFields)
+
+	// 检查台标名称，按需转换为URL安全的形式
+	if chLogoSanitize {
+		iptv.SanitizeChannelLogoNames(channels)
+	}
+	invalidLogos := iptv.CheckChannelLogos(channels, relativeLogoBaseUrl)
+	for _, channelName := range util.SortedMapKeys(invalidLogos) {
+		logger.Warn("The logo name of the channel cannot produce a valid URL. Please rename the logo or enable logoSanitize.", zap.String("channelName", channelName), zap.String("logoName", invalidLogos[channelName]))
+	}
+
+	// 设置频道的tvg-id
+	iptv.SetChannelTvgID(channels, tvgIDField)
+
 	logger.Sugar().Infof("The channel list has been updated, rows: %d.", len(channels))
 	// 更新缓存的频道列表
 	channelsPtr.Store(&channels)
+	// 频道名称可能已变化，重新生成占位台标
+	logoPlaceholderCache.Clear()
+
+	// 预先生成直播源内容
+	prerenderChannels(channels)
 
 	return nil
 }
+
+// prerenderChannels 按缺省请求参数，预先生成指定格式的直播源内容并缓存
+func prerenderChannels(channels []iptv.Channel) {
+	if len(prerenderFormats) == 0 {
+		return
+	}
+
+	// 与查询接口未携带参数时的缺省值保持一致
+	udpxyURL := getUdpxyURL("")
+	multicastFirst := true
+
+	contents := make(map[string]string, len(prerenderFormats))
+	for _, format := range prerenderFormats {
+		var content string
+		var err error
+		switch format {
+		case formatM3U:
+			logoBaseUrl := logoBaseURL
+			if logoBaseUrl == "" {
+				logoBaseUrl = fmt.Sprintf("http://%s/logo", prerenderHostPlaceholder)
+			}
+			// 与实时生成保持一致，按节目单实际覆盖的回看天数限制catchup-days，节目单更新后会重新生成
+			var epgBackDaysMap map[string]int
+			if catchupDaysFromEPG {
+				if epgListPtr := epgPtr.Load(); epgListPtr != nil {
+					epgBackDaysMap = iptv.GetEPGBackDays(*epgListPtr, time.Now(), xmltvLocation)
+				}
+			}
+			content, _, err = iptv.ToM3UFormat(channels, udpxyURL, getCatchupSource(""), multicastFirst, iptv.M3UOptions{
+				LogoBaseURL:     logoBaseUrl,
+				ExtInfDuration:  extInfDuration,
+				Target:          iptv.M3UTargetDefault,
+				MaxCatchupDays:  maxCatchupDays,
+				LogoDir:         logoDir,
+				EPGURL:          getEPGURL(prerenderHostPlaceholder),
+				EPGBackDaysMap:  epgBackDaysMap,
+				LogoPlaceholder: logoPlaceholder,
+				Strict:          m3uStrict,
+			})
+		case formatTXT:
+			content, err = iptv.ToTxtFormat(channels, udpxyURL, multicastFirst, nil)
+		case formatPLS:
+			content, err = iptv.ToPLSFormat(channels, udpxyURL, multicastFirst)
+		}
+		if err != nil {
+			logger.Warn("Failed to prerender the channel list.", zap.String("format", format), zap.Error(err))
+			continue
+		}
+		contents[format] = iptv.NormalizeTrailingNewline(content, trailingNewline)
+	}
+
+	logger.Sugar().Infof("The channel list has been prerendered, formats: %v.", util.SortedMapKeys(contents))
+	prerenderedPtr.Store(&contents)
+}
+
+// getPrerendered 获取预先生成的直播源内容，仅在请求未携带任何参数时可用
+func getPrerendered(c *gin.Context, format string) (string, bool) {
+	if c.Request.URL.RawQuery != "" {
+		return "", false
+	}
+
+	contents := prerenderedPtr.Load()
+	if contents == nil {
+		return "", false
+	}
+	content, ok := (*contents)[format]
+	return content, ok
+}
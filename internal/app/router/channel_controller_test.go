@@ -0,0 +1,801 @@
+package router
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iptv/internal/app/config"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestChannels 创建用于测试的频道列表
+func newTestChannels(t *testing.T) []iptv.Channel {
+	t.Helper()
+	u1, _ := url.Parse("igmp://239.1.1.1:5000")
+	u2, _ := url.Parse("http://10.0.0.1/live/2")
+	return []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1", UserChannelID: "1", ChannelURLs: []url.URL{*u1}, GroupName: "央视"},
+		{ChannelID: "2", ChannelName: "湖南卫视", UserChannelID: "2", ChannelURLs: []url.URL{*u2}, GroupName: "卫视"},
+	}
+}
+
+func TestUpdateChannelsPrerender(t *testing.T) {
+	udpxyURLs = map[string]string{"0": "http://192.168.1.1:4022"}
+	catchupSources = map[string]string{"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"}
+	prerenderFormats = []string{formatM3U, formatTXT}
+	t.Cleanup(func() {
+		udpxyURLs, catchupSources, prerenderFormats = nil, nil, nil
+		prerenderedPtr.Store(nil)
+	})
+
+	client := &fakeIPTVClient{channels: newTestChannels(t)}
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+
+	contents := prerenderedPtr.Load()
+	if contents == nil {
+		t.Fatal("expected prerendered contents after refresh")
+	}
+	if _, ok := (*contents)[formatPLS]; ok {
+		t.Error("pls should not be prerendered")
+	}
+	wantTxt, _ := iptv.ToTxtFormat(client.channels, "http://192.168.1.1:4022", true, nil)
+	if (*contents)[formatTXT] != wantTxt {
+		t.Errorf("prerendered txt = %q, want %q", (*contents)[formatTXT], wantTxt)
+	}
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+	r.GET("/channel/txt", GetTXTData)
+
+	// 未携带参数的请求直接返回预先生成的内容
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt", nil))
+	if w.Body.String() != wantTxt {
+		t.Errorf("GET /channel/txt = %q, want %q", w.Body.String(), wantTxt)
+	}
+
+	// m3u中的台标地址使用请求的Host
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u", nil))
+	if strings.Contains(w.Body.String(), prerenderHostPlaceholder) {
+		t.Errorf("host placeholder was not replaced:\n%s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "http://192.168.1.1:4022/rtp/239.1.1.1:5000") {
+		t.Errorf("unexpected m3u content:\n%s", w.Body.String())
+	}
+
+	// 携带参数的请求则实时生成
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt?udpxy=none", nil))
+	if !strings.Contains(w.Body.String(), "CCTV1,igmp://239.1.1.1:5000") {
+		t.Errorf("unexpected txt content:\n%s", w.Body.String())
+	}
+}
+
+func TestReloadChannelRules(t *testing.T) {
+	defaultChannels := channelsPtr.Load()
+	t.Cleanup(func() {
+		chRulesPtr.Store(nil)
+		rawChannelsPtr.Store(nil)
+		channelsPtr.Store(defaultChannels)
+	})
+
+	client := &fakeIPTVClient{channels: newTestChannels(t)}
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+
+	conf := &config.Config{
+		Key:                 "12345678",
+		ServerHost:          "127.0.0.1:8080",
+		OptionChExcludeRule: "^CCTV1$",
+		OptionChGroupRulesList: []config.OptionChannelGroupRules{
+			{Name: "湖南", Rules: []string{"^湖南"}},
+		},
+		OptionChLogoRuleList: []config.OptionChannelLogoRule{
+			{Name: "HunanTV", Rule: "^湖南卫视$"},
+		},
+	}
+	if err := ReloadChannelRules(conf); err != nil {
+		t.Fatalf("ReloadChannelRules() error = %v", err)
+	}
+
+	// 基于缓存的频道列表重新应用规则，不请求上游
+	if client.channelCalls != 1 {
+		t.Errorf("channelCalls = %d, want 1", client.channelCalls)
+	}
+	channels := *channelsPtr.Load()
+	if len(channels) != 1 {
+		t.Fatalf("len(channels) = %d, want 1", len(channels))
+	}
+	if channels[0].GroupName != "湖南" || channels[0].LogoName != "HunanTV" {
+		t.Errorf("GroupName = %q, LogoName = %q, want 湖南, HunanTV", channels[0].GroupName, channels[0].LogoName)
+	}
+
+	// 再次刷新频道列表时，继续使用热加载的规则
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+	if channels = *channelsPtr.Load(); len(channels) != 1 || channels[0].GroupName != "湖南" {
+		t.Errorf("channels = %+v, want the reloaded rules applied", channels)
+	}
+}
+
+func TestGetTXTDataTrailingNewline(t *testing.T) {
+	channels := newTestChannels(t)
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() {
+		channelsPtr.Store(defaultChannels)
+		trailingNewline = true
+	})
+
+	r := gin.New()
+	r.GET("/channel/txt", GetTXTData)
+
+	for _, tt := range []struct {
+		trailingNewline bool
+		wantSuffix      string
+	}{
+		{trailingNewline: true, wantSuffix: "http://10.0.0.1/live/2\n"},
+		{trailingNewline: false, wantSuffix: "http://10.0.0.1/live/2"},
+	} {
+		trailingNewline = tt.trailingNewline
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt?multiFirst=false", nil))
+		if body := w.Body.String(); !strings.HasSuffix(body, tt.wantSuffix) || strings.HasSuffix(body, "\n\n") {
+			t.Errorf("trailingNewline=%v, GET /channel/txt = %q, want suffix %q", tt.trailingNewline, body, tt.wantSuffix)
+		}
+	}
+}
+
+func TestGetCatchupSourceDefault(t *testing.T) {
+	catchupSources = map[string]string{
+		"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+		"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+	}
+	t.Cleanup(func() { catchupSources, catchupDefault = nil, "" })
+
+	// 未配置缺省值时，使用名称排序后的第一个
+	if got := getCatchupSource(""); got != catchupSources["0"] {
+		t.Errorf("getCatchupSource(\"\") = %q, want %q", got, catchupSources["0"])
+	}
+
+	// 未指定csFormat时使用配置的缺省值
+	catchupDefault = "1"
+	if got := getCatchupSource(""); got != catchupSources["1"] {
+		t.Errorf("getCatchupSource(\"\") = %q, want %q", got, catchupSources["1"])
+	}
+	// 请求中指定时仍可覆盖
+	if got := getCatchupSource("0"); got != catchupSources["0"] {
+		t.Errorf("getCatchupSource(\"0\") = %q, want %q", got, catchupSources["0"])
+	}
+}
+
+func TestGetLogoBaseUrl(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	defaultLogger := logger
+	logger = zap.New(core)
+	t.Cleanup(func() {
+		logger = defaultLogger
+		logoBaseURL = ""
+	})
+
+	tests := []struct {
+		name        string
+		logoBaseURL string
+		host        string
+		want        string
+		wantWarn    bool
+	}{
+		{name: "request_host", host: "iptv.lan:8080", want: "http://iptv.lan:8080/logo"},
+		{name: "configured", logoBaseURL: "https://iptv.example.com/logo", host: "iptv.lan:8080", want: "https://iptv.example.com/logo"},
+		{name: "configured_without_scheme", logoBaseURL: "iptv.example.com/logo", host: "iptv.lan:8080", want: "/logo", wantWarn: true},
+		{name: "configured_malformed", logoBaseURL: "http://iptv example.com/logo", host: "iptv.lan:8080", want: "/logo", wantWarn: true},
+		{name: "empty_host", host: "", want: "/logo", wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logoBaseURL = tt.logoBaseURL
+			before := logs.Len()
+			if got := getLogoBaseUrl(tt.host); got != tt.want {
+				t.Errorf("getLogoBaseUrl(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+			if warned := logs.Len() > before; warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestGetM3UDataUserAgentPreset(t *testing.T) {
+	catchupSources = map[string]string{
+		"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}",
+		"1": "playseek={utc:YmdHMS}-{utcend:YmdHMS}",
+	}
+	uaPresets = []config.UserAgentPreset{
+		{Match: "kodi", Params: map[string]string{"csFormat": "1"}},
+		{Match: "TiviMate", Params: map[string]string{"csFormat": "0", "groupComments": "true"}},
+	}
+	channels := newTestChannels(t)
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/2")
+	channels[1].TimeShift, channels[1].TimeShiftLength, channels[1].TimeShiftURL = "1", 24*time.Hour, timeShiftURL
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() {
+		catchupSources, uaPresets = nil, nil
+		channelsPtr.Store(defaultChannels)
+	})
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+
+	tests := []struct {
+		name          string
+		userAgent     string
+		query         string
+		wantSource    string
+		wantGroupNote bool
+	}{
+		{name: "kodi", userAgent: "Kodi/21.0 (Linux; Android 12)", wantSource: "{utc:YmdHMS}"},
+		{name: "tivimate", userAgent: "TiviMate/4.7.0 (Android 11)", wantSource: "${(b)yyyyMMddHHmmss}", wantGroupNote: true},
+		{name: "unknown", userAgent: "VLC/3.0.20 LibVLC/3.0.20", wantSource: "${(b)yyyyMMddHHmmss}"},
+		{name: "query_overrides", userAgent: "Kodi/21.0", query: "?csFormat=0", wantSource: "${(b)yyyyMMddHHmmss}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u"+tt.query, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if !strings.Contains(body, tt.wantSource) {
+				t.Errorf("m3u does not contain %q:\n%s", tt.wantSource, body)
+			}
+			if got := strings.Contains(body, "channels)"); got != tt.wantGroupNote {
+				t.Errorf("group comments = %v, want %v", got, tt.wantGroupNote)
+			}
+		})
+	}
+}
+
+// emptyOnceIPTVClient 第一次获取频道列表时返回空列表的IPTV客户端
+type emptyOnceIPTVClient struct {
+	*fakeIPTVClient
+}
+
+func (f *emptyOnceIPTVClient) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error) {
+	channels, err := f.fakeIPTVClient.GetAllChannelList(ctx)
+	if f.channelCalls == 1 {
+		return nil, err
+	}
+	return channels, err
+}
+
+func TestGetM3UDataCatchupOff(t *testing.T) {
+	catchupSources = map[string]string{"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"}
+	channels := newTestChannels(t)
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/2")
+	channels[1].TimeShift, channels[1].TimeShiftLength, channels[1].TimeShiftURL = "1", 24*time.Hour, timeShiftURL
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() {
+		catchupSources = nil
+		channelsPtr.Store(defaultChannels)
+	})
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantCatchup bool
+	}{
+		{name: "default", query: "", wantCatchup: true},
+		{name: "off", query: "?catchup=off", wantCatchup: false},
+		{name: "off_with_entry", query: "?catchup=OFF&csFormat=0&catchupEntry=true", wantCatchup: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if got := strings.Contains(body, "catchup"); got != tt.wantCatchup {
+				t.Errorf("catchup attributes = %v, want %v:\n%s", got, tt.wantCatchup, body)
+			}
+			if !strings.Contains(body, "#EXTM3U") {
+				t.Errorf("m3u is empty:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestUpdateChannelsWithRetryEmpty(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() {
+		sleep = time.Sleep
+		retryEmptyChannels = true
+	})
+
+	// 空列表时等待后重试，第二次获取成功
+	client := &emptyOnceIPTVClient{fakeIPTVClient: &fakeIPTVClient{channels: newTestChannels(t)}}
+	if err := updateChannelsWithRetry(context.Background(), client, 3); err != nil {
+		t.Fatalf("updateChannelsWithRetry() error = %v", err)
+	}
+	if client.channelCalls != 2 {
+		t.Errorf("channelCalls = %d, want 2", client.channelCalls)
+	}
+	if len(waits) != 1 || waits[0] != waitSeconds*time.Second {
+		t.Errorf("waits = %v, want [%s]", waits, waitSeconds*time.Second)
+	}
+
+	// 关闭后空列表直接返回错误
+	retryEmptyChannels = false
+	waits = nil
+	client = &emptyOnceIPTVClient{fakeIPTVClient: &fakeIPTVClient{channels: newTestChannels(t)}}
+	if err := updateChannelsWithRetry(context.Background(), client, 3); !errors.Is(err, errNoChannels) {
+		t.Fatalf("updateChannelsWithRetry() error = %v, want %v", err, errNoChannels)
+	}
+	if client.channelCalls != 1 || len(waits) != 0 {
+		t.Errorf("channelCalls = %d, waits = %v, want a single call without waiting", client.channelCalls, waits)
+	}
+}
+
+func TestGetUdpxyURL(t *testing.T) {
+	udpxyURLs = map[string]string{
+		"inner":       "http://192.168.1.1:4022",
+		"Living-Room": "http://192.168.1.2:4022",
+	}
+	t.Cleanup(func() { udpxyURLs = nil })
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	defaultLogger := logger
+	logger = zap.New(core)
+	t.Cleanup(func() { logger = defaultLogger })
+
+	tests := []struct {
+		name      string
+		udpxyName string
+		want      string
+		wantWarn  bool
+	}{
+		{name: "default", udpxyName: "", want: "http://192.168.1.2:4022"},
+		{name: "exact", udpxyName: "Living-Room", want: "http://192.168.1.2:4022"},
+		{name: "case_insensitive", udpxyName: "living-room", want: "http://192.168.1.2:4022"},
+		{name: "trim_space", udpxyName: " INNER ", want: "http://192.168.1.1:4022"},
+		{name: "not_found", udpxyName: "outer", want: "", wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := logs.Len()
+			if got := getUdpxyURL(tt.udpxyName); got != tt.want {
+				t.Errorf("getUdpxyURL(%q) = %q, want %q", tt.udpxyName, got, tt.want)
+			}
+			if warned := logs.Len() > before; warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestGetM3UDataEPGURL(t *testing.T) {
+	channels := newTestChannels(t)
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "default", query: "", want: "#EXTM3U url-tvg=\"http://iptv.lan:8080/epg.xml\"\n"},
+		{name: "custom", query: "?epgUrl=http%3A%2F%2Fepg.lan%2Fe.xml", want: "#EXTM3U url-tvg=\"http://epg.lan/e.xml\"\n"},
+		{name: "empty", query: "?epgUrl=", want: "#EXTM3U\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if body := w.Body.String(); !strings.HasPrefix(body, tt.want) {
+				t.Errorf("GetM3UData() =\n%s\nwant prefix:\n%s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetM3UDataCatchupDaysFromEPG(t *testing.T) {
+	catchupSources = map[string]string{"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"}
+	channels := newTestChannels(t)
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/2")
+	channels[1].TimeShift, channels[1].TimeShiftLength, channels[1].TimeShiftURL = "1", 72*time.Hour, timeShiftURL
+	defaultChannels := channelsPtr.Swap(&channels)
+	beginTime := time.Now().AddDate(0, 0, -1).Format("20060102") + "000000"
+	chProgLists := []iptv.ChannelProgramList{{
+		ChannelId:       channels[1].ChannelID,
+		DateProgramList: []iptv.DateProgram{{ProgramList: []iptv.Program{{BeginTimeFormat: beginTime}}}},
+	}}
+	defaultEPG := epgPtr.Swap(&chProgLists)
+	t.Cleanup(func() {
+		catchupSources = nil
+		catchupDaysFromEPG = false
+		channelsPtr.Store(defaultChannels)
+		epgPtr.Store(defaultEPG)
+	})
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		query   string
+		want    string
+	}{
+		{name: "disabled", want: `catchup-days="3"`},
+		{name: "enabled", enabled: true, want: `catchup-days="1"`},
+		{name: "query_enabled", query: "&catchupDaysFromEpg=true", want: `catchup-days="1"`},
+		{name: "query_disabled", enabled: true, query: "&catchupDaysFromEpg=false", want: `catchup-days="3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catchupDaysFromEPG = tt.enabled
+			req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u?multiFirst=false"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if body := w.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("GetM3UData() =\n%s\nwant contains: %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrerenderCatchupDaysFromEPG(t *testing.T) {
+	catchupSources = map[string]string{"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"}
+	prerenderFormats = []string{formatM3U}
+	catchupDaysFromEPG = true
+	channels := newTestChannels(t)
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/2")
+	channels[1].TimeShift, channels[1].TimeShiftLength, channels[1].TimeShiftURL = "1", 72*time.Hour, timeShiftURL
+	beginTime := time.Now().AddDate(0, 0, -1).Format("20060102") + "000000"
+	client := &fakeIPTVClient{
+		channels: channels,
+		chProgLists: []iptv.ChannelProgramList{{
+			ChannelId:       channels[1].ChannelID,
+			DateProgramList: []iptv.DateProgram{{ProgramList: []iptv.Program{{BeginTimeFormat: beginTime}}}},
+		}},
+	}
+	defaultChannels := channelsPtr.Load()
+	defaultEPG := epgPtr.Swap(nil)
+	t.Cleanup(func() {
+		catchupSources, prerenderFormats = nil, nil
+		catchupDaysFromEPG = false
+		prerenderedPtr.Store(nil)
+		channelsPtr.Store(defaultChannels)
+		epgPtr.Store(defaultEPG)
+	})
+
+	// 尚未获取到节目单时不限制
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+	if m3u := (*prerenderedPtr.Load())[formatM3U]; !strings.Contains(m3u, `catchup-days="3"`) {
+		t.Errorf("prerendered m3u =\n%s\nwant contains: catchup-days=\"3\"", m3u)
+	}
+
+	// 节目单更新后重新生成，与实时生成的结果保持一致
+	if err := updateEPG(context.Background(), client); err != nil {
+		t.Fatalf("updateEPG() error = %v", err)
+	}
+	if m3u := (*prerenderedPtr.Load())[formatM3U]; !strings.Contains(m3u, `catchup-days="1"`) {
+		t.Errorf("prerendered m3u =\n%s\nwant contains: catchup-days=\"1\"", m3u)
+	}
+}
+
+func TestUpdateEPGPrerenderCurrentChannels(t *testing.T) {
+	prerenderFormats = []string{formatM3U}
+	catchupDaysFromEPG = true
+	channels := newTestChannels(t)
+	client := &fakeIPTVClient{channels: channels[:1]}
+	defaultChannels := channelsPtr.Load()
+	defaultEPG := epgPtr.Swap(nil)
+	t.Cleanup(func() {
+		prerenderFormats = nil
+		catchupDaysFromEPG = false
+		prerenderedPtr.Store(nil)
+		channelsPtr.Store(defaultChannels)
+		epgPtr.Store(defaultEPG)
+	})
+
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+
+	// 获取节目单期间频道列表被刷新
+	client.onGetProgramList = func() {
+		if err := updateChannels(context.Background(), &fakeIPTVClient{channels: channels}); err != nil {
+			t.Errorf("updateChannels() error = %v", err)
+		}
+	}
+	if err := updateEPG(context.Background(), client); err != nil {
+		t.Fatalf("updateEPG() error = %v", err)
+	}
+	if m3u := (*prerenderedPtr.Load())[formatM3U]; !strings.Contains(m3u, ","+channels[1].ChannelName) {
+		t.Errorf("prerendered m3u =\n%s\nwant contains: %s", m3u, channels[1].ChannelName)
+	}
+}
+
+func TestGetM3UDataSort(t *testing.T) {
+	channels := newTestChannels(t)
+	channels[0].UserChannelID = "10"
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+
+	tests := []struct {
+		name  string
+		query string
+		first string
+	}{
+		{name: "default", query: "", first: "CCTV1"},
+		{name: "none", query: "&sort=none", first: "CCTV1"},
+		{name: "chno", query: "&sort=chno", first: "湖南卫视"},
+		{name: "name", query: "&sort=NAME", first: "CCTV1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/m3u?multiFirst=false"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			lines := strings.Split(w.Body.String(), "\n")
+			if len(lines) < 2 || !strings.HasSuffix(lines[1], ","+tt.first) {
+				t.Errorf("GetM3UData() =\n%s\nwant %s first", w.Body.String(), tt.first)
+			}
+		})
+	}
+}
+
+func TestGetTXTDataGroupRename(t *testing.T) {
+	channels := newTestChannels(t)
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/txt", GetTXTData)
+
+	query := url.Values{"rename": {"卫视:地方", "央视:", "invalid"}, "multiFirst": {"false"}}
+	req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "央视,#genre#") || !strings.Contains(body, "地方,#genre#") || strings.Contains(body, "卫视,#genre#") {
+		t.Errorf("GetTXTData() =\n%s\nwant group 卫视 renamed to 地方", body)
+	}
+	// 不修改缓存的频道分组
+	if (*channelsPtr.Load())[1].GroupName != "卫视" {
+		t.Errorf("cached GroupName = %q, want 卫视", (*channelsPtr.Load())[1].GroupName)
+	}
+}
+
+func TestGetTXTDataRTSPProxy(t *testing.T) {
+	channels := newTestChannels(t)
+	u3, _ := url.Parse("rtsp://10.0.0.1:554/live/3")
+	channels = append(channels, iptv.Channel{ChannelID: "3", ChannelName: "CCTV3", UserChannelID: "3", ChannelURLs: []url.URL{*u3}, GroupName: "央视"})
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/txt", GetTXTData)
+
+	for _, tt := range []struct {
+		rtspProxy string
+		want      string
+	}{
+		{rtspProxy: "http://192.168.1.1:5140", want: "CCTV3,http://192.168.1.1:5140/rtsp/10.0.0.1:554/live/3\n"},
+		{rtspProxy: "192.168.1.1:5140", want: "CCTV3,rtsp://10.0.0.1:554/live/3\n"},
+	} {
+		query := url.Values{"rtspProxy": {tt.rtspProxy}}
+		req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		if !strings.Contains(body, tt.want) || !strings.Contains(body, "igmp://239.1.1.1:5000") {
+			t.Errorf("GetTXTData(rtspProxy=%s) =\n%s\nwant %q", tt.rtspProxy, body, tt.want)
+		}
+	}
+	// 不修改缓存的频道地址
+	if got := (*channelsPtr.Load())[2].ChannelURLs[0].String(); got != "rtsp://10.0.0.1:554/live/3" {
+		t.Errorf("cached url = %q, want rtsp://10.0.0.1:554/live/3", got)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"br, deflate", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.acceptEncoding); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
+
+func TestGetTXTDataGzip(t *testing.T) {
+	channels := make([]iptv.Channel, 0, 50)
+	for i := 1; i <= 50; i++ {
+		u, _ := url.Parse(fmt.Sprintf("http://10.0.0.1/live/%d", i))
+		channels = append(channels, iptv.Channel{ChannelID: strconv.Itoa(i), ChannelName: fmt.Sprintf("CCTV%d", i), ChannelURLs: []url.URL{*u}, GroupName: "央视"})
+	}
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/txt", GetTXTData)
+
+	req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gzipReader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	body, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("io.ReadAll() error = %v", err)
+	}
+	if !strings.HasPrefix(string(body), "央视,#genre#\nCCTV1,http://10.0.0.1/live/1\n") {
+		t.Errorf("GetTXTData() =\n%s\nwant decompressed txt", body)
+	}
+
+	// 内容小于gzipMinSize时不压缩
+	small := channels[:1]
+	channelsPtr.Store(&small)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want empty for small content", got)
+	}
+	if !strings.HasPrefix(w.Body.String(), "央视,#genre#\n") {
+		t.Errorf("GetTXTData() = %q, want plain txt", w.Body.String())
+	}
+}
+
+func TestGetJSONData(t *testing.T) {
+	catchupSources = map[string]string{"0": "playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}"}
+	channels := newTestChannels(t)
+	timeShiftURL, _ := url.Parse("http://10.0.0.1/timeshift/2")
+	channels[1].TimeShift, channels[1].TimeShiftLength, channels[1].TimeShiftURL = "1", 48*time.Hour, timeShiftURL
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() {
+		catchupSources = nil
+		channelsPtr.Store(defaultChannels)
+	})
+
+	r := gin.New()
+	r.GET("/channel/json", GetJSONData)
+
+	req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080/channel/json?multiFirst=false", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var got []struct {
+		URL     string `json:"url"`
+		Catchup *struct {
+			Source string `json:"source"`
+			Days   int64  `json:"days"`
+		} `json:"catchup"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v\n%s", err, w.Body.String())
+	}
+	if len(got) != len(channels) {
+		t.Fatalf("len(channels) = %d, want %d", len(got), len(channels))
+	}
+	if got[1].Catchup == nil || got[1].Catchup.Days != 2 ||
+		got[1].Catchup.Source != "http://10.0.0.1/timeshift/2?playseek=${(b)yyyyMMddHHmmss}-${(e)yyyyMMddHHmmss}" {
+		t.Errorf("catchup = %+v", got[1].Catchup)
+	}
+	if got[0].Catchup != nil {
+		t.Errorf("catchup = %+v, want nil", got[0].Catchup)
+	}
+}
+
+func TestGetChannelDataGroupFilter(t *testing.T) {
+	channels := newTestChannels(t)
+	defaultChannels := channelsPtr.Swap(&channels)
+	t.Cleanup(func() { channelsPtr.Store(defaultChannels) })
+
+	r := gin.New()
+	r.GET("/channel/m3u", GetM3UData)
+	r.GET("/channel/txt", GetTXTData)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     []string
+		notWant  []string
+	}{
+		{name: "all", query: "", wantCode: http.StatusOK, want: []string{"CCTV1", "湖南卫视"}},
+		{name: "include", query: "?groups=%E5%A4%AE%E8%A7%86", wantCode: http.StatusOK, want: []string{"CCTV1"}, notWant: []string{"湖南卫视"}},
+		{name: "exclude", query: "?excludeGroups=%E5%A4%AE%E8%A7%86,%20", wantCode: http.StatusOK, want: []string{"湖南卫视"}, notWant: []string{"CCTV1"}},
+		{name: "none_left", query: "?groups=unknown", wantCode: http.StatusNotFound},
+	}
+
+	for _, path := range []string{"/channel/m3u", "/channel/txt"} {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080"+path+tt.query, nil)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+				}
+				body := w.Body.String()
+				for _, want := range tt.want {
+					if !strings.Contains(body, want) {
+						t.Errorf("body missing %q:\n%s", want, body)
+					}
+				}
+				for _, notWant := range tt.notWant {
+					if strings.Contains(body, notWant) {
+						t.Errorf("body unexpectedly contains %q:\n%s", notWant, body)
+					}
+				}
+			})
+		}
+	}
+}
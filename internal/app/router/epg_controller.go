@@ -1,14 +1,17 @@
 package router
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"iptv/internal/app/iptv"
 	"net/http"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,17 +20,30 @@ import (
 )
 
 const (
-	xmltvGenInfoName = "iptv-tool"
-	xmltvGenInfoUrl  = "https://github.com/super321/iptv-tool"
-
 	xmltvGzipFilename = "epg.xml.gz"
+
+	// 缓存的xmltv文件的最大数量，超出时清空后重新缓存
+	xmlEPGCacheMaxEntries = 16
 )
 
 var (
 	// 缓存最新的节目单数据
 	epgPtr atomic.Pointer[[]iptv.ChannelProgramList]
+
+	// 缓存生成的xmltv文件，节目单更新后失效
+	xmlEPGCacheMu sync.Mutex
+	// 生成缓存的xmltv文件时使用的节目单，与epgPtr不一致时缓存失效
+	xmlEPGCacheSrc *[]iptv.ChannelProgramList
+	xmlEPGCache    map[xmlEPGCacheKey][]byte
 )
 
+// xmlEPGCacheKey 缓存的xmltv文件的键，台标地址与请求的Host相关
+type xmlEPGCacheKey struct {
+	backDays int
+	host     string
+	gzip     bool
+}
+
 // ChannelDateJsonEPG 频道的JSON格式EPG
 type ChannelDateJsonEPG struct {
 	ChannelName string    `json:"channel_name"`
@@ -118,65 +134,158 @@ func GetJsonEPG(c *gin.Context) {
 	})
 }
 
-// XmlEPG XMLTV格式的EPG
-type XmlEPG struct {
-	XMLName           xml.Name          `xml:"tv"`
-	SourceInfoUrl     string            `xml:"source-info-url,attr,omitempty"`
-	SourceInfoName    string            `xml:"source-info-name,attr,omitempty"`
-	SourceDataUrl     string            `xml:"source-data-url,attr,omitempty"`
-	GeneratorInfoName string            `xml:"generator-info-name,attr,omitempty"`
-	GeneratorInfoUrl  string            `xml:"generator-info-url,attr,omitempty"`
-	Channels          []XmlEPGChannel   `xml:"channel,omitempty"`
-	Programmes        []XmlEPGProgramme `xml:"programme,omitempty"`
+// GetXmlEPG 返回XMLTV格式的EPG
+func GetXmlEPG(c *gin.Context) {
+	c.XML(http.StatusOK, getXmlEPG(c))
 }
 
-type XmlEPGChannel struct {
-	Id          string         `xml:"id,attr"`
-	DisplayName *XmlEPGDisplay `xml:"display-name"`
-}
+func GetXmlEPGWithGzip(c *gin.Context) {
+	xmlEPG := getXmlEPG(c)
+
+	// 将结构体数据转换为XML，并进行格式化
+	xmlData, err := xml.MarshalIndent(xmlEPG, "", "  ")
+	if err != nil {
+		logger.Error("Failed to marshal xml.", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
 
-type XmlEPGProgramme struct {
-	Start   string         `xml:"start,attr"`
-	Stop    string         `xml:"stop,attr"`
-	Channel string         `xml:"channel,attr"`
-	Title   *XmlEPGDisplay `xml:"title"`
-	Desc    *XmlEPGDisplay `xml:"desc,omitempty"`
+	// 设置HTTP头，通知浏览器这是一个二进制流文件
+	c.Header("Transfer-Encoding", "gzip")                                                      // 说明文件是gzip压缩格式
+	c.Header("Content-Type", "application/octet-stream")                                       // 说明是二进制文件
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", xmltvGzipFilename)) // 指定下载文件名
+
+	// 创建一个gzip压缩的Writer，并将XML数据写入其中
+	gzipWriter := gzip.NewWriter(c.Writer)
+	defer gzipWriter.Close()
+
+	// 写入xml头
+	if _, err = gzipWriter.Write([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")); err != nil {
+		logger.Error("Failed to write xml header.", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// 写入xml内容
+	if _, err = gzipWriter.Write(xmlData); err != nil {
+		logger.Error("Failed to write xml data.", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
 }
 
-type XmlEPGDisplay struct {
-	Lang  string `xml:"lang,attr"`
-	Value string `xml:",chardata"`
+// GetXmlEPGFile 返回XMLTV格式的EPG文件，节目单更新前重复请求直接返回缓存的内容
+func GetXmlEPGFile(c *gin.Context) {
+	serveXmlEPGFile(c, false)
 }
 
-// GetXmlEPG 返回XMLTV格式的EPG
-func GetXmlEPG(c *gin.Context) {
-	var err error
+// GetXmlEPGFileWithGzip 返回gzip压缩的XMLTV格式的EPG文件，节目单更新前重复请求直接返回缓存的内容
+func GetXmlEPGFileWithGzip(c *gin.Context) {
+	serveXmlEPGFile(c, true)
+}
 
+// serveXmlEPGFile 根据请求参数backDays，返回缓存的xmltv文件，缓存不存在时重新生成
+func serveXmlEPGFile(c *gin.Context, withGzip bool) {
 	// 保留过去几天的节目单
-	backDay := 0
-	backDayStr := c.Query("backDay")
-	if backDayStr != "" {
-		if backDay, err = strconv.Atoi(backDayStr); err != nil {
-			backDay = 0
+	backDays, err := strconv.Atoi(c.DefaultQuery("backDays", "0"))
+	if err != nil || backDays < 0 {
+		backDays = 0
+	}
+
+	epgListPtr := epgPtr.Load()
+	key := xmlEPGCacheKey{backDays: backDays, host: c.Request.Host, gzip: withGzip}
+	data, ok := getCachedXmlEPG(epgListPtr, key)
+	if !ok {
+		if data, err = marshalXmlEPG(epgListPtr, backDays, c.Request.Host, withGzip); err != nil {
+			logger.Error("Failed to marshal xml.", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
 		}
+		setCachedXmlEPG(epgListPtr, key, data)
 	}
 
-	// 如果缓存的节目单列表为空则直接返回空数据
-	chProgLists := *epgPtr.Load()
-	if len(chProgLists) == 0 {
-		c.XML(http.StatusOK, &XmlEPG{
-			GeneratorInfoName: xmltvGenInfoName,
-			GeneratorInfoUrl:  xmltvGenInfoUrl,
-		})
+	if withGzip {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", xmltvGzipFilename)) // 指定下载文件名
+		c.Data(http.StatusOK, "application/gzip", data)
 		return
 	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", data)
+}
 
-	xmlEPG := getXmlEPG(chProgLists, backDay)
+// marshalXmlEPG 将节目单转为xmltv文件的内容，withGzip为true时进行gzip压缩
+func marshalXmlEPG(epgListPtr *[]iptv.ChannelProgramList, backDays int, host string, withGzip bool) ([]byte, error) {
+	var chProgLists []iptv.ChannelProgramList
+	if epgListPtr != nil {
+		chProgLists = *epgListPtr
+	}
+	// 与直播源使用相同的台标地址
+	xmlEPG := iptv.GetXmlEPGData(chProgLists, backDays, iptv.XmlEPGOptions{
+		Location:        xmltvLocation,
+		LogoBaseURL:     getLogoBaseUrl(host),
+		LogoDir:         logoDir,
+		LogoPlaceholder: logoPlaceholder,
+	})
+	xmlData, err := xml.MarshalIndent(xmlEPG, "", "  ")
+	if err != nil {
+		return nil, err
+	}
 
-	c.XML(http.StatusOK, xmlEPG)
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gzipWriter *gzip.Writer
+	if withGzip {
+		gzipWriter = gzip.NewWriter(&buf)
+		w = gzipWriter
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(xmlData); err != nil {
+		return nil, err
+	}
+	if gzipWriter != nil {
+		if err = gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
 }
 
-func GetXmlEPGWithGzip(c *gin.Context) {
+// getCachedXmlEPG 获取根据指定节目单生成的xmltv文件缓存
+func getCachedXmlEPG(epgListPtr *[]iptv.ChannelProgramList, key xmlEPGCacheKey) ([]byte, bool) {
+	xmlEPGCacheMu.Lock()
+	defer xmlEPGCacheMu.Unlock()
+	if xmlEPGCacheSrc != epgListPtr {
+		return nil, false
+	}
+	data, ok := xmlEPGCache[key]
+	return data, ok
+}
+
+// setCachedXmlEPG 缓存根据指定节目单生成的xmltv文件，节目单已更新时清空旧的缓存
+func setCachedXmlEPG(epgListPtr *[]iptv.ChannelProgramList, key xmlEPGCacheKey, data []byte) {
+	xmlEPGCacheMu.Lock()
+	defer xmlEPGCacheMu.Unlock()
+	// 生成期间节目单已再次更新时，不缓存过期的内容
+	if epgListPtr != epgPtr.Load() {
+		return
+	}
+	if xmlEPGCacheSrc != epgListPtr || len(xmlEPGCache) >= xmlEPGCacheMaxEntries {
+		xmlEPGCacheSrc = epgListPtr
+		xmlEPGCache = make(map[xmlEPGCacheKey][]byte)
+	}
+	xmlEPGCache[key] = data
+}
+
+// resetXmlEPGCache 清空缓存的xmltv文件
+func resetXmlEPGCache() {
+	xmlEPGCacheMu.Lock()
+	defer xmlEPGCacheMu.Unlock()
+	xmlEPGCacheSrc, xmlEPGCache = nil, nil
+}
+
+// getXmlEPG 根据请求参数，将缓存的节目单转为xmltv格式
+func getXmlEPG(c *gin.Context) *iptv.XmlEPG {
 	var err error
 
 	// 保留过去几天的节目单
@@ -188,97 +297,129 @@ func GetXmlEPGWithGzip(c *gin.Context) {
 		}
 	}
 
-	var xmlEPG *XmlEPG
-	// 如果缓存的节目单列表为空则直接返回空数据
-	chProgLists := *epgPtr.Load()
-	if len(chProgLists) == 0 {
-		xmlEPG = &XmlEPG{
-			GeneratorInfoName: xmltvGenInfoName,
-			GeneratorInfoUrl:  xmltvGenInfoUrl,
-		}
-	} else {
-		xmlEPG = getXmlEPG(chProgLists, backDay)
+	// 是否跳过没有节目的频道
+	skipEmpty, err := strconv.ParseBool(c.DefaultQuery("skipEmpty", "false"))
+	if err != nil {
+		skipEmpty = false
 	}
 
-	// 将结构体数据转换为XML，并进行格式化
-	xmlData, err := xml.MarshalIndent(xmlEPG, "", "  ")
+	// 是否为每个节目输出唯一的id
+	withProgId, err := strconv.ParseBool(c.DefaultQuery("progId", "false"))
 	if err != nil {
-		logger.Error("Failed to marshal xml.", zap.Error(err))
-		c.Status(http.StatusInternalServerError)
-		return
+		withProgId = false
 	}
 
-	// 设置HTTP头，通知浏览器这是一个二进制流文件
-	c.Header("Transfer-Encoding", "gzip")                                                      // 说明文件是gzip压缩格式
-	c.Header("Content-Type", "application/octet-stream")                                       // 说明是二进制文件
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", xmltvGzipFilename)) // 指定下载文件名
-
-	// 创建一个gzip压缩的Writer，并将XML数据写入其中
-	gzipWriter := gzip.NewWriter(c.Writer)
-	defer gzipWriter.Close()
+	// 如果缓存的节目单列表为空则直接返回空数据
+	var chProgLists []iptv.ChannelProgramList
+	if epgListPtr := epgPtr.Load(); epgListPtr != nil {
+		chProgLists = *epgListPtr
+	}
+	opts := iptv.XmlEPGOptions{
+		SkipEmpty:  skipEmpty,
+		Location:   xmltvLocation,
+		WithProgID: withProgId,
+		// 与直播源使用相同的台标地址
+		LogoBaseURL:     getLogoBaseUrl(c.Request.Host),
+		LogoDir:         logoDir,
+		LogoPlaceholder: logoPlaceholder,
+	}
+	xmlEPG := iptv.GetXmlEPGData(chProgLists, backDay, opts)
 
-	// 写入xml头
-	if _, err = gzipWriter.Write([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")); err != nil {
-		logger.Error("Failed to write xml header.", zap.Error(err))
-		c.Status(http.StatusInternalServerError)
-		return
+	// 按频道数量分页，page从1开始
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "0"))
+	if err != nil || pageSize <= 0 {
+		return xmlEPG
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	parts := iptv.SplitXmlEPG(xmlEPG, pageSize)
+	c.Header("X-Total-Pages", strconv.Itoa(len(parts)))
+	if page > len(parts) {
+		// 超出范围时返回空数据
+		return iptv.GetXmlEPGData(nil, backDay, opts)
 	}
+	return parts[page-1]
+}
 
-	// 写入xml内容
-	if _, err = gzipWriter.Write(xmlData); err != nil {
-		logger.Error("Failed to write xml data.", zap.Error(err))
-		c.Status(http.StatusInternalServerError)
-		return
+// EPGStats 节目单的覆盖情况统计
+type EPGStats struct {
+	Channels    int       `json:"channels"`    // 频道总数
+	EPGChannels int       `json:"epgChannels"` // 有节目单的频道数
+	Programs    int       `json:"programs"`    // 节目总数
+	Earliest    time.Time `json:"earliest"`    // 最早的节目开始时间
+	Latest      time.Time `json:"latest"`      // 最晚的节目结束时间
+	GapChannels []string  `json:"gapChannels"` // 节目单存在空档的频道
+}
+
+// GetEPGStats 查询节目单的覆盖情况统计
+func GetEPGStats(c *gin.Context) {
+	var channels []iptv.Channel
+	if chPtr := channelsPtr.Load(); chPtr != nil {
+		channels = *chPtr
 	}
+	var chProgLists []iptv.ChannelProgramList
+	if epgListPtr := epgPtr.Load(); epgListPtr != nil {
+		chProgLists = *epgListPtr
+	}
+
+	// 返回响应
+	c.PureJSON(http.StatusOK, getEPGStats(channels, chProgLists, xmltvLocation))
 }
 
-// getXmlEPG 将频道节目单转为xmltv格式
-func getXmlEPG(chProgLists []iptv.ChannelProgramList, backDay int) *XmlEPG {
-	backTime := time.Now().AddDate(0, 0, -backDay)
-	backTime = time.Date(backTime.Year(), backTime.Month(), backTime.Day(), 0, 0, 0, 0, backTime.Location())
+// getEPGStats 统计节目单的覆盖情况，loc为节目时间所在的时区，为空时使用DefaultXmltvLocation
+func getEPGStats(channels []iptv.Channel, chProgLists []iptv.ChannelProgramList, loc *time.Location) *EPGStats {
+	if loc == nil {
+		loc = iptv.DefaultXmltvLocation
+	}
+	stats := EPGStats{
+		Channels:    len(channels),
+		GapChannels: make([]string, 0),
+	}
 
-	channels := make([]XmlEPGChannel, 0, len(chProgLists))
-	programmes := make([]XmlEPGProgramme, 0)
 	for _, chProgList := range chProgLists {
-		// 获取频道的相关信息
-		channels = append(channels, XmlEPGChannel{
-			Id: chProgList.ChannelId,
-			DisplayName: &XmlEPGDisplay{
-				Lang:  "zh",
-				Value: chProgList.ChannelName,
-			},
-		})
-
-		if len(chProgList.DateProgramList) == 0 {
-			continue
-		}
-
+		var chPrograms int
+		var hasGap bool
+		var prevEndTime time.Time
 		for _, dateProgList := range chProgList.DateProgramList {
-			if len(dateProgList.ProgramList) == 0 ||
-				(backDay > 0 && !backTime.Before(dateProgList.Date)) {
-				continue
-			}
 			for _, program := range dateProgList.ProgramList {
-				// 获取节目的相关信息
-				programmes = append(programmes, XmlEPGProgramme{
-					Start:   program.BeginTimeFormat + " +0800",
-					Stop:    program.EndTimeFormat + " +0800",
-					Channel: chProgList.ChannelId,
-					Title: &XmlEPGDisplay{
-						Lang:  "zh",
-						Value: program.ProgramName,
-					},
-				})
+				beginTime, err := time.ParseInLocation("20060102150405", program.BeginTimeFormat, loc)
+				if err != nil {
+					continue
+				}
+				endTime, err := time.ParseInLocation("20060102150405", program.EndTimeFormat, loc)
+				if err != nil {
+					continue
+				}
+				chPrograms++
+
+				// 记录最早和最晚的节目时间
+				if stats.Earliest.IsZero() || beginTime.Before(stats.Earliest) {
+					stats.Earliest = beginTime
+				}
+				if endTime.After(stats.Latest) {
+					stats.Latest = endTime
+				}
+
+				// 与上一个节目之间存在空档
+				if !prevEndTime.IsZero() && beginTime.After(prevEndTime) {
+					hasGap = true
+				}
+				prevEndTime = endTime
 			}
 		}
-	}
 
-	return &XmlEPG{
-		GeneratorInfoName: xmltvGenInfoName,
-		GeneratorInfoUrl:  xmltvGenInfoUrl,
-		Channels:          channels,
-		Programmes:        programmes,
+		if chPrograms == 0 {
+			continue
+		}
+		stats.EPGChannels++
+		stats.Programs += chPrograms
+		if hasGap {
+			stats.GapChannels = append(stats.GapChannels, chProgList.ChannelName)
+		}
 	}
+	return &stats
 }
 
 // updateEPG 更新缓存的节目单数据
@@ -295,9 +436,28 @@ func updateEPG(ctx context.Context, iptvClient iptv.Client) error {
 		return err
 	}
 
+	// 与频道列表保持一致的tvg-id及台标
+	iptv.SetProgramListTvgID(allChProgramList, channels)
+	iptv.SetProgramListLogoName(allChProgramList, channels)
+
 	logger.Sugar().Infof("EPG data updated, total: %d.", len(allChProgramList))
 	// 更新缓存的频道列表
 	epgPtr.Store(&allChProgramList)
+	// 节目单已更新，清空缓存的xmltv文件
+	resetXmlEPGCache()
+	// 按节目单限制catchup-days时，重新生成预先缓存的直播源内容
+	// 节目单更新期间频道列表可能已被刷新，使用当前缓存的频道列表，避免覆盖新的预生成内容
+	if catchupDaysFromEPG {
+		channelsMu.Lock()
+		prerenderChannels(*channelsPtr.Load())
+		channelsMu.Unlock()
+	}
+
+	// 输出节目单的覆盖情况
+	stats := getEPGStats(channels, allChProgramList, xmltvLocation)
+	logger.Info("EPG coverage statistics.", zap.Int("channels", stats.Channels), zap.Int("epgChannels", stats.EPGChannels),
+		zap.Int("programs", stats.Programs), zap.Time("earliest", stats.Earliest), zap.Time("latest", stats.Latest),
+		zap.Strings("gapChannels", stats.GapChannels))
 
 	return nil
 }
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"compress/gzip"
+	"io"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetEPGStats(t *testing.T) {
+	date := time.Date(2024, 11, 22, 0, 0, 0, 0, time.Local)
+	channels := []iptv.Channel{
+		{ChannelID: "1", ChannelName: "CCTV1"},
+		{ChannelID: "2", ChannelName: "CCTV2"},
+		{ChannelID: "3", ChannelName: "CCTV3"},
+	}
+	chProgLists := []iptv.ChannelProgramList{
+		{
+			ChannelId:   "1",
+			ChannelName: "CCTV1",
+			DateProgramList: []iptv.DateProgram{
+				{
+					Date: date,
+					ProgramList: []iptv.Program{
+						{ProgramName: "新闻", BeginTimeFormat: "20241122060000", EndTimeFormat: "20241122070000"},
+						{ProgramName: "天气", BeginTimeFormat: "20241122070000", EndTimeFormat: "20241122080000"},
+					},
+				},
+			},
+		},
+		{
+			ChannelId:   "2",
+			ChannelName: "CCTV2",
+			DateProgramList: []iptv.DateProgram{
+				{
+					Date: date,
+					ProgramList: []iptv.Program{
+						{ProgramName: "财经", BeginTimeFormat: "20241122050000", EndTimeFormat: "20241122060000"},
+						{ProgramName: "购物", BeginTimeFormat: "20241122090000", EndTimeFormat: "20241122100000"},
+					},
+				},
+				{
+					Date: date.AddDate(0, 0, 1),
+					ProgramList: []iptv.Program{
+						{ProgramName: "财经", BeginTimeFormat: "20241123000000", EndTimeFormat: "20241123010000"},
+					},
+				},
+			},
+		},
+		{
+			ChannelId:       "3",
+			ChannelName:     "CCTV3",
+			DateProgramList: []iptv.DateProgram{{Date: date}},
+		},
+	}
+
+	// 节目时间按节目单所在的时区解析，与运行环境的时区无关
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	stats := getEPGStats(channels, chProgLists, loc)
+	if stats.Channels != 3 {
+		t.Errorf("Channels = %d, want 3", stats.Channels)
+	}
+	if stats.EPGChannels != 2 {
+		t.Errorf("EPGChannels = %d, want 2", stats.EPGChannels)
+	}
+	if stats.Programs != 5 {
+		t.Errorf("Programs = %d, want 5", stats.Programs)
+	}
+	if want := time.Date(2024, 11, 22, 5, 0, 0, 0, loc); !stats.Earliest.Equal(want) {
+		t.Errorf("Earliest = %v, want %v", stats.Earliest, want)
+	}
+	if want := time.Date(2024, 11, 23, 1, 0, 0, 0, loc); !stats.Latest.Equal(want) {
+		t.Errorf("Latest = %v, want %v", stats.Latest, want)
+	}
+	if !slices.Equal(stats.GapChannels, []string{"CCTV2"}) {
+		t.Errorf("GapChannels = %v, want [CCTV2]", stats.GapChannels)
+	}
+}
+
+func TestGetEPGStatsEmpty(t *testing.T) {
+	stats := getEPGStats(nil, nil, nil)
+	if stats.Channels != 0 || stats.EPGChannels != 0 || stats.Programs != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if !stats.Earliest.IsZero() || !stats.Latest.IsZero() {
+		t.Errorf("expected zero times, got %v - %v", stats.Earliest, stats.Latest)
+	}
+	if stats.GapChannels == nil {
+		t.Error("GapChannels should be an empty slice, not nil")
+	}
+}
+
+func TestGetXmlEPGFile(t *testing.T) {
+	newProgLists := func(name string) *[]iptv.ChannelProgramList {
+		return &[]iptv.ChannelProgramList{{ChannelId: "1", ChannelName: name}}
+	}
+	defaultEPG := epgPtr.Swap(newProgLists("CCTV1"))
+	t.Cleanup(func() {
+		epgPtr.Store(defaultEPG)
+		resetXmlEPGCache()
+	})
+
+	r := gin.New()
+	r.GET("/epg.xml", GetXmlEPGFile)
+	r.GET("/epg.xml.gz", GetXmlEPGFileWithGzip)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://iptv.lan:8080"+path, nil))
+		return w
+	}
+
+	body := get("/epg.xml?backDays=1").Body.String()
+	if !strings.HasPrefix(body, "<?xml") || !strings.Contains(body, "CCTV1") {
+		t.Fatalf("GetXmlEPGFile() =\n%s\nwant xmltv of CCTV1", body)
+	}
+	if _, ok := getCachedXmlEPG(epgPtr.Load(), xmlEPGCacheKey{backDays: 1, host: "iptv.lan:8080"}); !ok {
+		t.Error("xmltv should be cached")
+	}
+
+	// 节目单更新后缓存失效
+	epgPtr.Store(newProgLists("CCTV2"))
+	if body = get("/epg.xml?backDays=1").Body.String(); !strings.Contains(body, "CCTV2") {
+		t.Errorf("GetXmlEPGFile() =\n%s\nwant xmltv of CCTV2 after update", body)
+	}
+
+	w := get("/epg.xml.gz")
+	gzipReader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("io.ReadAll() error = %v", err)
+	}
+	if !strings.HasPrefix(string(data), "<?xml") || !strings.Contains(string(data), "CCTV2") {
+		t.Errorf("GetXmlEPGFileWithGzip() =\n%s\nwant xmltv of CCTV2", data)
+	}
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelsUpdatedAt 最近一次成功更新频道列表的时间
+var channelsUpdatedAt atomic.Pointer[time.Time]
+
+// healthStatus 服务的健康状态
+type healthStatus struct {
+	Channels    int    `json:"channels"`             // 缓存的频道数量
+	LastUpdate  string `json:"lastUpdate,omitempty"` // 最近一次成功更新频道列表的时间（RFC3339格式）
+	EPGChannels int    `json:"epgChannels"`          // 缓存的节目单的频道数量
+}
+
+// GetHealth 查询服务的健康状态，供反向代理等检查频道缓存是否可用
+// 频道列表为空时返回503
+func GetHealth(c *gin.Context) {
+	var status healthStatus
+	if channels := channelsPtr.Load(); channels != nil {
+		status.Channels = len(*channels)
+	}
+	if updatedAt := channelsUpdatedAt.Load(); updatedAt != nil {
+		status.LastUpdate = updatedAt.Format(time.RFC3339)
+	}
+	if epgList := epgPtr.Load(); epgList != nil {
+		status.EPGChannels = len(*epgList)
+	}
+
+	code := http.StatusOK
+	if status.Channels == 0 {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, status)
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetHealth(t *testing.T) {
+	defaultChannels := channelsPtr.Swap(nil)
+	defaultUpdatedAt := channelsUpdatedAt.Swap(nil)
+	t.Cleanup(func() {
+		channelsPtr.Store(defaultChannels)
+		channelsUpdatedAt.Store(defaultUpdatedAt)
+	})
+
+	r := gin.New()
+	r.GET("/healthz", GetHealth)
+	getHealth := func() (int, healthStatus) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var status healthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Unmarshal() error = %v\n%s", err, w.Body.String())
+		}
+		return w.Code, status
+	}
+
+	// 频道列表尚未加载
+	if code, status := getHealth(); code != http.StatusServiceUnavailable || status.Channels != 0 || status.LastUpdate != "" {
+		t.Errorf("GetHealth() = %d %+v, want 503 without channels", code, status)
+	}
+
+	client := &fakeIPTVClient{channels: newTestChannels(t)}
+	if err := updateChannels(context.Background(), client); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+
+	code, status := getHealth()
+	if code != http.StatusOK || status.Channels != 2 {
+		t.Errorf("GetHealth() = %d %+v, want 200 with 2 channels", code, status)
+	}
+	if _, err := time.Parse(time.RFC3339, status.LastUpdate); err != nil {
+		t.Errorf("lastUpdate = %q, want RFC3339 time", status.LastUpdate)
+	}
+}
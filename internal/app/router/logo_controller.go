@@ -0,0 +1,74 @@
+package router
+
+import (
+	"iptv/internal/app/iptv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// logoFileExt 台标文件的扩展名
+const logoFileExt = ".png"
+
+// logoPlaceholderCache 已生成的占位台标，台标名称与PNG内容的映射，频道列表更新时清空
+var logoPlaceholderCache sync.Map
+
+// GetLogo 查询频道台标，台标文件存在时直接返回，否则为对应的频道生成占位台标
+// 仅为当前频道列表中的台标名称生成占位台标，其他名称返回404
+func GetLogo(c *gin.Context) {
+	fileName := c.Param("name")
+	logoName, ok := strings.CutSuffix(fileName, logoFileExt)
+	if !ok || logoName == "" || filepath.Base(fileName) != fileName {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	filePath := filepath.Join(logoDir, fileName)
+	if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+		c.File(filePath)
+		return
+	}
+
+	content, err := getLogoPlaceholder(logoName)
+	if err != nil {
+		logger.Error("Failed to generate the logo placeholder.", zap.String("logoName", logoName), zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if content == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Data(http.StatusOK, "image/png", content)
+}
+
+// getLogoPlaceholder 获取台标名称对应频道的占位台标，频道不存在时返回nil
+func getLogoPlaceholder(logoName string) ([]byte, error) {
+	if content, ok := logoPlaceholderCache.Load(logoName); ok {
+		return content.([]byte), nil
+	}
+
+	channels := channelsPtr.Load()
+	if channels == nil {
+		return nil, nil
+	}
+	idx := slices.IndexFunc(*channels, func(channel iptv.Channel) bool {
+		return channel.LogoName == logoName
+	})
+	if idx < 0 {
+		return nil, nil
+	}
+
+	content, err := iptv.GenerateLogoPlaceholder(&(*channels)[idx])
+	if err != nil {
+		return nil, err
+	}
+	logoPlaceholderCache.Store(logoName, content)
+	return content, nil
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetLogo(t *testing.T) {
+	channels := newTestChannels(t)
+	channels[0].LogoName = "CCTV1"
+	channels[1].LogoName = "HunanTV"
+	defaultChannels := channelsPtr.Swap(&channels)
+	defaultLogoDir := logoDir
+	logoDir = t.TempDir()
+	t.Cleanup(func() {
+		channelsPtr.Store(defaultChannels)
+		logoDir = defaultLogoDir
+		logoPlaceholderCache.Clear()
+	})
+	if err := os.WriteFile(filepath.Join(logoDir, "CCTV1.png"), []byte("logo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/logo/:name", GetLogo)
+	getLogo := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logo/"+name, nil))
+		return w
+	}
+
+	// 台标文件存在时直接返回
+	if w := getLogo("CCTV1.png"); w.Code != http.StatusOK || w.Body.String() != "logo" {
+		t.Errorf("GetLogo(CCTV1.png) = %d %q, want the logo file", w.Code, w.Body.String())
+	}
+
+	// 台标文件不存在时生成占位台标，并缓存在内存中
+	w := getLogo("HunanTV.png")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetLogo(HunanTV.png) status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, err := png.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+		t.Errorf("GetLogo(HunanTV.png) is not a png: %v", err)
+	}
+	if _, ok := logoPlaceholderCache.Load("HunanTV"); !ok {
+		t.Error("placeholder of HunanTV not cached")
+	}
+
+	// 频道列表更新后清空缓存的占位台标
+	if err := updateChannels(context.Background(), &fakeIPTVClient{channels: channels}); err != nil {
+		t.Fatalf("updateChannels() error = %v", err)
+	}
+	if _, ok := logoPlaceholderCache.Load("HunanTV"); ok {
+		t.Error("placeholder of HunanTV not cleared after the channel list was updated")
+	}
+
+	// 不属于任何频道的台标名称返回404
+	for _, name := range []string{"Unknown.png", "HunanTV.jpg", ".png"} {
+		if w := getLogo(name); w.Code != http.StatusNotFound {
+			t.Errorf("GetLogo(%s) status = %d, want %d", name, w.Code, http.StatusNotFound)
+		}
+	}
+}
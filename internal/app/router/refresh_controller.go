@@ -0,0 +1,74 @@
+package router
+
+import (
+	"context"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	// 手动刷新频道列表使用的IPTV客户端
+	refreshClient iptv.Client
+	// 正在进行的手动刷新，并发的刷新请求等待同一次刷新的结果
+	refreshCall *channelRefreshCall
+	refreshMu   sync.Mutex
+)
+
+// channelRefreshCall 一次正在进行或已完成的频道列表刷新
+type channelRefreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// refreshResult 手动刷新频道列表的结果
+type refreshResult struct {
+	Channels int    `json:"channels"`        // 刷新后的频道数量
+	Error    string `json:"error,omitempty"` // 刷新失败时的错误信息
+}
+
+// PostRefresh 立即刷新频道列表，返回刷新后的频道数量
+// 已有刷新正在进行时，等待该次刷新完成并返回其结果，不会重复请求上游
+func PostRefresh(c *gin.Context) {
+	// 客户端断开连接时不取消刷新，其他等待的请求仍需要刷新结果
+	err := refreshChannelsOnce(context.WithoutCancel(c.Request.Context()))
+
+	var result refreshResult
+	if channels := channelsPtr.Load(); channels != nil {
+		result.Channels = len(*channels)
+	}
+	if err != nil {
+		logger.Error("Failed to refresh channel list.", zap.Error(err))
+		result.Error = err.Error()
+		c.JSON(http.StatusInternalServerError, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// refreshChannelsOnce 刷新频道列表，并发调用时仅执行一次刷新
+func refreshChannelsOnce(ctx context.Context) error {
+	refreshMu.Lock()
+	if call := refreshCall; call != nil {
+		refreshMu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &channelRefreshCall{done: make(chan struct{})}
+	refreshCall = call
+	refreshMu.Unlock()
+
+	call.err = checkPortalReachable(ctx)
+	if call.err == nil {
+		call.err = updateChannelsWithRetry(ctx, refreshClient, 3)
+	}
+
+	refreshMu.Lock()
+	refreshCall = nil
+	refreshMu.Unlock()
+	close(call.done)
+	return call.err
+}
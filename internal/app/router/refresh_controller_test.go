@@ -0,0 +1,102 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"iptv/internal/app/iptv"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockingIPTVClient 获取频道列表时阻塞，直到release关闭
+type blockingIPTVClient struct {
+	*fakeIPTVClient
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingIPTVClient) GetAllChannelList(ctx context.Context) ([]iptv.Channel, error) {
+	if b.calls.Add(1) == 1 {
+		close(b.started)
+	}
+	<-b.release
+	return b.fakeIPTVClient.GetAllChannelList(ctx)
+}
+
+func TestPostRefresh(t *testing.T) {
+	// 在synctest中运行，以便等待并发的请求全部阻塞在正在进行的刷新上
+	synctest.Test(t, testPostRefresh)
+}
+
+func testPostRefresh(t *testing.T) {
+	client := &blockingIPTVClient{
+		fakeIPTVClient: &fakeIPTVClient{channels: newTestChannels(t)},
+		started:        make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	defaultChannels := channelsPtr.Swap(nil)
+	refreshClient = client
+	t.Cleanup(func() {
+		channelsPtr.Store(defaultChannels)
+		refreshClient = nil
+	})
+
+	r := gin.New()
+	r.POST("/refresh", PostRefresh)
+	postRefresh := func() (int, refreshResult) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+		var result refreshResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Errorf("Unmarshal() error = %v\n%s", err, w.Body.String())
+		}
+		return w.Code, result
+	}
+
+	// 并发的刷新请求等待同一次刷新，仅请求一次上游
+	const callers = 3
+	var wg sync.WaitGroup
+	codes := make([]int, callers)
+	results := make([]refreshResult, callers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes[0], results[0] = postRefresh()
+	}()
+	<-client.started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], results[i] = postRefresh()
+		}()
+	}
+	// 等待其他请求加入正在进行的刷新
+	synctest.Wait()
+	close(client.release)
+	wg.Wait()
+
+	if calls := client.calls.Load(); calls != 1 {
+		t.Errorf("GetAllChannelList() calls = %d, want 1", calls)
+	}
+	for i := range callers {
+		if codes[i] != http.StatusOK || results[i].Channels != 2 || results[i].Error != "" {
+			t.Errorf("PostRefresh() #%d = %d %+v, want 200 with 2 channels", i, codes[i], results[i])
+		}
+	}
+
+	// 刷新完成后再次请求会重新刷新
+	if code, result := postRefresh(); code != http.StatusOK || result.Channels != 2 {
+		t.Errorf("PostRefresh() = %d %+v, want 200 with 2 channels", code, result)
+	}
+	if calls := client.calls.Load(); calls != 2 {
+		t.Errorf("GetAllChannelList() calls = %d, want 2", calls)
+	}
+}
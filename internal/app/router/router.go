@@ -2,12 +2,10 @@ package router
 
 import (
 	"context"
+	"fmt"
 	"iptv/internal/app/config"
 	"iptv/internal/app/iptv"
-	"iptv/internal/app/iptv/hwctc"
-	"iptv/internal/pkg/util"
-	"net/http"
-	"path"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -20,21 +18,59 @@ import (
 var (
 	logger *zap.Logger
 
-	udpxyURLs      map[string]string
-	catchupSources map[string]string
+	udpxyURLs           map[string]string
+	catchupSources      map[string]string
+	catchupDefault      string
+	catchupLiveFallback bool
+	uaPresets           []config.UserAgentPreset
+	chDRMMap            map[string]iptv.ChannelDRM
+
+	chDefaultLocale  iptv.ChannelLocale
+	chGroupLocaleMap map[string]iptv.ChannelLocale
+
+	chDefaultGroup       string
+	chGroupOrder         []string
+	chGroupUnlisted      string
+	chURLScheme          string
+	chRenumberDuplicates bool
+	chDedup              bool
+	chLogoSanitize       bool
+	logoBaseURL          string
+	logoDir              string
+	logoPlaceholder      bool
+	logoFields           []string
+	tvgIDField           string
+	extInfDuration       int
+	maxCatchupDays       int
+	catchupDaysFromEPG   bool
+	m3uStrict            bool
+	multicastRelayPath   string
+	trailingNewline      = true
+	xmltvLocation        *time.Location
+
+	precheck   bool
+	serverHost string
+
+	retryEmptyChannels = true
 )
 
-func NewEngine(ctx context.Context, conf *config.Config, interval time.Duration, udpxyURLCfg string) (*gin.Engine, error) {
+func NewEngine(ctx context.Context, conf *config.Config, scheduleCfg ScheduleConfig, udpxyURLCfg string, prerender []string) (*gin.Engine, error) {
 	// L()：获取全局logger
 	logger = zap.L()
 
 	gin.SetMode(gin.ReleaseMode)
 
-	// 获取程序运行的当前路径
-	currDir, err := util.GetCurrentAbPathByExecutable()
+	// 获取台标目录的路径
+	var err error
+	logoDir, err = iptv.ResolveLogoDir(conf.LogoDir)
 	if err != nil {
 		return nil, err
 	}
+	// 缓存是否生成占位台标
+	logoPlaceholder = conf.LogoPlaceholder
+	if info, err := os.Stat(logoDir); (err != nil || !info.IsDir()) && !logoPlaceholder {
+		logger.Warn("The logo directory does not exist. Channel logos will not be output.", zap.String("logoDir", logoDir))
+	}
 
 	// 创建IPTV客户端
 	iptvClient, err := newIPTVClient(conf)
@@ -42,6 +78,96 @@ func NewEngine(ctx context.Context, conf *config.Config, interval time.Duration,
 		return nil, err
 	}
 
+	// 缓存udpxy配置
+	udpxyURLs = parseUdpxyURLs(udpxyURLCfg)
+
+	// 缓存回看请求参数配置
+	catchupSources = conf.Catchup.Sources
+	catchupDefault = conf.Catchup.Default
+	catchupLiveFallback = conf.Catchup.LiveFallback
+
+	// 缓存播放器的预设参数
+	uaPresets = conf.UserAgentPresets
+
+	// 缓存频道的DRM信息
+	chDRMMap = conf.ChDRMMap
+
+	// 缓存频道的国家和语言信息
+	chDefaultLocale = conf.ChDefaultLocale
+	chGroupLocaleMap = conf.ChGroupLocaleMap
+
+	// 缓存没有分组的频道使用的分组名称
+	chDefaultGroup = conf.ChDefaultGroup
+
+	// 缓存频道分组的输出顺序
+	chGroupOrder = conf.GroupOrder.Groups
+	chGroupUnlisted = conf.GroupOrder.Unlisted
+
+	// 缓存频道单播地址改写后的协议
+	chURLScheme = conf.ChURLScheme
+
+	// 缓存频道号重复时的处理方式
+	chRenumberDuplicates = conf.ChRenumberDuplicates
+
+	// 缓存是否合并频道ID相同的频道
+	chDedup = conf.ChDedup
+
+	// 缓存台标名称的处理方式
+	chLogoSanitize = conf.ChLogoSanitize
+	logoBaseURL = conf.LogoBaseURL
+	if logoBaseURL != "" && !iptv.IsAbsoluteLogoBaseURL(logoBaseURL) {
+		logger.Warn("The logo base url is not a valid absolute url. Use the relative path instead.", zap.String("logoBaseUrl", logoBaseURL))
+		logoBaseURL = relativeLogoBaseUrl
+	}
+
+	// 缓存查找台标文件时使用的频道字段
+	logoFields = conf.LogoFields
+
+	// 缓存tvg-id使用的频道字段
+	tvgIDField = conf.TvgIDField
+
+	// 缓存m3u中#EXTINF的时长字段
+	extInfDuration = conf.ExtInfDuration
+
+	// 缓存m3u中catchup-days的最大值
+	maxCatchupDays = conf.MaxCatchupDays
+
+	// 缓存catchup-days是否不超过节目单实际覆盖的回看天数
+	catchupDaysFromEPG = conf.CatchupDaysFromEPG
+
+	// 缓存生成m3u时，频道无法获取URL地址是否中止生成
+	m3uStrict = conf.M3UStrict
+
+	// 缓存直播源内容末尾是否保留换行符
+	trailingNewline = conf.TrailingNewline
+
+	// 缓存组播转单播的路径模板
+	multicastRelayPath = conf.MulticastRelayPath
+
+	// 缓存xmltv中节目时间的时区
+	xmltvLocation = conf.TimeLocation
+
+	// 缓存频道列表为空时是否重试
+	retryEmptyChannels = conf.RetryEmptyChannels
+
+	// 缓存刷新数据前的连通性检查配置
+	precheck = conf.Precheck
+	serverHost = conf.ServerHost
+
+	// 缓存需要预先生成的直播源格式
+	for _, format := range prerender {
+		if format != formatM3U && format != formatTXT && format != formatPLS {
+			return nil, fmt.Errorf("prerender format not support: %s", format)
+		}
+	}
+	prerenderFormats = prerender
+
+	// 校验并创建定时任务
+	tasks, err := newScheduledTasks(scheduleCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// 执行初始化操作
 	err = initData(ctx, iptvClient)
 	if err != nil {
@@ -49,13 +175,10 @@ func NewEngine(ctx context.Context, conf *config.Config, interval time.Duration,
 	}
 
 	// 执行定时任务
-	Schedule(ctx, iptvClient, interval)
+	schedule(ctx, iptvClient, tasks)
 
-	// 缓存udpxy配置
-	udpxyURLs = parseUdpxyURLs(udpxyURLCfg)
-
-	// 缓存回看请求参数配置
-	catchupSources = conf.Catchup.Sources
+	// 缓存手动刷新频道列表使用的IPTV客户端
+	refreshClient = iptvClient
 
 	// 创建 Gin 路由引擎
 	r := gin.New()
@@ -70,19 +193,36 @@ func NewEngine(ctx context.Context, conf *config.Config, interval time.Duration,
 	r.GET("/channel/txt", GetTXTData)
 	// 查询直播源-pls格式
 	r.GET("/channel/pls", GetPLSData)
+	// 查询直播源-json格式
+	r.GET("/channel/json", GetJSONData)
 
 	// 查询EPG-json格式
 	r.GET("/epg/json", GetJsonEPG)
 	// 查询EPG-xml格式
 	r.GET("/epg/xml", GetXmlEPG)
 	r.GET("/epg/xml.gz", GetXmlEPGWithGzip)
+	// 查询缓存的EPG-xml文件，节目单更新前不重复生成
+	r.GET("/epg.xml", GetXmlEPGFile)
+	r.GET("/epg.xml.gz", GetXmlEPGFileWithGzip)
+	// 查询EPG的覆盖情况统计
+	r.GET("/epg/stats", GetEPGStats)
 
-	// 查询频道logo
-	r.Static("/logo", path.Join(currDir, "logos"))
+	// 查询频道logo，开启占位台标时，台标文件不存在则生成占位台标
+	if logoPlaceholder {
+		r.GET("/logo/:name", GetLogo)
+	} else {
+		r.Static("/logo", logoDir)
+	}
 
 	// 查询直播配置接口
 	r.GET("/config/lives", GetLivesConfig)
 
+	// 查询服务的健康状态
+	r.GET("/healthz", GetHealth)
+
+	// 立即刷新频道列表
+	r.POST("/refresh", PostRefresh)
+
 	return r, nil
 }
 
@@ -111,6 +251,11 @@ func parseUdpxyURLs(udpxyURLCfg string) map[string]string {
 
 // initData 初始化数据
 func initData(ctx context.Context, iptvClient iptv.Client) error {
+	// 检查IPTV服务器的连通性
+	if err := checkPortalReachable(ctx); err != nil {
+		return err
+	}
+
 	// 更新频道列表数据
 	if err := updateChannelsWithRetry(ctx, iptvClient, 3); err != nil {
 		return err
@@ -123,6 +268,14 @@ func initData(ctx context.Context, iptvClient iptv.Client) error {
 	return nil
 }
 
+// checkPortalReachable 开启连通性检查时，检查IPTV服务器是否可达
+func checkPortalReachable(ctx context.Context) error {
+	if !precheck {
+		return nil
+	}
+	return iptv.CheckPortalReachable(ctx, serverHost, iptv.DefaultPrecheckTimeout)
+}
+
 // newIPTVClient 读取配置文件并创建IPTV客户端
 func newIPTVClient(conf *config.Config) (iptv.Client, error) {
 	// 校验配置文件
@@ -130,9 +283,6 @@ func newIPTVClient(conf *config.Config) (iptv.Client, error) {
 		return nil, err
 	}
 
-	// 创建IPTV客户端
-	return hwctc.NewClient(&http.Client{
-		Timeout: 10 * time.Second,
-	}, conf.HWCTC, conf.Key, conf.ServerHost, conf.Headers,
-		conf.ChExcludeRule, conf.ChGroupRulesList, conf.ChLogoRuleList)
+	// 根据配置的平台创建IPTV客户端
+	return conf.NewIPTVClient()
 }
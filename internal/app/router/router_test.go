@@ -0,0 +1,38 @@
+package router
+
+import (
+	"context"
+	"iptv/internal/app/iptv"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// fakeIPTVClient 用于测试的IPTV客户端
+type fakeIPTVClient struct {
+	channels     []iptv.Channel
+	chProgLists  []iptv.ChannelProgramList
+	channelCalls int
+	// onGetProgramList 获取节目单期间执行，用于模拟同时刷新频道列表
+	onGetProgramList func()
+}
+
+var _ iptv.Client = (*fakeIPTVClient)(nil)
+
+func (f *fakeIPTVClient) GetAllChannelList(_ context.Context) ([]iptv.Channel, error) {
+	f.channelCalls++
+	return f.channels, nil
+}
+
+func (f *fakeIPTVClient) GetAllChannelProgramList(_ context.Context, _ []iptv.Channel) ([]iptv.ChannelProgramList, error) {
+	if f.onGetProgramList != nil {
+		f.onGetProgramList()
+	}
+	return f.chProgLists, nil
+}
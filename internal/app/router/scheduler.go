@@ -2,39 +2,126 @@ package router
 
 import (
 	"context"
+	"fmt"
 	"iptv/internal/app/iptv"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 )
 
 const waitSeconds = 30
 
-// Schedule 定时调度更新缓存数据
-func Schedule(ctx context.Context, iptvClient iptv.Client, duration time.Duration) {
-	// 创建定时任务
-	ticker := time.NewTicker(duration)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("The scheduling task has been stopped.")
-				return
-			case <-ticker.C:
-				logger.Info("Start executing the scheduling task.")
-
-				// 更新频道列表数据
-				if err := updateChannelsWithRetry(ctx, iptvClient, 3); err != nil {
-					logger.Error("Failed to update channel list.", zap.Error(err))
-				}
-
-				// 更新节目单数据
-				if err := updateEPG(ctx, iptvClient); err != nil {
-					logger.Error("Failed to update EPG.", zap.Error(err))
-				}
-
-				logger.Info("The scheduling task has been completed.")
-			}
+// sleep 失败重试前的等待，测试时可替换
+var sleep = time.Sleep
+
+// ScheduleConfig 定时刷新缓存数据的配置
+type ScheduleConfig struct {
+	Interval    time.Duration // 自动刷新频道列表和节目单的间隔时间
+	ChannelCron string        // 刷新频道列表的cron表达式，配置后不再按间隔时间刷新频道列表
+	EPGCron     string        // 刷新节目单的cron表达式，配置后不再按间隔时间刷新节目单
+}
+
+// clock 时钟，便于测试时替换为模拟时钟
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// scheduledTask 定时任务
+type scheduledTask struct {
+	name     string
+	schedule cron.Schedule
+	run      func(ctx context.Context, iptvClient iptv.Client)
+}
+
+// newScheduledTasks 根据配置创建定时任务，并校验cron表达式
+func newScheduledTasks(cfg ScheduleConfig) ([]scheduledTask, error) {
+	// 未配置cron表达式时，按间隔时间依次更新频道列表和节目单
+	if cfg.ChannelCron == "" && cfg.EPGCron == "" {
+		return []scheduledTask{
+			{
+				name:     "all",
+				schedule: cron.Every(cfg.Interval),
+				run: func(ctx context.Context, iptvClient iptv.Client) {
+					refreshChannels(ctx, iptvClient)
+					refreshEPG(ctx, iptvClient)
+				},
+			},
+		}, nil
+	}
+
+	channelSchedule, err := parseSchedule(cfg.ChannelCron, cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel cron expression: %w", err)
+	}
+	epgSchedule, err := parseSchedule(cfg.EPGCron, cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid epg cron expression: %w", err)
+	}
+
+	return []scheduledTask{
+		{name: "channel", schedule: channelSchedule, run: refreshChannels},
+		{name: "epg", schedule: epgSchedule, run: refreshEPG},
+	}, nil
+}
+
+// parseSchedule 解析cron表达式，未配置时按间隔时间调度
+func parseSchedule(spec string, interval time.Duration) (cron.Schedule, error) {
+	if spec == "" {
+		return cron.Every(interval), nil
+	}
+	return cron.ParseStandard(spec)
+}
+
+// schedule 定时调度更新缓存数据
+func schedule(ctx context.Context, iptvClient iptv.Client, tasks []scheduledTask) {
+	for _, task := range tasks {
+		go runScheduledTask(ctx, realClock{}, iptvClient, task)
+	}
+}
+
+// runScheduledTask 按调度规则循环执行定时任务
+func runScheduledTask(ctx context.Context, clk clock, iptvClient iptv.Client, task scheduledTask) {
+	for {
+		now := clk.Now()
+		next := task.schedule.Next(now)
+		select {
+		case <-ctx.Done():
+			logger.Info("The scheduling task has been stopped.", zap.String("task", task.name))
+			return
+		case <-clk.After(next.Sub(now)):
+			logger.Info("Start executing the scheduling task.", zap.String("task", task.name))
+			task.run(ctx, iptvClient)
+			logger.Info("The scheduling task has been completed.", zap.String("task", task.name))
 		}
-	}()
+	}
+}
+
+// refreshChannels 更新频道列表数据
+func refreshChannels(ctx context.Context, iptvClient iptv.Client) {
+	if err := checkPortalReachable(ctx); err != nil {
+		logger.Error("Failed to update channel list.", zap.Error(err))
+		return
+	}
+	if err := updateChannelsWithRetry(ctx, iptvClient, 3); err != nil {
+		logger.Error("Failed to update channel list.", zap.Error(err))
+	}
+}
+
+// refreshEPG 更新节目单数据
+func refreshEPG(ctx context.Context, iptvClient iptv.Client) {
+	if err := checkPortalReachable(ctx); err != nil {
+		logger.Error("Failed to update EPG.", zap.Error(err))
+		return
+	}
+	if err := updateEPG(ctx, iptvClient); err != nil {
+		logger.Error("Failed to update EPG.", zap.Error(err))
+	}
 }
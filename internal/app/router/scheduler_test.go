@@ -0,0 +1,122 @@
+package router
+
+import (
+	"context"
+	"iptv/internal/app/iptv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 模拟时钟，由测试控制时间的推进
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{
+		now:   now,
+		waits: make(chan time.Duration),
+		fire:  make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+// advance 推进时间，并触发等待中的定时器
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.fire <- now
+}
+
+func TestRunScheduledTaskCron(t *testing.T) {
+	tasks, err := newScheduledTasks(ScheduleConfig{Interval: 24 * time.Hour, EPGCron: "0 4 * * *"})
+	if err != nil {
+		t.Fatalf("newScheduledTasks() error = %v", err)
+	}
+	if len(tasks) != 2 || tasks[1].name != "epg" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	ran := make(chan time.Time, 1)
+	clk := newFakeClock(time.Date(2024, 11, 22, 3, 30, 0, 0, time.Local))
+	task := tasks[1]
+	task.run = func(ctx context.Context, iptvClient iptv.Client) {
+		ran <- clk.Now()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runScheduledTask(ctx, clk, nil, task)
+
+	// 当前时间为03:30，应在04:00触发
+	if wait := <-clk.waits; wait != 30*time.Minute {
+		t.Fatalf("first wait = %v, want 30m", wait)
+	}
+	clk.advance(30 * time.Minute)
+	if got, want := <-ran, time.Date(2024, 11, 22, 4, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("task ran at %v, want %v", got, want)
+	}
+
+	// 下一次应在第二天的04:00触发
+	if wait := <-clk.waits; wait != 24*time.Hour {
+		t.Errorf("second wait = %v, want 24h", wait)
+	}
+}
+
+func TestNewScheduledTasks(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       ScheduleConfig
+		wantTasks []string
+		wantErr   bool
+	}{
+		{
+			name:      "interval_only",
+			cfg:       ScheduleConfig{Interval: time.Hour},
+			wantTasks: []string{"all"},
+		},
+		{
+			name:      "channel_and_epg_cron",
+			cfg:       ScheduleConfig{Interval: time.Hour, ChannelCron: "0 */6 * * *", EPGCron: "0 4 * * *"},
+			wantTasks: []string{"channel", "epg"},
+		},
+		{
+			name:    "invalid_cron",
+			cfg:     ScheduleConfig{Interval: time.Hour, ChannelCron: "0 25 * * *"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := newScheduledTasks(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newScheduledTasks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tasks) != len(tt.wantTasks) {
+				t.Fatalf("len(tasks) = %d, want %d", len(tasks), len(tt.wantTasks))
+			}
+			for i, task := range tasks {
+				if task.name != tt.wantTasks[i] {
+					t.Errorf("tasks[%d].name = %s, want %s", i, task.name, tt.wantTasks[i])
+				}
+			}
+		})
+	}
+}